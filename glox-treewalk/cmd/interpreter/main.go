@@ -1,72 +1,63 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"os"
 
-	"github.com/littlekuo/glox-treewalk/internal/interpreter"
-
-	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/bytecode"
+	"github.com/littlekuo/glox-treewalk/lox"
+	"github.com/littlekuo/glox-treewalk/repl"
 )
 
 func main() {
-	args := os.Args[1:]
+	fs := flag.NewFlagSet("glox", flag.ExitOnError)
+	backend := fs.String("backend", "treewalk", "backend running scripts: treewalk or vm")
+	fs.Usage = func() {
+		fmt.Println("Usage: glox [--backend=treewalk|vm] [script]")
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(64)
+	}
+	args := fs.Args()
+	if *backend != "treewalk" && *backend != "vm" {
+		fmt.Printf("unknown backend %q\n", *backend)
+		fs.Usage()
+		os.Exit(64)
+	}
 
 	switch len(args) {
 	case 0:
+		if *backend == "vm" {
+			fmt.Println("the vm backend runs scripts only, the REPL uses treewalk")
+			os.Exit(64)
+		}
 		runPrompt()
 	case 1:
-		runFile(args[0])
+		runFile(args[0], *backend)
 	default:
-		fmt.Println("Usage: glox [script]")
+		fs.Usage()
 		os.Exit(64)
 	}
 }
 
-func runFile(path string) error {
-	bytes, err := os.ReadFile(path)
-	if err != nil {
+func runFile(path string, backend string) error {
+	if _, err := os.Stat(path); err != nil {
 		return err
 	}
-	if err = run(string(bytes)); err != nil {
+	run := lox.NewVM().RunFile
+	if backend == "vm" {
+		run = func(path string) error { return bytecode.RunFile(path) }
+	}
+	if err := run(path); err != nil {
 		os.Exit(65)
 	}
 	return nil
 }
 
 func runPrompt() {
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Print("> ")
-		if !scanner.Scan() { // 处理Ctrl+D
-			break
-		}
-		line := scanner.Text()
-		run(line)
-	}
-}
-
-func run(source string) error {
-	scanner := syntax.NewScanner(source)
-	tokens := scanner.ScanTokens()
-	if err := scanner.GetError(); err != nil {
-		return err
-	}
-	parser := syntax.NewParser(tokens)
-	stmts := parser.Parse()
-	if err := parser.GetError(); err != nil {
-		return err
+	if err := repl.New().Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(74)
 	}
-	interpret := interpreter.NewInterpreter()
-	resolver := interpreter.NewResolver(interpret)
-	resolver.Resolve(stmts)
-	if err := resolver.GetError(); err != nil {
-		return err
-	}
-	interpret.Interpret(stmts)
-	if err := interpret.GetError(); err != nil {
-		return err
-	}
-	return nil
 }
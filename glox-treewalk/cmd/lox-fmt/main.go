@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+var (
+	check bool
+	write bool
+)
+
+// lox-fmt formats the given .lox files, or standard input, and prints the
+// result. With --check it only lists the files that aren't formatted, with
+// --write it rewrites them in place, which standard input can't be.
+func main() {
+	fs := flag.NewFlagSet("lox-fmt", flag.ExitOnError)
+	fs.BoolVar(&check, "check", false, "list files whose formatting differs and exit with status 1 if there are any")
+	fs.BoolVar(&write, "write", false, "write the result back to the files instead of printing it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: lox-fmt [--check | --write] [file ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		fmt.Printf("parse failed, err [%s]", err.Error())
+		os.Exit(64)
+	}
+	if check && write {
+		fs.Usage()
+		os.Exit(64)
+	}
+
+	if fs.NArg() == 0 {
+		// there is no file to write the result back to
+		if write {
+			fs.Usage()
+			os.Exit(64)
+		}
+		os.Exit(formatStdin())
+	}
+
+	status := 0
+	for _, path := range fs.Args() {
+		if code := formatFile(path); code > status {
+			status = code
+		}
+	}
+	os.Exit(status)
+}
+
+// formatStdin formats standard input, which --check lists as <stdin>, and
+// returns the exit status for it.
+func formatStdin() int {
+	source, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 74
+	}
+	return formatSource("<stdin>", string(source), func(formatted string) error {
+		switch {
+		case check && formatted == string(source):
+			return nil
+		case check:
+			fmt.Println("<stdin>")
+			return errUnformatted
+		}
+		_, err := os.Stdout.WriteString(formatted)
+		return err
+	})
+}
+
+// formatFile formats the file at path and returns the exit status for it.
+func formatFile(path string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 74
+	}
+	return formatSource(path, string(source), func(formatted string) error {
+		switch {
+		case formatted == string(source) && (check || write):
+			return nil
+		case check:
+			fmt.Println(path)
+			return errUnformatted
+		case write:
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+		}
+		_, err := os.Stdout.WriteString(formatted)
+		return err
+	})
+}
+
+var errUnformatted = fmt.Errorf("not formatted")
+
+// formatSource formats source and hands the result to output. Syntax errors
+// are printed with the location in file.
+func formatSource(file string, source string, output func(string) error) int {
+	report := util.WithReporter(func(d *util.Diagnostic) {
+		d.Locate(file, source)
+		fmt.Fprint(os.Stderr, d.Render())
+	})
+	formatted, err := syntax.FormatSource(source, report)
+	if err != nil {
+		return 65
+	}
+	if err := output(formatted); err != nil {
+		if err == errUnformatted {
+			return 1
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 74
+	}
+	return 0
+}
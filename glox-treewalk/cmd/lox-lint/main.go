@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/littlekuo/glox-treewalk/internal/lint"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+var (
+	format     string
+	configPath string
+	enable     string
+	disable    string
+	list       bool
+)
+
+// warning is a lint warning in the JSON output.
+type warning struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// lox-lint checks the given .lox files, or standard input, and prints the
+// warnings of the enabled rules. It exits with status 1 if there are any.
+// Rules are configured by the nearest .loxlint.json, then by --enable and
+// --disable.
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run lints as lox-lint does with args, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lox-lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&format, "format", "text", "output format, text or json")
+	fs.StringVar(&configPath, "config", "", "configuration file (default: the nearest "+lint.ConfigFile+")")
+	fs.StringVar(&enable, "enable", "", "comma-separated rules to enable")
+	fs.StringVar(&disable, "disable", "", "comma-separated rules to disable")
+	fs.BoolVar(&list, "list", false, "list the rules and exit")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: lox-lint [flags] [file ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 64
+	}
+	if format != "text" && format != "json" {
+		fs.Usage()
+		return 64
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 64
+	}
+	if list {
+		for _, rule := range lint.Rules {
+			state := "on"
+			if !config.Enabled(rule.ID) {
+				state = "off"
+			}
+			fmt.Fprintf(stdout, "%-24s %-3s %s\n", rule.ID, state, rule.Description)
+		}
+		return 0
+	}
+
+	var warnings []*util.Diagnostic
+	status := 0
+	lintSource := func(file string, source string) {
+		found, code := lintFile(file, source, config, stderr)
+		warnings = append(warnings, found...)
+		status = max(status, code)
+	}
+	if fs.NArg() == 0 {
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 74
+		}
+		lintSource("<stdin>", string(source))
+	}
+	for _, path := range fs.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = max(status, 74)
+			continue
+		}
+		lintSource(path, string(source))
+	}
+
+	if err := output(stdout, warnings); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 74
+	}
+	if status == 0 && len(warnings) > 0 {
+		status = 1
+	}
+	return status
+}
+
+func loadConfig() (*lint.Config, error) {
+	config := lint.DefaultConfig()
+	if configPath == "" {
+		configPath = lint.FindConfig(".")
+	}
+	if configPath != "" {
+		var err error
+		if config, err = lint.LoadConfig(configPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.Set(enable, true); err != nil {
+		return nil, err
+	}
+	if err := config.Set(disable, false); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// lintFile lints source and returns its warnings, located in file, and the
+// exit status for it. Syntax errors are printed right away.
+func lintFile(file string, source string, config *lint.Config, stderr io.Writer) ([]*util.Diagnostic, int) {
+	report := util.WithReporter(func(d *util.Diagnostic) {
+		d.Locate(file, source)
+		fmt.Fprint(stderr, d.Render())
+	})
+	warnings, err := lint.Source(source, config, report)
+	if err != nil {
+		return nil, 65
+	}
+	for _, d := range warnings {
+		d.Locate(file, source)
+	}
+	return warnings, 0
+}
+
+func output(stdout io.Writer, warnings []*util.Diagnostic) error {
+	if format == "text" {
+		for _, d := range warnings {
+			if _, err := fmt.Fprint(stdout, d.Render()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	entries := make([]warning, 0, len(warnings))
+	for _, d := range warnings {
+		entries = append(entries, warning{
+			File:     d.File,
+			Line:     d.Line,
+			Column:   d.Column,
+			Rule:     d.Code,
+			Severity: d.Severity.String(),
+			Message:  d.Message,
+		})
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/littlekuo/glox-treewalk/internal/lint"
+)
+
+const script = "fun f(a) {\n  var b = 1;\n  return 2;\n  print 3;\n}\nf(1);\n"
+
+// lintScript writes script to a directory with the given configuration, or
+// none if it's empty, and runs lox-lint on it from there.
+func lintScript(t *testing.T, config string, args ...string) (int, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if config != "" {
+		if err := os.WriteFile(filepath.Join(dir, lint.ConfigFile), []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := filepath.Join(dir, "src")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(sub, "script.lox")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+	var stdout, stderr bytes.Buffer
+	status := run(append(args, "script.lox"), strings.NewReader(""), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestJSONOutput(t *testing.T) {
+	status, stdout, stderr := lintScript(t, "", "--format", "json")
+	if status != 1 {
+		t.Fatalf("status %d, stderr %s", status, stderr)
+	}
+	var got []warning
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("output isn't JSON: %s\n%s", err, stdout)
+	}
+	want := []warning{
+		{"script.lox", 1, 7, lint.RuleUnusedParameter, "warning", "parameter 'a' is never used"},
+		{"script.lox", 2, 7, lint.RuleUnusedVariable, "warning", "local variable 'b' is never used"},
+		{"script.lox", 4, 3, lint.RuleUnreachableCode, "warning", "code after 'return' is unreachable"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestNoWarnings(t *testing.T) {
+	status, stdout, _ := lintScript(t, "", "--format", "json",
+		"--disable", "unused-parameter,unused-variable,unreachable-code")
+	if status != 0 || strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("status %d, output %s", status, stdout)
+	}
+}
+
+func TestRuleSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		want   []string
+	}{
+		{"every rule", "", nil,
+			[]string{lint.RuleUnusedParameter, lint.RuleUnusedVariable, lint.RuleUnreachableCode}},
+		{"config in a parent directory", `{"rules": {"unused-parameter": false}}`, nil,
+			[]string{lint.RuleUnusedVariable, lint.RuleUnreachableCode}},
+		{"disable", "", []string{"--disable", "unused-variable, unreachable-code"},
+			[]string{lint.RuleUnusedParameter}},
+		{"enable over config", `{"rules": {"unused-parameter": false, "unused-variable": false}}`,
+			[]string{"--enable", "unused-variable"},
+			[]string{lint.RuleUnusedVariable, lint.RuleUnreachableCode}},
+		{"disable over enable", "", []string{"--enable", "shadowing", "--disable", "unused-parameter,unused-variable"},
+			[]string{lint.RuleUnreachableCode}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, stdout, stderr := lintScript(t, test.config, append(test.args, "--format", "json")...)
+			var warnings []warning
+			if err := json.Unmarshal([]byte(stdout), &warnings); err != nil {
+				t.Fatalf("%s\n%s", err, stderr)
+			}
+			got := make([]string, 0, len(warnings))
+			for _, w := range warnings {
+				got = append(got, w.Rule)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+	}{
+		{"unknown rule", "", []string{"--disable", "no-such-rule"}},
+		{"unknown format", "", []string{"--format", "xml"}},
+		{"invalid config", `{"rules": {"no-such-rule": true}}`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, _, stderr := lintScript(t, test.config, test.args...); status != 64 || stderr == "" {
+				t.Errorf("status %d, stderr %q", status, stderr)
+			}
+		})
+	}
+}
+
+func TestTextOutput(t *testing.T) {
+	status, stdout, _ := lintScript(t, "", "--disable", "unused-parameter,unused-variable")
+	if status != 1 || !strings.Contains(stdout, "warning[unreachable-code]: code after 'return' is unreachable") ||
+		!strings.Contains(stdout, "script.lox:4:3") {
+		t.Errorf("status %d, output\n%s", status, stdout)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/littlekuo/glox-treewalk/internal/lsp"
+)
+
+// lox-lsp is a Language Server Protocol server for Lox. Editors start it
+// and talk to it over standard input and output.
+func main() {
+	fs := flag.NewFlagSet("lox-lsp", flag.ExitOnError)
+	// editors pass --stdio to servers that support several transports
+	fs.Bool("stdio", true, "talk over standard input and output, the only transport")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		fmt.Printf("parse failed, err [%s]", err.Error())
+		os.Exit(64)
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
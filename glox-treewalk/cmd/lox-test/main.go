@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/loxtest"
+)
+
+var (
+	testDir string
+	verbose bool
+	filter  string
+	backend string
+)
+
+func main() {
+	fs := flag.NewFlagSet("lox-test", flag.ExitOnError)
+	fs.StringVar(&testDir, "dir", "../test", "root directory of the .lox test corpus")
+	fs.StringVar(&filter, "filter", "", "only run tests whose path contains this string")
+	fs.StringVar(&backend, "backend", string(loxtest.BackendTreewalk), "backend to run the tests on: treewalk or vm")
+	fs.BoolVar(&verbose, "v", false, "print every test result and skip reason")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		fmt.Printf("parse failed, err [%s]", err.Error())
+		os.Exit(64)
+	}
+
+	if backend != string(loxtest.BackendTreewalk) && backend != string(loxtest.BackendVM) {
+		fmt.Printf("unknown backend %q\n", backend)
+		os.Exit(64)
+	}
+
+	results, err := loxtest.RunSuite(testDir, loxtest.Backend(backend))
+	if err != nil {
+		fmt.Printf("run suite failed, err [%s]\n", err.Error())
+		os.Exit(1)
+	}
+	if filter != "" {
+		filtered := results[:0]
+		for _, result := range results {
+			if strings.Contains(result.Path, filter) {
+				filtered = append(filtered, result)
+			}
+		}
+		results = filtered
+	}
+
+	for _, result := range results {
+		switch {
+		case result.Status == loxtest.StatusFail:
+			fmt.Printf("%s %s\n", result.Status, result.Path)
+			for _, failure := range result.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		case verbose && result.Status == loxtest.StatusSkip:
+			fmt.Printf("%s %s (%s)\n", result.Status, result.Path, result.Reason)
+		case verbose:
+			fmt.Printf("%s %s\n", result.Status, result.Path)
+		}
+	}
+
+	var pass, fail, skip int
+	fmt.Printf("%-20s %6s %6s %6s\n", "directory", "pass", "fail", "skip")
+	for _, summary := range loxtest.Summarize(results) {
+		fmt.Printf("%-20s %6d %6d %6d\n", summary.Dir, summary.Pass, summary.Fail, summary.Skip)
+		pass += summary.Pass
+		fail += summary.Fail
+		skip += summary.Skip
+	}
+	fmt.Printf("%-20s %6d %6d %6d\n", "total", pass, fail, skip)
+	if fail > 0 {
+		os.Exit(1)
+	}
+}
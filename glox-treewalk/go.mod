@@ -2,4 +2,12 @@ module github.com/littlekuo/glox-treewalk
 
 go 1.24.2
 
-require golang.org/x/text v0.24.0
+require (
+	github.com/peterh/liner v1.2.2
+	golang.org/x/text v0.24.0
+)
+
+require (
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.0.0-20211117180635-dee7805ff2e1 // indirect
+)
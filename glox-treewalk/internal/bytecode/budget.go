@@ -0,0 +1,84 @@
+package bytecode
+
+import (
+	"context"
+	"time"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// pollInterval is the number of check points between two polls of the
+// context and the clock, which are too slow to consult on every iteration.
+const pollInterval = 1024
+
+// approximate sizes in bytes of the values a script allocates, as the
+// tree-walker counts them. Variables live on the stack of the VM and aren't
+// counted.
+const (
+	sizeString   = 16 // plus the bytes of the string
+	sizeInstance = 48
+	sizeField    = 32 // plus the bytes of the name
+	sizeClosure  = 48
+	sizeList     = 32 // plus a value per element
+	sizeMap      = 48 // plus a field per entry
+	sizeValue    = 16
+)
+
+// begin prepares the budgets of a new run.
+func (vm *VM) begin(ctx context.Context) {
+	vm.ctx = ctx
+	vm.steps = 0
+	vm.checks = 0
+	vm.allocated = 0
+	vm.deadline = time.Time{}
+	if vm.opts.Timeout > 0 {
+		vm.deadline = time.Now().Add(vm.opts.Timeout)
+	}
+}
+
+// checkpoint runs at loop back-edges and calls, and interrupts the run once
+// the context is done or a budget is spent. Steps are only counted, by
+// OpStep, when the options set a step budget.
+func (vm *VM) checkpoint() error {
+	if vm.opts.MaxSteps > 0 && vm.steps > vm.opts.MaxSteps {
+		return interpreter.Interrupt(syntax.Token{}, interpreter.ErrBudgetExceeded)
+	}
+	vm.checks++
+	if vm.checks%pollInterval != 0 {
+		return nil
+	}
+	return vm.poll()
+}
+
+func (vm *VM) poll() error {
+	if vm.ctx.Err() != nil {
+		return interpreter.Interrupt(syntax.Token{}, interpreter.ErrCancelled)
+	}
+	if !vm.deadline.IsZero() && time.Now().After(vm.deadline) {
+		return interpreter.Interrupt(syntax.Token{}, interpreter.ErrBudgetExceeded)
+	}
+	return nil
+}
+
+// charge accounts size bytes allocated by the current run. Like in the
+// tree-walker, allocations are never given back, so the quota bounds the
+// total a run allocates rather than what it keeps alive.
+func (vm *VM) charge(size int) error {
+	vm.allocated += int64(size)
+	if vm.opts.MemoryQuota > 0 && vm.allocated > vm.opts.MemoryQuota {
+		return interpreter.Interrupt(syntax.Token{}, interpreter.ErrMemoryQuotaExceeded)
+	}
+	return nil
+}
+
+// quota charges the results of stdlib methods to the VM.
+type quota VM
+
+func (q *quota) Strings(n int, bytes int) error {
+	return (*VM)(q).charge(sizeString*n + bytes)
+}
+
+func (q *quota) List(n int) error {
+	return (*VM)(q).charge(sizeList + sizeValue*n)
+}
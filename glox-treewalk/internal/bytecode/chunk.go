@@ -0,0 +1,98 @@
+package bytecode
+
+import "github.com/littlekuo/glox-treewalk/internal/syntax"
+
+type OpCode byte
+
+// Operands follow the opcode. Constants, locals and upvalues are addressed
+// with one byte, globals and jumps with two, high byte first.
+const (
+	OpConstant     OpCode = iota // constant
+	OpNil                        //
+	OpTrue                       //
+	OpFalse                      //
+	OpPop                        //
+	OpGetLocal                   // slot
+	OpSetLocal                   // slot
+	OpGetGlobal                  // global16
+	OpSetGlobal                  // global16
+	OpDefineGlobal               // global16
+	OpGetUpvalue                 // upvalue
+	OpSetUpvalue                 // upvalue
+	OpGetProperty                // name
+	OpSetProperty                // name
+	OpGetSuper                   // name
+	OpEqual                      //
+	OpNotEqual                   //
+	OpGreater                    //
+	OpGreaterEqual               //
+	OpLess                       //
+	OpLessEqual                  //
+	OpAdd                        //
+	OpSubtract                   //
+	OpMultiply                   //
+	OpDivide                     //
+	OpModulo                     //
+	OpNot                        //
+	OpNegate                     //
+	OpPrint                      //
+	OpJump                       // offset16
+	OpJumpIfFalse                // offset16, leaves the condition
+	OpLoop                       // offset16, backwards
+	OpCall                       // argc
+	OpInvoke                     // name, argc
+	OpSuperInvoke                // name, argc
+	OpClosure                    // function, then isLocal and index per upvalue
+	OpCloseUpvalue               //
+	OpReturn                     //
+	OpClass                      // name
+	OpInherit                    //
+	OpMethod                     // name
+	OpList                       // count16
+	OpMap                        // count16, of key-value pairs
+	OpIndex                      //
+	OpIndexSet                   //
+	OpInterpolate                // count16
+	OpThrow                      //
+	OpTryCatch                   // offset16 of the handler
+	OpTryFinally                 // offset16 of the handler
+	OpPopTry                     //
+	OpRethrow                    //
+	OpIterate                    //
+	OpForNext                    // slot of the iterator, offset16 of the loop exit
+	OpStep                       // counts a statement, with a step budget only
+)
+
+// Chunk is the bytecode of one function. Every byte of code is mapped to the
+// token it was compiled from, which locates runtime errors.
+type Chunk struct {
+	code      []byte
+	constants []Value
+	spans     []int32 // index into tokens per byte of code
+	tokens    []syntax.Token
+}
+
+func (c *Chunk) write(b byte, token syntax.Token) {
+	if n := len(c.tokens); n == 0 || !sameToken(c.tokens[n-1], token) {
+		c.tokens = append(c.tokens, token)
+	}
+	c.code = append(c.code, b)
+	c.spans = append(c.spans, int32(len(c.tokens)-1))
+}
+
+// token returns the token the byte at offset was compiled from.
+func (c *Chunk) token(offset int) syntax.Token {
+	if offset < 0 || offset >= len(c.spans) {
+		return syntax.Token{}
+	}
+	return c.tokens[c.spans[offset]]
+}
+
+func (c *Chunk) addConstant(value Value) int {
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
+
+func sameToken(a, b syntax.Token) bool {
+	return a.TokenType == b.TokenType && a.Pos == b.Pos && a.Line == b.Line && a.Lexeme == b.Lexeme
+}
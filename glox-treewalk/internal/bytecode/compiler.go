@@ -0,0 +1,1023 @@
+package bytecode
+
+import (
+	"math"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// The compiler works on resolved syntax trees: scope errors such as reading a
+// local in its own initializer are reported by the resolver before, so the
+// only errors left here are the limits of the bytecode format.
+const (
+	maxConstants = math.MaxUint8 + 1
+	maxLocals    = math.MaxUint8 + 1
+	maxUpvalues  = math.MaxUint8 + 1
+	maxGlobals   = math.MaxUint16 + 1
+	maxJump      = math.MaxUint16
+	maxElements  = math.MaxUint16 // of list and map literals and interpolations
+)
+
+type funcKind int
+
+const (
+	funcScript funcKind = iota
+	funcFunction
+	funcMethod
+	funcInitializer
+)
+
+type local struct {
+	name     string // empty for the hidden slots of the compiler
+	depth    int
+	captured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// loop tracks the jumps of break and continue statements out of a loop.
+type loop struct {
+	enclosing  *loop
+	start      int  // where continue jumps back to
+	forward    bool // whether continue jumps forward to the increment instead
+	scopeDepth int  // locals deeper than this are popped by break and continue
+	tries      int  // try regions entered before the loop
+	breaks     []int
+	continues  []int
+}
+
+// tryRegion is a try statement whose handler is active on the VM. Leaving it
+// with return, break or continue pops the handler and runs a finally block
+// inline.
+type tryRegion struct {
+	finally *syntax.Block // nil for the region of a catch clause
+	loop    *loop         // the loop the try statement is in
+}
+
+// funcCompiler holds the state of the function being compiled.
+type funcCompiler struct {
+	enclosing  *funcCompiler
+	function   *Function
+	kind       funcKind
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	loop       *loop
+	tries      []tryRegion
+	names      map[string]byte // constants of identifiers, shared by their uses
+}
+
+type compiler struct {
+	fn      *funcCompiler
+	globals *globals
+	opts    *util.Options
+	errs    []*util.Diagnostic
+}
+
+func newFuncCompiler(enclosing *funcCompiler, kind funcKind, name string) *funcCompiler {
+	fc := &funcCompiler{
+		enclosing: enclosing,
+		function:  &Function{name: name},
+		kind:      kind,
+		names:     make(map[string]byte),
+	}
+	// slot 0 holds the receiver of methods, and the callee otherwise
+	slot := local{}
+	if kind == funcMethod || kind == funcInitializer {
+		slot.name = "this"
+	}
+	fc.locals = append(fc.locals, slot)
+	return fc
+}
+
+// compile compiles a script. Every top-level statement is compiled even if
+// an earlier one failed, so all errors are reported at once.
+func (vm *VM) compile(stmts []syntax.Stmt) (*Function, error) {
+	script := newFuncCompiler(nil, funcScript, "")
+	c := &compiler{fn: script, globals: vm.globals, opts: vm.opts}
+	for _, stmt := range stmts {
+		if err := c.statement(stmt); err != nil {
+			d := util.AsDiagnostic(err)
+			c.opts.ReportDiagnostic(d)
+			c.errs = append(c.errs, d)
+			// drop the state left by the failed declaration
+			c.fn = script
+			script.locals, script.scopeDepth = script.locals[:1], 0
+			script.loop, script.tries = nil, nil
+		}
+	}
+	if len(c.errs) > 0 {
+		return nil, util.Diagnostics(c.errs)
+	}
+	c.emit(syntax.Token{}, byte(OpNil), byte(OpReturn))
+	return script.function, nil
+}
+
+func (c *compiler) statement(stmt syntax.Stmt) error {
+	if c.opts.MaxSteps > 0 {
+		c.emitOp(OpStep, syntax.Token{})
+	}
+	return stmt.Accept(c)
+}
+
+func (c *compiler) statements(stmts []syntax.Stmt) error {
+	for _, stmt := range stmts {
+		if err := c.statement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) expression(expr syntax.Expr) error {
+	return expr.Accept(c).Err
+}
+
+func (c *compiler) chunk() *Chunk {
+	return &c.fn.function.chunk
+}
+
+func (c *compiler) emit(token syntax.Token, bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, token)
+	}
+}
+
+func (c *compiler) emitOp(op OpCode, token syntax.Token) {
+	c.chunk().write(byte(op), token)
+}
+
+func (c *compiler) emitShort(op OpCode, operand int, token syntax.Token) {
+	c.emit(token, byte(op), byte(operand>>8), byte(operand))
+}
+
+// emitJump emits a jump with a placeholder offset and returns the position
+// of the offset for patchJump.
+func (c *compiler) emitJump(op OpCode, token syntax.Token) int {
+	c.emitShort(op, 0xffff, token)
+	return len(c.chunk().code) - 2
+}
+
+// patchJump makes the jump at offset land on the next instruction.
+func (c *compiler) patchJump(offset int, token syntax.Token) error {
+	jump := len(c.chunk().code) - offset - 2
+	if jump > maxJump {
+		return syntax.ErrorAt(token, util.CodeLimit, "Too much code to jump over.")
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+	return nil
+}
+
+// emitLoop emits the jump back to start of the loop statement at token. An
+// overlong jump is reported at the closing brace of body, like clox does.
+func (c *compiler) emitLoop(start int, token syntax.Token, body syntax.Stmt) error {
+	jump := len(c.chunk().code) - start + 3
+	if jump > maxJump {
+		if block, ok := body.(*syntax.Block); ok {
+			token = block.Closing
+		}
+		return syntax.ErrorAt(token, util.CodeLimit, "Loop body too large.")
+	}
+	c.emitShort(OpLoop, jump, token)
+	return nil
+}
+
+func (c *compiler) makeConstant(value Value, token syntax.Token) (byte, error) {
+	if len(c.chunk().constants) >= maxConstants {
+		return 0, syntax.ErrorAt(token, util.CodeLimit, "Too many constants in one chunk.")
+	}
+	return byte(c.chunk().addConstant(value)), nil
+}
+
+// identifierConstant returns the constant holding the name of token. Names
+// are shared, literals never are.
+func (c *compiler) identifierConstant(token syntax.Token) (byte, error) {
+	if idx, ok := c.fn.names[token.Lexeme]; ok {
+		return idx, nil
+	}
+	idx, err := c.makeConstant(stringValue(token.Lexeme), token)
+	if err != nil {
+		return 0, err
+	}
+	c.fn.names[token.Lexeme] = idx
+	return idx, nil
+}
+
+func (c *compiler) emitConstant(value Value, token syntax.Token) error {
+	idx, err := c.makeConstant(value, token)
+	if err != nil {
+		return err
+	}
+	c.emit(token, byte(OpConstant), idx)
+	return nil
+}
+
+func (c *compiler) beginScope() {
+	c.fn.scopeDepth++
+}
+
+func (c *compiler) endScope(token syntax.Token) {
+	c.fn.scopeDepth--
+	c.popLocals(c.fn.scopeDepth, token)
+	for len(c.fn.locals) > 0 && c.fn.locals[len(c.fn.locals)-1].depth > c.fn.scopeDepth {
+		c.fn.locals = c.fn.locals[:len(c.fn.locals)-1]
+	}
+}
+
+// popLocals emits the code discarding the locals deeper than depth, closing
+// the captured ones. The compiler still considers them declared.
+func (c *compiler) popLocals(depth int, token syntax.Token) {
+	for idx := len(c.fn.locals) - 1; idx >= 0 && c.fn.locals[idx].depth > depth; idx-- {
+		if c.fn.locals[idx].captured {
+			c.emitOp(OpCloseUpvalue, token)
+		} else {
+			c.emitOp(OpPop, token)
+		}
+	}
+}
+
+func (c *compiler) addLocal(token syntax.Token, name string) error {
+	if len(c.fn.locals) >= maxLocals {
+		return syntax.ErrorAt(token, util.CodeLimit, "Too many local variables in function.")
+	}
+	c.fn.locals = append(c.fn.locals, local{name: name, depth: c.fn.scopeDepth})
+	return nil
+}
+
+// declare makes the value on top of the stack the variable name: a local
+// in a scope, a global at the top level.
+func (c *compiler) declare(name syntax.Token) error {
+	if c.fn.scopeDepth > 0 {
+		return c.addLocal(name, name.Lexeme)
+	}
+	slot, err := c.globalSlot(name)
+	if err != nil {
+		return err
+	}
+	c.emitShort(OpDefineGlobal, slot, name)
+	return nil
+}
+
+func (c *compiler) globalSlot(name syntax.Token) (int, error) {
+	slot := c.globals.slot(name.Lexeme)
+	if slot >= maxGlobals {
+		return 0, syntax.ErrorAt(name, util.CodeLimit, "Too many global variables.")
+	}
+	return slot, nil
+}
+
+func resolveLocal(fc *funcCompiler, name string) int {
+	for idx := len(fc.locals) - 1; idx >= 0; idx-- {
+		if fc.locals[idx].name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue finds name in the functions enclosing fc, capturing it in
+// every function in between.
+func resolveUpvalue(fc *funcCompiler, name syntax.Token) (int, error) {
+	if fc.enclosing == nil {
+		return -1, nil
+	}
+	if idx := resolveLocal(fc.enclosing, name.Lexeme); idx >= 0 {
+		fc.enclosing.locals[idx].captured = true
+		return addUpvalue(fc, byte(idx), true, name)
+	}
+	idx, err := resolveUpvalue(fc.enclosing, name)
+	if idx < 0 || err != nil {
+		return idx, err
+	}
+	return addUpvalue(fc, byte(idx), false, name)
+}
+
+func addUpvalue(fc *funcCompiler, index byte, isLocal bool, name syntax.Token) (int, error) {
+	for idx, upvalue := range fc.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return idx, nil
+		}
+	}
+	if len(fc.upvalues) >= maxUpvalues {
+		return 0, syntax.ErrorAt(name, util.CodeLimit, "Too many closure variables in function.")
+	}
+	fc.upvalues = append(fc.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(fc.upvalues) - 1, nil
+}
+
+// variable emits the code reading name, or assigning the value on top of the
+// stack to it.
+func (c *compiler) variable(name syntax.Token, assign bool) error {
+	if slot := resolveLocal(c.fn, name.Lexeme); slot >= 0 {
+		if assign {
+			c.emit(name, byte(OpSetLocal), byte(slot))
+		} else {
+			c.emit(name, byte(OpGetLocal), byte(slot))
+		}
+		return nil
+	}
+	idx, err := resolveUpvalue(c.fn, name)
+	if err != nil {
+		return err
+	}
+	if idx >= 0 {
+		if assign {
+			c.emit(name, byte(OpSetUpvalue), byte(idx))
+		} else {
+			c.emit(name, byte(OpGetUpvalue), byte(idx))
+		}
+		return nil
+	}
+	slot, err := c.globalSlot(name)
+	if err != nil {
+		return err
+	}
+	if assign {
+		c.emitShort(OpSetGlobal, slot, name)
+	} else {
+		c.emitShort(OpGetGlobal, slot, name)
+	}
+	return nil
+}
+
+// function compiles decl into a function constant and emits the closure
+// creating it.
+func (c *compiler) function(decl *syntax.Function, kind funcKind) error {
+	fc := newFuncCompiler(c.fn, kind, decl.Name.Lexeme)
+	fc.function.arity = len(decl.Params)
+	c.fn = fc
+	c.beginScope()
+	for _, param := range decl.Params {
+		if err := c.addLocal(param, param.Lexeme); err != nil {
+			return err
+		}
+	}
+	if err := c.statements(decl.Body); err != nil {
+		return err
+	}
+	c.emitReturn(decl.Name)
+	c.fn = fc.enclosing
+	fc.function.upvalues = len(fc.upvalues)
+
+	idx, err := c.makeConstant(objectValue(fc.function), decl.Name)
+	if err != nil {
+		return err
+	}
+	c.emit(decl.Name, byte(OpClosure), idx)
+	for _, upvalue := range fc.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emit(decl.Name, isLocal, upvalue.index)
+	}
+	return nil
+}
+
+// emitReturn emits the implicit return at the end of a function: the
+// instance for initializers, nil otherwise.
+func (c *compiler) emitReturn(token syntax.Token) {
+	if c.fn.kind == funcInitializer {
+		c.emit(token, byte(OpGetLocal), 0)
+	} else {
+		c.emitOp(OpNil, token)
+	}
+	c.emitOp(OpReturn, token)
+}
+
+// exitTries emits the code leaving the try regions entered after the first
+// depth ones: popping their handlers and running their finally blocks.
+func (c *compiler) exitTries(depth int) error {
+	tries, enclosingLoop := c.fn.tries, c.fn.loop
+	defer func() { c.fn.tries, c.fn.loop = tries, enclosingLoop }()
+	for idx := len(tries) - 1; idx >= depth; idx-- {
+		c.emitOp(OpPopTry, syntax.Token{})
+		if tries[idx].finally == nil {
+			continue
+		}
+		// a break in the finally block leaves the loop around the try
+		// statement, not the one the jump started in
+		c.fn.tries, c.fn.loop = tries[:idx], tries[idx].loop
+		if err := c.statement(tries[idx].finally); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) VisitBlockStmt(stmt *syntax.Block) error {
+	c.beginScope()
+	if err := c.statements(stmt.Statements); err != nil {
+		return err
+	}
+	c.endScope(stmt.Brace)
+	return nil
+}
+
+func (c *compiler) VisitExpressionStmt(stmt *syntax.Expression) error {
+	if err := c.expression(stmt.Expression); err != nil {
+		return err
+	}
+	c.emitOp(OpPop, syntax.Token{})
+	return nil
+}
+
+func (c *compiler) VisitPrintStmt(stmt *syntax.Print) error {
+	if err := c.expression(stmt.Expression); err != nil {
+		return err
+	}
+	c.emitOp(OpPrint, syntax.Token{})
+	return nil
+}
+
+func (c *compiler) VisitVarStmt(stmt *syntax.Var) error {
+	if stmt.Initializer != nil {
+		if err := c.expression(stmt.Initializer); err != nil {
+			return err
+		}
+	} else {
+		c.emitOp(OpNil, stmt.Name)
+	}
+	return c.declare(stmt.Name)
+}
+
+func (c *compiler) VisitFunctionStmt(stmt *syntax.Function) error {
+	if c.fn.scopeDepth > 0 {
+		// declared first, so the function can call itself
+		if err := c.addLocal(stmt.Name, stmt.Name.Lexeme); err != nil {
+			return err
+		}
+		return c.function(stmt, funcFunction)
+	}
+	if err := c.function(stmt, funcFunction); err != nil {
+		return err
+	}
+	return c.declare(stmt.Name)
+}
+
+func (c *compiler) VisitIfStmt(stmt *syntax.If) error {
+	if err := c.expression(stmt.Condition); err != nil {
+		return err
+	}
+	thenJump := c.emitJump(OpJumpIfFalse, syntax.Token{})
+	c.emitOp(OpPop, syntax.Token{})
+	if err := c.statement(stmt.Thenbranch); err != nil {
+		return err
+	}
+	elseJump := c.emitJump(OpJump, syntax.Token{})
+	if err := c.patchJump(thenJump, syntax.Token{}); err != nil {
+		return err
+	}
+	c.emitOp(OpPop, syntax.Token{})
+	if stmt.Elsebranch != nil {
+		if err := c.statement(stmt.Elsebranch); err != nil {
+			return err
+		}
+	}
+	return c.patchJump(elseJump, syntax.Token{})
+}
+
+func (c *compiler) beginLoop(start int, forward bool) *loop {
+	c.fn.loop = &loop{
+		enclosing:  c.fn.loop,
+		start:      start,
+		forward:    forward,
+		scopeDepth: c.fn.scopeDepth,
+		tries:      len(c.fn.tries),
+	}
+	return c.fn.loop
+}
+
+// endLoop makes the breaks of the innermost loop land on the next
+// instruction.
+func (c *compiler) endLoop(keyword syntax.Token) error {
+	l := c.fn.loop
+	c.fn.loop = l.enclosing
+	for _, jump := range l.breaks {
+		if err := c.patchJump(jump, keyword); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) VisitWhileStmt(stmt *syntax.While) error {
+	start := len(c.chunk().code)
+	if err := c.expression(stmt.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emitJump(OpJumpIfFalse, stmt.Keyword)
+	c.emitOp(OpPop, stmt.Keyword)
+	c.beginLoop(start, false)
+	if err := c.statement(stmt.Body); err != nil {
+		return err
+	}
+	if err := c.emitLoop(start, stmt.Keyword, stmt.Body); err != nil {
+		return err
+	}
+	if err := c.patchJump(exitJump, stmt.Keyword); err != nil {
+		return err
+	}
+	c.emitOp(OpPop, stmt.Keyword)
+	return c.endLoop(stmt.Keyword)
+}
+
+func (c *compiler) VisitForDesugaredWhileStmt(stmt *syntax.ForDesugaredWhile) error {
+	start := len(c.chunk().code)
+	if err := c.expression(stmt.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emitJump(OpJumpIfFalse, stmt.Keyword)
+	c.emitOp(OpPop, stmt.Keyword)
+	l := c.beginLoop(start, true)
+	if err := c.statement(stmt.Body); err != nil {
+		return err
+	}
+	for _, jump := range l.continues {
+		if err := c.patchJump(jump, stmt.Keyword); err != nil {
+			return err
+		}
+	}
+	if err := c.expression(stmt.Increment); err != nil {
+		return err
+	}
+	c.emitOp(OpPop, stmt.Keyword)
+	if err := c.emitLoop(start, stmt.Keyword, stmt.Body); err != nil {
+		return err
+	}
+	if err := c.patchJump(exitJump, stmt.Keyword); err != nil {
+		return err
+	}
+	c.emitOp(OpPop, stmt.Keyword)
+	return c.endLoop(stmt.Keyword)
+}
+
+// VisitForInStmt keeps the iterator in a hidden local, and binds the loop
+// variable in a scope of its own per iteration, so closures capture the
+// element of their iteration.
+func (c *compiler) VisitForInStmt(stmt *syntax.ForIn) error {
+	c.beginScope()
+	if err := c.expression(stmt.Iterable); err != nil {
+		return err
+	}
+	c.emitOp(OpIterate, stmt.Keyword)
+	if err := c.addLocal(stmt.Keyword, ""); err != nil {
+		return err
+	}
+	iterator := len(c.fn.locals) - 1
+	start := len(c.chunk().code)
+	c.emit(stmt.Keyword, byte(OpForNext), byte(iterator), 0xff, 0xff)
+	exitJump := len(c.chunk().code) - 2
+	c.beginLoop(start, false)
+	c.beginScope()
+	if err := c.addLocal(stmt.Name, stmt.Name.Lexeme); err != nil {
+		return err
+	}
+	if err := c.statement(stmt.Body); err != nil {
+		return err
+	}
+	c.endScope(stmt.Keyword)
+	if err := c.emitLoop(start, stmt.Keyword, stmt.Body); err != nil {
+		return err
+	}
+	if err := c.patchJump(exitJump, stmt.Keyword); err != nil {
+		return err
+	}
+	if err := c.endLoop(stmt.Keyword); err != nil {
+		return err
+	}
+	c.endScope(stmt.Keyword)
+	return nil
+}
+
+func (c *compiler) VisitBreakStmt(stmt *syntax.Break) error {
+	l := c.fn.loop
+	if err := c.exitTries(l.tries); err != nil {
+		return err
+	}
+	c.popLocals(l.scopeDepth, stmt.Keyword)
+	l.breaks = append(l.breaks, c.emitJump(OpJump, stmt.Keyword))
+	return nil
+}
+
+func (c *compiler) VisitContinueStmt(stmt *syntax.Continue) error {
+	l := c.fn.loop
+	if err := c.exitTries(l.tries); err != nil {
+		return err
+	}
+	c.popLocals(l.scopeDepth, stmt.Keyword)
+	if l.forward {
+		l.continues = append(l.continues, c.emitJump(OpJump, stmt.Keyword))
+		return nil
+	}
+	return c.emitLoop(l.start, stmt.Keyword, nil)
+}
+
+func (c *compiler) VisitReturnStmt(stmt *syntax.Return) error {
+	if stmt.Value != nil {
+		if err := c.expression(stmt.Value); err != nil {
+			return err
+		}
+	} else if c.fn.kind == funcInitializer {
+		c.emit(stmt.Keyword, byte(OpGetLocal), 0)
+	} else {
+		c.emitOp(OpNil, stmt.Keyword)
+	}
+	if len(c.fn.tries) > 0 {
+		// the value stays on the stack while finally blocks run
+		if err := c.addLocal(stmt.Keyword, ""); err != nil {
+			return err
+		}
+		if err := c.exitTries(0); err != nil {
+			return err
+		}
+		c.fn.locals = c.fn.locals[:len(c.fn.locals)-1]
+	}
+	c.emitOp(OpReturn, stmt.Keyword)
+	return nil
+}
+
+func (c *compiler) VisitClassStmt(stmt *syntax.Class) error {
+	name, err := c.identifierConstant(stmt.Name)
+	if err != nil {
+		return err
+	}
+	if c.fn.scopeDepth > 0 {
+		if err := c.addLocal(stmt.Name, stmt.Name.Lexeme); err != nil {
+			return err
+		}
+		c.emit(stmt.Name, byte(OpClass), name)
+	} else {
+		c.emit(stmt.Name, byte(OpClass), name)
+		if err := c.declare(stmt.Name); err != nil {
+			return err
+		}
+	}
+	if stmt.Superclass != nil {
+		if err := c.variable(stmt.Superclass.Name, false); err != nil {
+			return err
+		}
+		// methods capture the superclass as the local "super"
+		c.beginScope()
+		if err := c.addLocal(stmt.Superclass.Name, "super"); err != nil {
+			return err
+		}
+		if err := c.variable(stmt.Name, false); err != nil {
+			return err
+		}
+		c.emitOp(OpInherit, stmt.Superclass.Name)
+	}
+	if err := c.variable(stmt.Name, false); err != nil {
+		return err
+	}
+	for _, method := range stmt.Methods {
+		kind := funcMethod
+		if method.Name.Lexeme == "init" {
+			kind = funcInitializer
+		}
+		if err := c.function(method, kind); err != nil {
+			return err
+		}
+		idx, err := c.identifierConstant(method.Name)
+		if err != nil {
+			return err
+		}
+		c.emit(method.Name, byte(OpMethod), idx)
+	}
+	c.emitOp(OpPop, stmt.Name)
+	if stmt.Superclass != nil {
+		c.endScope(stmt.Name)
+	}
+	return nil
+}
+
+func (c *compiler) VisitThrowStmt(stmt *syntax.Throw) error {
+	if err := c.expression(stmt.Value); err != nil {
+		return err
+	}
+	c.emitOp(OpThrow, stmt.Keyword)
+	return nil
+}
+
+// VisitTryStmt protects the body with a catch handler inside a finally
+// handler. When the VM runs a handler it has restored the stack of the try
+// statement and pushed the caught value, or for a finally handler the error
+// to throw again once the finally block has run.
+func (c *compiler) VisitTryStmt(stmt *syntax.Try) error {
+	var finallyJump int
+	if stmt.Finally != nil {
+		finallyJump = c.emitJump(OpTryFinally, stmt.Keyword)
+		c.fn.tries = append(c.fn.tries, tryRegion{finally: stmt.Finally, loop: c.fn.loop})
+	}
+	if stmt.Handler != nil {
+		catchJump := c.emitJump(OpTryCatch, stmt.Keyword)
+		c.fn.tries = append(c.fn.tries, tryRegion{loop: c.fn.loop})
+		if err := c.statement(stmt.Body); err != nil {
+			return err
+		}
+		c.fn.tries = c.fn.tries[:len(c.fn.tries)-1]
+		c.emitOp(OpPopTry, stmt.Keyword)
+		skipJump := c.emitJump(OpJump, stmt.Keyword)
+		if err := c.patchJump(catchJump, stmt.Keyword); err != nil {
+			return err
+		}
+		c.beginScope()
+		if err := c.addLocal(stmt.Name, stmt.Name.Lexeme); err != nil {
+			return err
+		}
+		if err := c.statement(stmt.Handler); err != nil {
+			return err
+		}
+		c.endScope(stmt.Name)
+		if err := c.patchJump(skipJump, stmt.Keyword); err != nil {
+			return err
+		}
+	} else if err := c.statement(stmt.Body); err != nil {
+		return err
+	}
+	if stmt.Finally == nil {
+		return nil
+	}
+
+	c.fn.tries = c.fn.tries[:len(c.fn.tries)-1]
+	c.emitOp(OpPopTry, stmt.Keyword)
+	if err := c.statement(stmt.Finally); err != nil {
+		return err
+	}
+	endJump := c.emitJump(OpJump, stmt.Keyword)
+	if err := c.patchJump(finallyJump, stmt.Keyword); err != nil {
+		return err
+	}
+	c.beginScope()
+	if err := c.addLocal(stmt.Keyword, ""); err != nil {
+		return err
+	}
+	if err := c.statement(stmt.Finally); err != nil {
+		return err
+	}
+	// the rethrow consumes the error, nothing is left to pop
+	c.emitOp(OpRethrow, stmt.Keyword)
+	c.fn.scopeDepth--
+	c.fn.locals = c.fn.locals[:len(c.fn.locals)-1]
+	return c.patchJump(endJump, stmt.Keyword)
+}
+
+func (c *compiler) VisitAssignExpr(expr *syntax.Assign) syntax.Result {
+	if err := c.expression(expr.Value); err != nil {
+		return syntax.Result{Err: err}
+	}
+	return syntax.Result{Err: c.variable(expr.Name, true)}
+}
+
+func (c *compiler) VisitLogicalExpr(expr *syntax.Logical) syntax.Result {
+	if err := c.expression(expr.Left); err != nil {
+		return syntax.Result{Err: err}
+	}
+	var endJump int
+	if expr.Operator.TokenType == syntax.TOKEN_OR {
+		elseJump := c.emitJump(OpJumpIfFalse, expr.Operator)
+		endJump = c.emitJump(OpJump, expr.Operator)
+		if err := c.patchJump(elseJump, expr.Operator); err != nil {
+			return syntax.Result{Err: err}
+		}
+	} else {
+		endJump = c.emitJump(OpJumpIfFalse, expr.Operator)
+	}
+	c.emitOp(OpPop, expr.Operator)
+	if err := c.expression(expr.Right); err != nil {
+		return syntax.Result{Err: err}
+	}
+	return syntax.Result{Err: c.patchJump(endJump, expr.Operator)}
+}
+
+var binaryOps = map[syntax.TokenType]OpCode{
+	syntax.TOKEN_PLUS:          OpAdd,
+	syntax.TOKEN_MINUS:         OpSubtract,
+	syntax.TOKEN_STAR:          OpMultiply,
+	syntax.TOKEN_SLASH:         OpDivide,
+	syntax.TOKEN_PERCENT:       OpModulo,
+	syntax.TOKEN_GREATER:       OpGreater,
+	syntax.TOKEN_GREATER_EQUAL: OpGreaterEqual,
+	syntax.TOKEN_LESS:          OpLess,
+	syntax.TOKEN_LESS_EQUAL:    OpLessEqual,
+	syntax.TOKEN_EQUAL_EQUAL:   OpEqual,
+	syntax.TOKEN_BANG_EQUAL:    OpNotEqual,
+}
+
+func (c *compiler) VisitBinaryExpr(expr *syntax.Binary) syntax.Result {
+	if err := c.expression(expr.Left); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.expression(expr.Right); err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emitOp(binaryOps[expr.Operator.TokenType], expr.Operator)
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitUnaryExpr(expr *syntax.Unary) syntax.Result {
+	if err := c.expression(expr.Right); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if expr.Operator.TokenType == syntax.TOKEN_MINUS {
+		c.emitOp(OpNegate, expr.Operator)
+	} else {
+		c.emitOp(OpNot, expr.Operator)
+	}
+	return syntax.Result{}
+}
+
+func (c *compiler) arguments(args []syntax.Expr) error {
+	for _, arg := range args {
+		if err := c.expression(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VisitCallExpr calls methods directly with OpInvoke and OpSuperInvoke,
+// without creating a bound method first.
+func (c *compiler) VisitCallExpr(expr *syntax.Call) syntax.Result {
+	argc := byte(len(expr.Arguments))
+	switch callee := expr.Callee.(type) {
+	case *syntax.Get:
+		if err := c.expression(callee.Object); err != nil {
+			return syntax.Result{Err: err}
+		}
+		name, err := c.identifierConstant(callee.Name)
+		if err != nil {
+			return syntax.Result{Err: err}
+		}
+		if err := c.arguments(expr.Arguments); err != nil {
+			return syntax.Result{Err: err}
+		}
+		c.emit(callee.Name, byte(OpInvoke), name)
+		c.emit(expr.Paren, argc)
+	case *syntax.Super:
+		name, err := c.identifierConstant(callee.Method)
+		if err != nil {
+			return syntax.Result{Err: err}
+		}
+		if err := c.variable(thisToken(callee.Keyword), false); err != nil {
+			return syntax.Result{Err: err}
+		}
+		if err := c.arguments(expr.Arguments); err != nil {
+			return syntax.Result{Err: err}
+		}
+		if err := c.variable(callee.Keyword, false); err != nil {
+			return syntax.Result{Err: err}
+		}
+		c.emit(callee.Method, byte(OpSuperInvoke), name)
+		c.emit(expr.Paren, argc)
+	default:
+		if err := c.expression(expr.Callee); err != nil {
+			return syntax.Result{Err: err}
+		}
+		if err := c.arguments(expr.Arguments); err != nil {
+			return syntax.Result{Err: err}
+		}
+		c.emit(expr.Paren, byte(OpCall), argc)
+	}
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitGetExpr(expr *syntax.Get) syntax.Result {
+	if err := c.expression(expr.Object); err != nil {
+		return syntax.Result{Err: err}
+	}
+	name, err := c.identifierConstant(expr.Name)
+	if err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emit(expr.Name, byte(OpGetProperty), name)
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitSetExpr(expr *syntax.Set) syntax.Result {
+	if err := c.expression(expr.Object); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.expression(expr.Value); err != nil {
+		return syntax.Result{Err: err}
+	}
+	name, err := c.identifierConstant(expr.Name)
+	if err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emit(expr.Name, byte(OpSetProperty), name)
+	return syntax.Result{}
+}
+
+// thisToken returns a "this" token at the position of keyword.
+func thisToken(keyword syntax.Token) syntax.Token {
+	return syntax.NewToken(syntax.TOKEN_THIS, "this", nil, keyword.Line, keyword.Pos)
+}
+
+func (c *compiler) VisitSuperExpr(expr *syntax.Super) syntax.Result {
+	name, err := c.identifierConstant(expr.Method)
+	if err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.variable(thisToken(expr.Keyword), false); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.variable(expr.Keyword, false); err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emit(expr.Method, byte(OpGetSuper), name)
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitThisExpr(expr *syntax.This) syntax.Result {
+	return syntax.Result{Err: c.variable(expr.Keyword, false)}
+}
+
+func (c *compiler) VisitGroupingExpr(expr *syntax.Grouping) syntax.Result {
+	return syntax.Result{Err: c.expression(expr.Expression)}
+}
+
+func (c *compiler) VisitLiteralExpr(expr *syntax.Literal) syntax.Result {
+	switch value := expr.Value.(type) {
+	case nil:
+		c.emitOp(OpNil, expr.Token)
+	case bool:
+		if value {
+			c.emitOp(OpTrue, expr.Token)
+		} else {
+			c.emitOp(OpFalse, expr.Token)
+		}
+	case float64:
+		return syntax.Result{Err: c.emitConstant(numberValue(value), expr.Token)}
+	case string:
+		return syntax.Result{Err: c.emitConstant(stringValue(value), expr.Token)}
+	}
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitVariableExpr(expr *syntax.Variable) syntax.Result {
+	return syntax.Result{Err: c.variable(expr.Name, false)}
+}
+
+func (c *compiler) VisitAnonymousFunctionExpr(expr *syntax.AnonymousFunction) syntax.Result {
+	return syntax.Result{Err: c.function(expr.Decl, funcFunction)}
+}
+
+// elements compiles the elements of a literal and emits op with their
+// count.
+func (c *compiler) elements(op OpCode, token syntax.Token, count int, exprs ...[]syntax.Expr) error {
+	if count > maxElements {
+		return syntax.ErrorAt(token, util.CodeLimit, "Too many elements in literal.")
+	}
+	for idx := range exprs[0] {
+		for _, list := range exprs {
+			if err := c.expression(list[idx]); err != nil {
+				return err
+			}
+		}
+	}
+	c.emitShort(op, count, token)
+	return nil
+}
+
+func (c *compiler) VisitListExpr(expr *syntax.List) syntax.Result {
+	return syntax.Result{Err: c.elements(OpList, expr.Bracket, len(expr.Elements), expr.Elements)}
+}
+
+func (c *compiler) VisitMapExpr(expr *syntax.Map) syntax.Result {
+	return syntax.Result{Err: c.elements(OpMap, expr.Brace, len(expr.Keys), expr.Keys, expr.Values)}
+}
+
+func (c *compiler) VisitInterpolationExpr(expr *syntax.Interpolation) syntax.Result {
+	return syntax.Result{Err: c.elements(OpInterpolate, expr.Quote, len(expr.Parts), expr.Parts)}
+}
+
+func (c *compiler) VisitIndexExpr(expr *syntax.Index) syntax.Result {
+	if err := c.expression(expr.Object); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.expression(expr.Index); err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emitOp(OpIndex, expr.Bracket)
+	return syntax.Result{}
+}
+
+func (c *compiler) VisitIndexSetExpr(expr *syntax.IndexSet) syntax.Result {
+	if err := c.expression(expr.Object); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.expression(expr.Index); err != nil {
+		return syntax.Result{Err: err}
+	}
+	if err := c.expression(expr.Value); err != nil {
+		return syntax.Result{Err: err}
+	}
+	c.emitOp(OpIndexSet, expr.Bracket)
+	return syntax.Result{}
+}
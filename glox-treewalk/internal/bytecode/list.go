@@ -0,0 +1,88 @@
+package bytecode
+
+import (
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+)
+
+type List struct {
+	elements []Value
+	printing bool // guards String against lists that contain themselves
+}
+
+func newList(elements []Value) *List {
+	return &List{elements: elements}
+}
+
+func (l *List) String() string {
+	if l.printing {
+		return "[...]"
+	}
+	l.printing = true
+	defer func() { l.printing = false }()
+	parts := make([]string, 0, len(l.elements))
+	for _, element := range l.elements {
+		parts = append(parts, element.String())
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (l *List) Len() int {
+	return len(l.elements)
+}
+
+// position checks that index is an integer between 0 and last.
+func (l *List) position(index Value, last int) (int, error) {
+	return stdlib.Position("list", index.plain(), len(l.elements), last)
+}
+
+func (l *List) index(index Value) (Value, error) {
+	idx, err := l.position(index, len(l.elements)-1)
+	if err != nil {
+		return nilValue, err
+	}
+	return l.elements[idx], nil
+}
+
+func (l *List) setIndex(index Value, value Value) error {
+	idx, err := l.position(index, len(l.elements)-1)
+	if err != nil {
+		return err
+	}
+	l.elements[idx] = value
+	return nil
+}
+
+var listMethods = map[string]method[*List]{
+	"push": {1, func(vm *VM, l *List, args []Value) (Value, error) {
+		if err := vm.charge(sizeValue); err != nil {
+			return nilValue, err
+		}
+		l.elements = append(l.elements, args[0])
+		return nilValue, nil
+	}},
+	"pop": {0, func(vm *VM, l *List, args []Value) (last Value, err error) {
+		l.elements, last, err = stdlib.Pop(l.elements)
+		return last, err
+	}},
+	"insert": {2, func(vm *VM, l *List, args []Value) (Value, error) {
+		if err := vm.charge(sizeValue); err != nil {
+			return nilValue, err
+		}
+		elements, err := stdlib.Insert(l.elements, args[0].plain(), args[1])
+		l.elements = elements
+		return nilValue, err
+	}},
+	"remove": {1, func(vm *VM, l *List, args []Value) (removed Value, err error) {
+		l.elements, removed, err = stdlib.Remove(l.elements, args[0].plain())
+		return removed, err
+	}},
+	"slice": {2, func(vm *VM, l *List, args []Value) (Value, error) {
+		elements, err := stdlib.Slice((*quota)(vm), l.elements, args[0].plain(), args[1].plain())
+		if err != nil {
+			return nilValue, err
+		}
+		return objectValue(newList(elements)), nil
+	}},
+}
@@ -0,0 +1,80 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+)
+
+// Map is a hash map keyed by strings, numbers, bools and nil. It remembers
+// the order in which keys were first inserted.
+type Map struct {
+	entries  stdlib.OrderedMap[Value, Value]
+	printing bool // guards String against maps that contain themselves
+}
+
+func newMap() *Map {
+	return &Map{}
+}
+
+func (m *Map) Len() int {
+	return m.entries.Len()
+}
+
+func (m *Map) get(key Value) (Value, bool) {
+	return m.entries.Get(key)
+}
+
+// set adds or replaces the value of key.
+func (m *Map) set(key Value, value Value) error {
+	if key.kind == kindObject {
+		if _, ok := key.obj.(string); !ok {
+			return fmt.Errorf("map keys must be strings, numbers, bools or nil, got %v", key)
+		}
+	}
+	m.entries.Set(key, value)
+	return nil
+}
+
+// remove deletes key and returns its value, or nil if it was not present.
+func (m *Map) remove(key Value) Value {
+	value, _ := m.entries.Remove(key)
+	return value
+}
+
+func (m *Map) String() string {
+	if m.printing {
+		return "{...}"
+	}
+	m.printing = true
+	defer func() { m.printing = false }()
+	parts := make([]string, 0, m.entries.Len())
+	for _, key := range m.entries.Keys() {
+		value, _ := m.entries.Get(key)
+		parts = append(parts, key.String()+": "+value.String())
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+var mapMethods = map[string]method[*Map]{
+	"keys": {0, func(vm *VM, m *Map, args []Value) (Value, error) {
+		if err := vm.charge(sizeList + sizeValue*m.entries.Len()); err != nil {
+			return nilValue, err
+		}
+		return objectValue(newList(m.entries.Keys())), nil
+	}},
+	"values": {0, func(vm *VM, m *Map, args []Value) (Value, error) {
+		if err := vm.charge(sizeList + sizeValue*m.entries.Len()); err != nil {
+			return nilValue, err
+		}
+		return objectValue(newList(m.entries.Values())), nil
+	}},
+	"has": {1, func(vm *VM, m *Map, args []Value) (Value, error) {
+		_, ok := m.get(args[0])
+		return boolValue(ok), nil
+	}},
+	"remove": {1, func(vm *VM, m *Map, args []Value) (Value, error) {
+		return m.remove(args[0]), nil
+	}},
+}
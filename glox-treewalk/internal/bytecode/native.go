@@ -0,0 +1,97 @@
+package bytecode
+
+import (
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// method is a method of a builtin type such as List, implemented in Go.
+type method[T any] struct {
+	arity int
+	fn    func(vm *VM, receiver T, args []Value) (Value, error)
+}
+
+// bindMethod looks up the method name of receiver in methods and binds it.
+func bindMethod[T any](methods map[string]method[T], receiver T, typeName string, name string) (Value, error) {
+	m, err := stdlib.Lookup(methods, typeName, name, syntax.Token{})
+	if err != nil {
+		return nilValue, err
+	}
+	return objectValue(&Native{name: name, arity: m.arity, fn: func(vm *VM, args []Value) (Value, error) {
+		return m.fn(vm, receiver, args)
+	}}), nil
+}
+
+// adaptMethods turns methods of the stdlib into methods of the VM.
+func adaptMethods[T any](methods map[string]stdlib.Method[T]) map[string]method[T] {
+	adapted := make(map[string]method[T], len(methods))
+	for name, m := range methods {
+		adapted[name] = method[T]{m.Arity, func(vm *VM, receiver T, args []Value) (Value, error) {
+			result, err := m.Fn((*quota)(vm), receiver, plainValues(args))
+			if err != nil {
+				return nilValue, err
+			}
+			return fromStdlib(result), nil
+		}}
+	}
+	return adapted
+}
+
+// errorClass is the class of the error instances created by Error() and of
+// the runtime errors caught by a catch clause.
+var errorClass = newClass("Error")
+
+func newErrorInstance(message string, line Value, stack Value) *Instance {
+	instance := newInstance(errorClass)
+	instance.fields["message"] = stringValue(message)
+	instance.fields["line"] = line
+	instance.fields["stack"] = stack
+	return instance
+}
+
+func isErrorInstance(value Value) (*Instance, bool) {
+	instance, ok := value.obj.(*Instance)
+	return instance, ok && instance.class == errorClass
+}
+
+// defineNatives defines the natives and constants of the stdlib, and the
+// natives depending on the values of the VM.
+func (vm *VM) defineNatives() {
+	for name, native := range stdlib.Natives(vm.opts.RandomSeed) {
+		vm.defineNative(name, native.Arity, func(vm *VM, args []Value) (Value, error) {
+			result, err := native.Fn(plainValues(args))
+			if err != nil {
+				return nilValue, err
+			}
+			return fromStdlib(result), nil
+		})
+	}
+	for name, value := range stdlib.Constants {
+		vm.globals.define(name, numberValue(value))
+	}
+	vm.defineNative("Error", 1, newError)
+	vm.defineNative("str", 1, str)
+	vm.defineNative("type", 1, typeOf)
+}
+
+func (vm *VM) defineNative(name string, arity int, fn NativeFn) {
+	vm.globals.define(name, objectValue(&Native{name: name, arity: arity, fn: fn}))
+}
+
+// newError implements Error(message). Line and stack are filled in when the
+// error is thrown.
+func newError(vm *VM, args []Value) (Value, error) {
+	return objectValue(newErrorInstance(stdlib.ErrorMessage(args[0].plain()), nilValue, nilValue)), nil
+}
+
+func str(vm *VM, args []Value) (Value, error) {
+	s := args[0].String()
+	if err := vm.charge(sizeString + len(s)); err != nil {
+		return nilValue, err
+	}
+	return stringValue(s), nil
+}
+
+func typeOf(vm *VM, args []Value) (Value, error) {
+	return stringValue(args[0].typeName()), nil
+}
@@ -0,0 +1,109 @@
+package bytecode
+
+// Function is a compiled function, the script itself included.
+type Function struct {
+	name     string
+	arity    int
+	upvalues int
+	chunk    Chunk
+}
+
+func (f *Function) String() string {
+	if f.name == "" {
+		return "<anonymous fn>"
+	}
+	return "<fn " + f.name + ">"
+}
+
+// Closure is a function together with the variables it captured.
+type Closure struct {
+	function *Function
+	upvalues []*Upvalue
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+// Upvalue is a captured variable. While the variable is still on the stack,
+// location points at its slot; once it goes out of scope the value moves
+// into closed.
+type Upvalue struct {
+	location *Value
+	closed   Value
+	slot     int
+	next     *Upvalue // the open upvalue of the next lower slot
+}
+
+type Class struct {
+	name    string
+	methods map[string]*Closure
+	init    *Closure // own or inherited
+}
+
+func newClass(name string) *Class {
+	return &Class{name: name, methods: make(map[string]*Closure)}
+}
+
+func (c *Class) String() string {
+	return "<class " + c.name + ">"
+}
+
+func (c *Class) arity() int {
+	if c.init != nil {
+		return c.init.function.arity
+	}
+	return 0
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]Value
+}
+
+func newInstance(class *Class) *Instance {
+	return &Instance{class: class, fields: make(map[string]Value)}
+}
+
+func (i *Instance) String() string {
+	return "<instance of " + i.class.name + ">"
+}
+
+// BoundMethod is a method looked up on an instance but not called yet.
+type BoundMethod struct {
+	receiver Value
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+type NativeFn func(vm *VM, args []Value) (Value, error)
+
+// Native is a function implemented in Go: a global such as clock, or a
+// method of a builtin type bound to its receiver.
+type Native struct {
+	name  string
+	arity int
+	fn    NativeFn
+}
+
+func (n *Native) String() string {
+	return "<native fn>"
+}
+
+// iterator is the hidden loop variable of a for-in loop. It walks a list,
+// a snapshot of elements, or an instance defining hasNext() and next().
+type iterator struct {
+	list     *List
+	elements []Value
+	idx      int
+	instance *Instance
+}
+
+// pendingError is an error a finally block interrupted, thrown again once
+// the block has run.
+type pendingError struct {
+	err error
+}
@@ -0,0 +1,10 @@
+package bytecode
+
+import "github.com/littlekuo/glox-treewalk/internal/stdlib"
+
+func stringValue(s string) Value {
+	return objectValue(s)
+}
+
+// stringMethods are the methods of strings from the stdlib.
+var stringMethods = adaptMethods(stdlib.StringMethods)
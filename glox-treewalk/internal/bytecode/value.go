@@ -0,0 +1,160 @@
+package bytecode
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type valueKind uint8
+
+const (
+	kindNil valueKind = iota
+	kindBool
+	kindNumber
+	kindObject
+)
+
+// Value is a Lox value. Nil, bools and numbers are stored unboxed, so
+// arithmetic doesn't allocate; strings and the other objects are kept in
+// obj. The zero Value is nil.
+type Value struct {
+	kind valueKind
+	num  float64 // the number, or 1 for true
+	obj  any     // string, *Closure, *Class, *Instance, *List, ...
+}
+
+var nilValue = Value{}
+
+func numberValue(num float64) Value {
+	return Value{kind: kindNumber, num: num}
+}
+
+func boolValue(b bool) Value {
+	if b {
+		return Value{kind: kindBool, num: 1}
+	}
+	return Value{kind: kindBool}
+}
+
+func objectValue(obj any) Value {
+	return Value{kind: kindObject, obj: obj}
+}
+
+func (v Value) isNumber() bool {
+	return v.kind == kindNumber
+}
+
+func (v Value) asString() (string, bool) {
+	if v.kind != kindObject {
+		return "", false
+	}
+	s, ok := v.obj.(string)
+	return s, ok
+}
+
+// plain returns the plain Go value the stdlib works on: nil, a bool, a
+// float64, or the object itself.
+func (v Value) plain() any {
+	switch v.kind {
+	case kindNil:
+		return nil
+	case kindBool:
+		return v.num != 0
+	case kindNumber:
+		return v.num
+	}
+	return v.obj
+}
+
+func plainValues(values []Value) []any {
+	plain := make([]any, len(values))
+	for idx, value := range values {
+		plain[idx] = value.plain()
+	}
+	return plain
+}
+
+// fromStdlib converts a result of the stdlib to a Value.
+func fromStdlib(result any) Value {
+	switch result := result.(type) {
+	case nil:
+		return nilValue
+	case bool:
+		return boolValue(result)
+	case float64:
+		return numberValue(result)
+	case []string:
+		elements := make([]Value, len(result))
+		for idx, s := range result {
+			elements[idx] = stringValue(s)
+		}
+		return objectValue(newList(elements))
+	}
+	return objectValue(result)
+}
+
+func (v Value) isFalsey() bool {
+	return v.kind == kindNil || (v.kind == kindBool && v.num == 0)
+}
+
+// valuesEqual compares nil, bools, numbers and strings by value, and every
+// other value by identity, like the tree-walker does.
+func valuesEqual(a, b Value) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case kindNil:
+		return true
+	case kindBool, kindNumber:
+		return a.num == b.num
+	}
+	return a.obj == b.obj
+}
+
+// String returns the text print shows for the value, the same as the
+// tree-walker's.
+func (v Value) String() string {
+	switch v.kind {
+	case kindNil:
+		return "<nil>"
+	case kindBool:
+		return strconv.FormatBool(v.num != 0)
+	case kindNumber:
+		return strconv.FormatFloat(v.num, 'g', -1, 64)
+	}
+	switch obj := v.obj.(type) {
+	case string:
+		return obj
+	case fmt.Stringer:
+		return obj.String()
+	}
+	return fmt.Sprintf("%v", v.obj)
+}
+
+// typeName returns the name type() gives the type of the value.
+func (v Value) typeName() string {
+	switch v.kind {
+	case kindNil:
+		return "nil"
+	case kindBool:
+		return "bool"
+	case kindNumber:
+		return "number"
+	}
+	switch v.obj.(type) {
+	case string:
+		return "string"
+	case *List:
+		return "list"
+	case *Map:
+		return "map"
+	case *Class:
+		return "class"
+	case *Instance:
+		return "instance"
+	case *Closure, *BoundMethod, *Native:
+		return "function"
+	}
+	return "unknown"
+}
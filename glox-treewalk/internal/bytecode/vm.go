@@ -0,0 +1,1011 @@
+// Package bytecode is the second backend of glox: a compiler from resolved
+// syntax trees to a compact bytecode, and a stack-based VM running it. It
+// implements the same language as the tree-walking interpreter, prints
+// values the same way and raises the same runtime errors, but keeps numbers
+// unboxed and variables in stack slots and upvalues instead of environments.
+package bytecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// scriptFrame names the top-level code in tracebacks.
+const scriptFrame = "<script>"
+
+// VM runs compiled scripts. Globals defined by one call to Interpret stay
+// visible to the next.
+type VM struct {
+	opts     *util.Options
+	globals  *globals
+	stack    []Value
+	sp       int
+	frames   []frame
+	handlers []handler
+	open     *Upvalue // open upvalues, highest slot first
+	// budgets of the current run
+	ctx       context.Context
+	deadline  time.Time
+	steps     int64 // statements executed, with a step budget
+	checks    int   // check points passed
+	allocated int64 // approximate bytes allocated
+}
+
+// frame is an active call of a closure.
+type frame struct {
+	closure *Closure
+	ip      int
+	base    int    // stack slot of the callee, or of the receiver of a method
+	class   *Class // the class called, if the frame runs its initializer
+}
+
+// name returns the name the frame is shown with in tracebacks.
+func (f *frame) name() string {
+	if f.class != nil {
+		return f.class.name
+	}
+	if f.closure.function.name == "" {
+		return "<anonymous>"
+	}
+	return f.closure.function.name
+}
+
+// handler is the catch or finally clause of a try statement being run.
+type handler struct {
+	frame int // index of the frame running the try statement
+	ip    int // start of the clause
+	sp    int // stack height at the try statement
+	catch bool
+}
+
+type global struct {
+	name    string
+	value   Value
+	defined bool
+	native  bool // set by the VM, so a script may re-define it
+}
+
+// globals numbers the global variables, so that the compiler can address
+// them by slot.
+type globals struct {
+	slots   map[string]int
+	entries []global
+}
+
+func (g *globals) slot(name string) int {
+	if idx, ok := g.slots[name]; ok {
+		return idx
+	}
+	g.entries = append(g.entries, global{name: name})
+	g.slots[name] = len(g.entries) - 1
+	return len(g.entries) - 1
+}
+
+// define sets a native global, whether it is already defined or not.
+func (g *globals) define(name string, value Value) {
+	entry := &g.entries[g.slot(name)]
+	entry.value, entry.defined, entry.native = value, true, true
+}
+
+func NewVM(opts ...util.Option) *VM {
+	vm := &VM{
+		opts:    util.NewOptions(opts...),
+		globals: &globals{slots: make(map[string]int)},
+		stack:   make([]Value, 256),
+	}
+	vm.defineNatives()
+	return vm
+}
+
+// RunFile scans, parses, resolves, compiles and runs the script at path.
+// Like lox.VM, it renders diagnostics with the offending source line to the
+// Stderr writer of the options, unless they set a reporter.
+func RunFile(path string, opts ...util.Option) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+	options := util.NewOptions(opts...)
+	opts = append(append([]util.Option{}, opts...), util.WithReporter(func(d *util.Diagnostic) {
+		d.Locate(path, source)
+		if options.Report != nil {
+			options.Report(d)
+			return
+		}
+		fmt.Fprint(options.Stderr, d.Render())
+	}))
+
+	scanner := syntax.NewScanner(source, opts...)
+	tokens := scanner.ScanTokens()
+	if errs := scanner.GetErrors(); len(errs) > 0 {
+		return util.Diagnostics(errs)
+	}
+	parser := syntax.NewParser(tokens, opts...)
+	stmts := parser.Parse()
+	if errs := parser.GetErrors(); len(errs) > 0 {
+		return util.Diagnostics(errs)
+	}
+	resolver := interpreter.NewResolver(interpreter.NewInterpreter(), opts...)
+	resolver.Resolve(stmts)
+	if errs := resolver.GetErrors(); len(errs) > 0 {
+		return util.Diagnostics(errs)
+	}
+	return NewVM(opts...).Interpret(stmts)
+}
+
+// Interpret compiles and runs resolved statements. Compile errors are
+// returned together as util.Diagnostics, a runtime error as
+// *interpreter.RuntimeError; both are reported through the options as well.
+func (vm *VM) Interpret(stmts []syntax.Stmt) error {
+	return vm.InterpretContext(context.Background(), stmts)
+}
+
+// InterpretContext works like Interpret, but stops with an error wrapping
+// interpreter.ErrCancelled once ctx is done. Like the tree-walker, it stops
+// with one wrapping interpreter.ErrBudgetExceeded or
+// interpreter.ErrMemoryQuotaExceeded once a budget of the options is spent.
+func (vm *VM) InterpretContext(ctx context.Context, stmts []syntax.Stmt) error {
+	function, err := vm.compile(stmts)
+	if err != nil {
+		return err
+	}
+	vm.begin(ctx)
+	if err := vm.poll(); err != nil {
+		vm.opts.ReportDiagnostic(util.AsDiagnostic(err))
+		return err
+	}
+	closure := &Closure{function: function}
+	vm.push(objectValue(closure))
+	vm.frames = append(vm.frames, frame{closure: closure})
+	if err := vm.run(0); err != nil {
+		vm.opts.ReportDiagnostic(util.AsDiagnostic(err))
+		return err
+	}
+	vm.sp = 0
+	return nil
+}
+
+func (vm *VM) push(value Value) {
+	if vm.sp == len(vm.stack) {
+		vm.grow()
+	}
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// grow doubles the stack, moving the open upvalues along.
+func (vm *VM) grow() {
+	stack := make([]Value, 2*len(vm.stack))
+	copy(stack, vm.stack)
+	for upvalue := vm.open; upvalue != nil; upvalue = upvalue.next {
+		upvalue.location = &stack[upvalue.slot]
+	}
+	vm.stack = stack
+}
+
+func readShort(code []byte, ip int) int {
+	return int(code[ip])<<8 | int(code[ip+1])
+}
+
+// run executes instructions until the frame at index depth returns, or an
+// error escapes it. Natives calling back into Lox code run nested loops with
+// a higher depth.
+func (vm *VM) run(depth int) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.function.chunk
+	code, constants := chunk.code, chunk.constants
+	ip := frame.ip
+	for {
+		start := ip
+		op := OpCode(code[ip])
+		ip++
+		var err error
+		switch op {
+		case OpConstant:
+			vm.push(constants[code[ip]])
+			ip++
+		case OpNil:
+			vm.push(nilValue)
+		case OpTrue:
+			vm.push(boolValue(true))
+		case OpFalse:
+			vm.push(boolValue(false))
+		case OpPop:
+			vm.sp--
+		case OpGetLocal:
+			vm.push(vm.stack[frame.base+int(code[ip])])
+			ip++
+		case OpSetLocal:
+			vm.stack[frame.base+int(code[ip])] = vm.stack[vm.sp-1]
+			ip++
+		case OpGetGlobal:
+			global := &vm.globals.entries[readShort(code, ip)]
+			ip += 2
+			if !global.defined {
+				err = undefinedVariable(global.name)
+				break
+			}
+			vm.push(global.value)
+		case OpSetGlobal:
+			global := &vm.globals.entries[readShort(code, ip)]
+			ip += 2
+			if !global.defined {
+				err = undefinedVariable(global.name)
+				break
+			}
+			global.value = vm.stack[vm.sp-1]
+		case OpDefineGlobal:
+			global := &vm.globals.entries[readShort(code, ip)]
+			ip += 2
+			if global.defined && !global.native {
+				err = fmt.Errorf("re-define variable %s", global.name)
+				break
+			}
+			global.value, global.defined, global.native = vm.pop(), true, false
+		case OpGetUpvalue:
+			vm.push(*frame.closure.upvalues[code[ip]].location)
+			ip++
+		case OpSetUpvalue:
+			*frame.closure.upvalues[code[ip]].location = vm.stack[vm.sp-1]
+			ip++
+		case OpGetProperty:
+			name := constants[code[ip]].obj.(string)
+			ip++
+			var value Value
+			if value, err = vm.property(vm.stack[vm.sp-1], name); err == nil {
+				vm.stack[vm.sp-1] = value
+			}
+		case OpSetProperty:
+			name := constants[code[ip]].obj.(string)
+			ip++
+			instance, ok := vm.stack[vm.sp-2].obj.(*Instance)
+			if !ok {
+				err = errorf(util.CodeRuntime, "can only set properties on instances")
+				break
+			}
+			value := vm.pop()
+			if _, ok := instance.fields[name]; !ok {
+				if err = vm.charge(sizeField + len(name)); err != nil {
+					break
+				}
+			}
+			instance.fields[name] = value
+			vm.stack[vm.sp-1] = value
+		case OpGetSuper:
+			name := constants[code[ip]].obj.(string)
+			ip++
+			superclass := vm.pop().obj.(*Class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				err = errorf(util.CodeUndefinedProperty, "undefined method '%s'", name)
+				break
+			}
+			vm.stack[vm.sp-1] = objectValue(&BoundMethod{receiver: vm.stack[vm.sp-1], method: method})
+		case OpEqual:
+			b := vm.pop()
+			vm.stack[vm.sp-1] = boolValue(valuesEqual(vm.stack[vm.sp-1], b))
+		case OpNotEqual:
+			b := vm.pop()
+			vm.stack[vm.sp-1] = boolValue(!valuesEqual(vm.stack[vm.sp-1], b))
+		case OpGreater, OpGreaterEqual, OpLess, OpLessEqual:
+			a, b := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			if a.kind != kindNumber || b.kind != kindNumber {
+				err = numberOperands(chunk.token(start), a, b)
+				break
+			}
+			vm.sp--
+			vm.stack[vm.sp-1] = boolValue(compare(op, a.num, b.num))
+		case OpAdd:
+			a, b := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			if a.kind == kindNumber && b.kind == kindNumber {
+				vm.sp--
+				vm.stack[vm.sp-1] = numberValue(a.num + b.num)
+				break
+			}
+			var value Value
+			if value, err = vm.add(a, b); err == nil {
+				vm.sp--
+				vm.stack[vm.sp-1] = value
+			}
+		case OpSubtract, OpMultiply, OpDivide, OpModulo:
+			a, b := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+			if a.kind != kindNumber || b.kind != kindNumber {
+				err = numberOperands(chunk.token(start), a, b)
+				break
+			}
+			var value float64
+			if value, err = arithmetic(op, a.num, b.num); err == nil {
+				vm.sp--
+				vm.stack[vm.sp-1] = numberValue(value)
+			}
+		case OpNot:
+			vm.stack[vm.sp-1] = boolValue(vm.stack[vm.sp-1].isFalsey())
+		case OpNegate:
+			if !vm.stack[vm.sp-1].isNumber() {
+				err = errorf(util.CodeOperandType, "operator %s: operand must be a number",
+					syntax.TokenTypeStr[chunk.token(start).TokenType])
+				break
+			}
+			vm.stack[vm.sp-1].num = -vm.stack[vm.sp-1].num
+		case OpPrint:
+			fmt.Fprintln(vm.opts.Stdout, vm.pop().String())
+		case OpJump:
+			ip += readShort(code, ip) + 2
+		case OpJumpIfFalse:
+			if vm.stack[vm.sp-1].isFalsey() {
+				ip += readShort(code, ip)
+			}
+			ip += 2
+		case OpLoop:
+			ip -= readShort(code, ip) - 2
+			err = vm.checkpoint()
+		case OpStep:
+			vm.steps++
+		case OpCall, OpInvoke, OpSuperInvoke:
+			if err = vm.checkpoint(); err != nil {
+				break
+			}
+			switch op {
+			case OpCall:
+				argc := int(code[ip])
+				frame.ip = ip + 1
+				err = vm.callValue(vm.stack[vm.sp-argc-1], argc)
+			case OpInvoke:
+				name, argc := constants[code[ip]].obj.(string), int(code[ip+1])
+				frame.ip = ip + 2
+				err = vm.invoke(name, argc)
+			case OpSuperInvoke:
+				name, argc := constants[code[ip]].obj.(string), int(code[ip+1])
+				frame.ip = ip + 2
+				superclass := vm.pop().obj.(*Class)
+				method, ok := superclass.methods[name]
+				if !ok {
+					err = errorf(util.CodeUndefinedProperty, "undefined method '%s'", name)
+					break
+				}
+				err = vm.call(method, argc, nil)
+			}
+			if err != nil {
+				ip = frame.ip
+				break
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+			code, constants = chunk.code, chunk.constants
+			ip = frame.ip
+		case OpClosure:
+			function := constants[code[ip]].obj.(*Function)
+			ip++
+			if err = vm.charge(sizeClosure); err != nil {
+				break
+			}
+			closure := &Closure{function: function, upvalues: make([]*Upvalue, function.upvalues)}
+			for idx := range closure.upvalues {
+				isLocal, index := code[ip], int(code[ip+1])
+				ip += 2
+				if isLocal == 1 {
+					closure.upvalues[idx] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[idx] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(objectValue(closure))
+		case OpCloseUpvalue:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case OpReturn:
+			result := vm.stack[vm.sp-1]
+			vm.closeUpvalues(frame.base)
+			vm.sp = frame.base
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.push(result)
+			if len(vm.frames) == depth {
+				return nil
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+			code, constants = chunk.code, chunk.constants
+			ip = frame.ip
+		case OpClass:
+			vm.push(objectValue(newClass(constants[code[ip]].obj.(string))))
+			ip++
+		case OpInherit:
+			superclass, ok := vm.stack[vm.sp-2].obj.(*Class)
+			if !ok {
+				err = errorf(util.CodeRuntime, "superclass [%s] must be a class", chunk.token(start).Lexeme)
+				break
+			}
+			subclass := vm.pop().obj.(*Class)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			subclass.init = superclass.init
+		case OpMethod:
+			name := constants[code[ip]].obj.(string)
+			ip++
+			method := vm.pop().obj.(*Closure)
+			class := vm.stack[vm.sp-1].obj.(*Class)
+			class.methods[name] = method
+			if name == "init" {
+				class.init = method
+			}
+		case OpList:
+			count := readShort(code, ip)
+			ip += 2
+			if err = vm.charge(sizeList + sizeValue*count); err != nil {
+				break
+			}
+			elements := make([]Value, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp -= count
+			vm.push(objectValue(newList(elements)))
+		case OpMap:
+			count := readShort(code, ip)
+			ip += 2
+			if err = vm.charge(sizeMap + sizeField*count); err != nil {
+				break
+			}
+			m := newMap()
+			for idx := vm.sp - 2*count; idx < vm.sp && err == nil; idx += 2 {
+				if err = m.set(vm.stack[idx], vm.stack[idx+1]); err != nil {
+					err = errorf(util.CodeIndex, "%s", err)
+				}
+			}
+			if err == nil {
+				vm.sp -= 2 * count
+				vm.push(objectValue(m))
+			}
+		case OpIndex:
+			var value Value
+			if value, err = index(vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err == nil {
+				vm.sp--
+				vm.stack[vm.sp-1] = value
+			}
+		case OpIndexSet:
+			value := vm.stack[vm.sp-1]
+			if err = setIndex(vm.stack[vm.sp-3], vm.stack[vm.sp-2], value); err == nil {
+				vm.sp -= 2
+				vm.stack[vm.sp-1] = value
+			}
+		case OpInterpolate:
+			count := readShort(code, ip)
+			ip += 2
+			if err = vm.charge(sizeString); err != nil {
+				break
+			}
+			var builder strings.Builder
+			for _, part := range vm.stack[vm.sp-count : vm.sp] {
+				text := part.String()
+				// charged before the result grows by it
+				if err = vm.charge(len(text)); err != nil {
+					break
+				}
+				builder.WriteString(text)
+			}
+			if err == nil {
+				vm.sp -= count
+				vm.push(stringValue(builder.String()))
+			}
+		case OpThrow:
+			err = vm.throw(vm.pop(), chunk.token(start))
+		case OpTryCatch, OpTryFinally:
+			vm.handlers = append(vm.handlers, handler{
+				frame: len(vm.frames) - 1,
+				ip:    ip + 2 + readShort(code, ip),
+				sp:    vm.sp,
+				catch: op == OpTryCatch,
+			})
+			ip += 2
+		case OpPopTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OpRethrow:
+			err = vm.pop().obj.(*pendingError).err
+		case OpIterate:
+			frame.ip = ip
+			var it Value
+			if it, err = vm.iterate(vm.stack[vm.sp-1]); err == nil {
+				vm.stack[vm.sp-1] = it
+			}
+		case OpForNext:
+			it := vm.stack[frame.base+int(code[ip])].obj.(*iterator)
+			exit := readShort(code, ip+1)
+			ip += 3
+			frame.ip = ip
+			value, ok, nextErr := vm.next(it)
+			if err = nextErr; err == nil {
+				if ok {
+					vm.push(value)
+				} else {
+					ip += exit
+				}
+			}
+		default:
+			err = errorf(util.CodeRuntime, "unknown opcode %d", op)
+		}
+		if err == nil {
+			continue
+		}
+
+		frame.ip = ip
+		err = vm.withStack(located(chunk.token(start), err))
+		if !vm.handle(err, depth) {
+			vm.unwind(depth)
+			return err
+		}
+		frame = &vm.frames[len(vm.frames)-1]
+		chunk = &frame.closure.function.chunk
+		code, constants = chunk.code, chunk.constants
+		ip = frame.ip
+	}
+}
+
+func compare(op OpCode, a, b float64) bool {
+	switch op {
+	case OpGreater:
+		return a > b
+	case OpGreaterEqual:
+		return a >= b
+	case OpLess:
+		return a < b
+	}
+	return a <= b
+}
+
+func arithmetic(op OpCode, a, b float64) (float64, error) {
+	switch op {
+	case OpSubtract:
+		return a - b, nil
+	case OpMultiply:
+		return a * b, nil
+	case OpDivide:
+		if b == 0 {
+			return 0, errorf(util.CodeDivisionByZero, "division by zero")
+		}
+		return a / b, nil
+	}
+	if b == 0 {
+		return 0, errorf(util.CodeDivisionByZero, "modulo by zero")
+	}
+	return math.Mod(a, b), nil
+}
+
+// add concatenates two strings; two numbers are added by the VM directly.
+func (vm *VM) add(a, b Value) (Value, error) {
+	if a.isNumber() {
+		return nilValue, errorf(util.CodeOperandType, "right value is not a number: %v", b)
+	}
+	if left, ok := a.asString(); ok {
+		if right, ok := b.asString(); ok {
+			if err := vm.charge(sizeString + len(left) + len(right)); err != nil {
+				return nilValue, err
+			}
+			return stringValue(left + right), nil
+		}
+		return nilValue, errorf(util.CodeOperandType, "right value is not a string: %v", b)
+	}
+	return nilValue, errorf(util.CodeOperandType, "operands must be two numbers or two strings")
+}
+
+func numberOperands(operator syntax.Token, a, b Value) error {
+	side := "right"
+	if !a.isNumber() {
+		side = "left"
+	}
+	return errorf(util.CodeOperandType, "operator %s: %s operand must be a number",
+		syntax.TokenTypeStr[operator.TokenType], side)
+}
+
+func index(object Value, idx Value) (Value, error) {
+	switch obj := object.obj.(type) {
+	case *List:
+		value, err := obj.index(idx)
+		if err != nil {
+			return nilValue, errorf(util.CodeIndex, "%s", err)
+		}
+		return value, nil
+	case *Map:
+		value, ok := obj.get(idx)
+		if !ok {
+			return nilValue, errorf(util.CodeIndex, "undefined key %v", idx)
+		}
+		return value, nil
+	case string:
+		char, err := stdlib.CharAt(obj, idx.plain())
+		if err != nil {
+			return nilValue, errorf(util.CodeIndex, "%s", err)
+		}
+		return stringValue(char), nil
+	}
+	return nilValue, errorf(util.CodeOperandType, "can only index lists, maps and strings")
+}
+
+func setIndex(object Value, idx Value, value Value) error {
+	var err error
+	switch obj := object.obj.(type) {
+	case *List:
+		err = obj.setIndex(idx, value)
+	case *Map:
+		err = obj.set(idx, value)
+	case string:
+		return errorf(util.CodeOperandType, "strings are immutable")
+	default:
+		return errorf(util.CodeOperandType, "can only index lists and maps")
+	}
+	if err != nil {
+		return errorf(util.CodeIndex, "%s", err)
+	}
+	return nil
+}
+
+// property returns the property name of value: a field or bound method of an
+// instance, or a bound method of a builtin type.
+func (vm *VM) property(value Value, name string) (Value, error) {
+	switch obj := value.obj.(type) {
+	case *Instance:
+		if field, ok := obj.fields[name]; ok {
+			return field, nil
+		}
+		if method, ok := obj.class.methods[name]; ok {
+			return objectValue(&BoundMethod{receiver: value, method: method}), nil
+		}
+		return nilValue, errorf(util.CodeUndefinedProperty, "undefined property '%s'", name)
+	case *List:
+		return bindMethod(listMethods, obj, "list", name)
+	case *Map:
+		return bindMethod(mapMethods, obj, "map", name)
+	case string:
+		return bindMethod(stringMethods, obj, "string", name)
+	}
+	return nilValue, errorf(util.CodeRuntime, "can only get properties from instances, lists, maps and strings")
+}
+
+// callSite returns the token of the call the innermost frame is making.
+func (vm *VM) callSite() syntax.Token {
+	caller := &vm.frames[len(vm.frames)-1]
+	return caller.closure.function.chunk.token(caller.ip - 1)
+}
+
+// callValue calls the callee below the argc arguments on top of the stack.
+// Closures get a new frame, natives run to completion. Errors are located at
+// the call site.
+func (vm *VM) callValue(callee Value, argc int) error {
+	switch fn := callee.obj.(type) {
+	case *Closure:
+		return vm.call(fn, argc, nil)
+	case *BoundMethod:
+		vm.stack[vm.sp-argc-1] = fn.receiver
+		return vm.call(fn.method, argc, nil)
+	case *Class:
+		if err := vm.charge(sizeInstance); err != nil {
+			return err
+		}
+		vm.stack[vm.sp-argc-1] = objectValue(newInstance(fn))
+		if fn.init != nil {
+			return vm.call(fn.init, argc, fn)
+		}
+		if argc != 0 {
+			return located(vm.callSite(), arityError(0, argc))
+		}
+		return nil
+	case *Native:
+		if fn.arity != stdlib.VariadicArity && fn.arity != argc {
+			return located(vm.callSite(), arityError(fn.arity, argc))
+		}
+		return vm.callNative(argc, func(args []Value) (Value, error) {
+			return fn.fn(vm, args)
+		})
+	}
+	return located(vm.callSite(), errorf(util.CodeNotCallable, "can only call functions and classes"))
+}
+
+// callNative replaces the callee and its argc arguments with the result of
+// fn.
+func (vm *VM) callNative(argc int, fn func(args []Value) (Value, error)) error {
+	result, err := fn(vm.stack[vm.sp-argc : vm.sp])
+	if err != nil {
+		return located(vm.callSite(), err)
+	}
+	vm.sp -= argc + 1
+	vm.push(result)
+	return nil
+}
+
+// call pushes the frame of a closure. class is set when the closure is the
+// initializer of a class being called.
+func (vm *VM) call(closure *Closure, argc int, class *Class) error {
+	if argc != closure.function.arity {
+		return located(vm.callSite(), arityError(closure.function.arity, argc))
+	}
+	// the script has a frame too
+	if len(vm.frames) > vm.opts.MaxCallDepth {
+		return located(vm.callSite(), errorf(util.CodeStackOverflow, "Stack overflow."))
+	}
+	vm.frames = append(vm.frames, frame{closure: closure, base: vm.sp - argc - 1, class: class})
+	return nil
+}
+
+// invoke calls the method name of the receiver below the argc arguments on
+// top of the stack, without binding it first.
+func (vm *VM) invoke(name string, argc int) error {
+	receiver := vm.stack[vm.sp-argc-1]
+	switch obj := receiver.obj.(type) {
+	case *Instance:
+		if field, ok := obj.fields[name]; ok {
+			vm.stack[vm.sp-argc-1] = field
+			return vm.callValue(field, argc)
+		}
+		method, ok := obj.class.methods[name]
+		if !ok {
+			return errorf(util.CodeUndefinedProperty, "undefined property '%s'", name)
+		}
+		return vm.call(method, argc, nil)
+	case *List:
+		return invokeMethod(vm, listMethods, obj, "list", name, argc)
+	case *Map:
+		return invokeMethod(vm, mapMethods, obj, "map", name, argc)
+	case string:
+		return invokeMethod(vm, stringMethods, obj, "string", name, argc)
+	}
+	return errorf(util.CodeRuntime, "can only get properties from instances, lists, maps and strings")
+}
+
+func invokeMethod[T any](vm *VM, methods map[string]method[T], receiver T, typeName string, name string, argc int) error {
+	m, err := stdlib.Lookup(methods, typeName, name, syntax.Token{})
+	if err != nil {
+		return err
+	}
+	if m.arity != argc {
+		return located(vm.callSite(), arityError(m.arity, argc))
+	}
+	return vm.callNative(argc, func(args []Value) (Value, error) {
+		return m.fn(vm, receiver, args)
+	})
+}
+
+// callMethod calls the method name of instance without arguments and runs it
+// to completion, for for-in loops over instances.
+func (vm *VM) callMethod(instance *Instance, name string) (Value, error) {
+	method, ok := instance.class.methods[name]
+	if !ok {
+		return nilValue, errorf(util.CodeUndefinedProperty,
+			"%s is not iterable: class %s has no method '%s'", instance, instance.class.name, name)
+	}
+	vm.push(objectValue(instance))
+	if err := vm.call(method, 0, nil); err != nil {
+		vm.sp--
+		return nilValue, err
+	}
+	if err := vm.run(len(vm.frames) - 1); err != nil {
+		return nilValue, err
+	}
+	return vm.pop(), nil
+}
+
+// iterate returns the iterator a for-in loop over value uses. Lists yield
+// their elements, maps their keys and strings their characters. An instance
+// takes part when its class defines iterator(), which must return an object
+// whose class defines hasNext() and next().
+func (vm *VM) iterate(value Value) (Value, error) {
+	switch iterable := value.obj.(type) {
+	case *List:
+		// the length is checked on every step, so the body may grow or
+		// shrink the list
+		return objectValue(&iterator{list: iterable}), nil
+	case *Map:
+		return objectValue(&iterator{elements: iterable.entries.Keys()}), nil
+	case string:
+		chars := make([]Value, 0, len(iterable))
+		for _, char := range iterable {
+			chars = append(chars, stringValue(string(char)))
+		}
+		return objectValue(&iterator{elements: chars}), nil
+	case *Instance:
+		it, err := vm.callMethod(iterable, "iterator")
+		if err != nil {
+			return nilValue, err
+		}
+		instance, ok := it.obj.(*Instance)
+		if !ok {
+			return nilValue, errorf(util.CodeRuntime, "iterator() must return an instance, got %v", it)
+		}
+		return objectValue(&iterator{instance: instance}), nil
+	}
+	return nilValue, errorf(util.CodeRuntime,
+		"can only iterate over lists, maps, strings and instances defining iterator(), got %v", value)
+}
+
+// next returns the next element of an iteration, or false once it is
+// exhausted.
+func (vm *VM) next(it *iterator) (Value, bool, error) {
+	switch {
+	case it.list != nil:
+		if it.idx >= len(it.list.elements) {
+			return nilValue, false, nil
+		}
+		it.idx++
+		return it.list.elements[it.idx-1], true, nil
+	case it.instance != nil:
+		hasNext, err := vm.callMethod(it.instance, "hasNext")
+		if err != nil || hasNext.isFalsey() {
+			return nilValue, false, err
+		}
+		next, err := vm.callMethod(it.instance, "next")
+		return next, err == nil, err
+	}
+	if it.idx >= len(it.elements) {
+		return nilValue, false, nil
+	}
+	it.idx++
+	return it.elements[it.idx-1], true, nil
+}
+
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var previous *Upvalue
+	upvalue := vm.open
+	for upvalue != nil && upvalue.slot > slot {
+		previous, upvalue = upvalue, upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+	created := &Upvalue{location: &vm.stack[slot], slot: slot, next: upvalue}
+	if previous == nil {
+		vm.open = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves the variables in slot last and above off the stack.
+func (vm *VM) closeUpvalues(last int) {
+	for vm.open != nil && vm.open.slot >= last {
+		upvalue := vm.open
+		upvalue.closed = *upvalue.location
+		upvalue.location = &upvalue.closed
+		vm.open = upvalue.next
+	}
+}
+
+// throw raises value as a RuntimeError with the code CodeThrow, which a
+// catch clause turns back into value.
+func (vm *VM) throw(value Value, keyword syntax.Token) error {
+	message := fmt.Sprintf("uncaught exception: %v", value)
+	instance, isError := isErrorInstance(value)
+	if isError {
+		message = fmt.Sprintf("uncaught Error: %v", instance.fields["message"])
+	}
+	err := vm.withStack(&interpreter.RuntimeError{Diagnostic: syntax.ErrorAt(keyword, util.CodeThrow, message), Value: value})
+	if isError && instance.fields["line"].kind == kindNil {
+		instance.fields["line"] = numberValue(float64(keyword.Line))
+		instance.fields["stack"] = stackList(err.(*interpreter.RuntimeError).Stack)
+	}
+	return err
+}
+
+// handle runs the innermost handler of the run started at depth: a catch
+// clause gets the caught value, a finally block the error to throw again.
+// An interrupted run skips the catch clauses, but still runs the finally
+// blocks. It reports false if the error escapes the run.
+func (vm *VM) handle(err error, depth int) bool {
+	for len(vm.handlers) > 0 {
+		h := vm.handlers[len(vm.handlers)-1]
+		if h.frame < depth {
+			return false
+		}
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		value := objectValue(&pendingError{err: err})
+		if h.catch {
+			if interpreter.Interrupted(err) {
+				continue
+			}
+			value = caught(err)
+		}
+		vm.closeUpvalues(h.sp)
+		vm.frames = vm.frames[:h.frame+1]
+		vm.frames[h.frame].ip = h.ip
+		vm.sp = h.sp
+		vm.push(value)
+		return true
+	}
+	return false
+}
+
+// unwind drops the frames of the run started at depth after an error escaped
+// it.
+func (vm *VM) unwind(depth int) {
+	base := vm.frames[depth].base
+	vm.closeUpvalues(base)
+	vm.frames = vm.frames[:depth]
+	vm.sp = base
+}
+
+// caught returns the value a catch clause binds for err: the thrown value,
+// or an Error instance describing a runtime error.
+func caught(err error) Value {
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		return objectValue(newErrorInstance(err.Error(), nilValue, nilValue))
+	}
+	if value, ok := runtimeErr.Value.(Value); ok && runtimeErr.Code == util.CodeThrow {
+		return value
+	}
+	line := nilValue
+	if runtimeErr.Line > 0 {
+		line = numberValue(float64(runtimeErr.Line))
+	}
+	return objectValue(newErrorInstance(runtimeErr.Message, line, stackList(runtimeErr.Stack)))
+}
+
+func stackList(stack []util.Frame) Value {
+	frames := make([]Value, 0, len(stack))
+	for _, frame := range stack {
+		frames = append(frames, stringValue(frame.String()))
+	}
+	return objectValue(newList(frames))
+}
+
+// withStack turns err into a *interpreter.RuntimeError carrying the current
+// call stack, unless it already carries one.
+func (vm *VM) withStack(err error) error {
+	var runtimeErr *interpreter.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		runtimeErr = &interpreter.RuntimeError{Diagnostic: util.AsDiagnostic(err)}
+		err = runtimeErr
+	}
+	if runtimeErr.Stack != nil {
+		return err
+	}
+	d := runtimeErr.Diagnostic
+	stack := make([]util.Frame, 0, len(vm.frames))
+	line, offset := d.Line, d.Offset
+	for idx := len(vm.frames) - 1; idx > 0; idx-- {
+		stack = append(stack, util.Frame{Function: vm.frames[idx].name(), Line: line, Offset: offset})
+		caller := &vm.frames[idx-1]
+		site := caller.closure.function.chunk.token(caller.ip - 1)
+		line, offset = site.Line, site.Pos
+	}
+	d.Stack = append(stack, util.Frame{Function: scriptFrame, Line: line, Offset: offset})
+	return err
+}
+
+func errorf(code string, format string, args ...any) error {
+	return syntax.ErrorAt(syntax.Token{}, code, fmt.Sprintf(format, args...))
+}
+
+func undefinedVariable(name string) error {
+	return errorf(util.CodeUndefinedVariable, "undefined variable '%s'", name)
+}
+
+func arityError(want int, got int) error {
+	return errorf(util.CodeArity, "wrong number of arguments: want=%d, got=%d", want, got)
+}
+
+// located attaches token to err unless err is already located.
+func located(token syntax.Token, err error) error {
+	var d *util.Diagnostic
+	if !errors.As(err, &d) {
+		return syntax.ErrorAt(token, util.CodeRuntime, err.Error())
+	}
+	if d.Line == 0 && !token.IsEmpty() {
+		located := syntax.ErrorAt(token, d.Code, d.Message)
+		d.Line, d.Offset, d.Length, d.Where = located.Line, located.Offset, located.Length, located.Where
+	}
+	return err
+}
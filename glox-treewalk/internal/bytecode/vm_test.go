@@ -0,0 +1,112 @@
+package bytecode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// parse returns the resolved statements of source.
+func parse(t *testing.T, source string) []syntax.Stmt {
+	t.Helper()
+	parser := syntax.NewParser(syntax.NewScanner(source).ScanTokens())
+	stmts := parser.Parse()
+	resolver := interpreter.NewResolver(interpreter.NewInterpreter())
+	resolver.Resolve(stmts)
+	if len(parser.GetErrors()) > 0 || len(resolver.GetErrors()) > 0 {
+		t.Fatalf("compile errors in %q", source)
+	}
+	return stmts
+}
+
+func TestInterrupt(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		opts   []util.Option
+		source string
+		want   error
+	}{
+		{"cancelled", cancelled, nil, `while (true) {}`, interpreter.ErrCancelled},
+		{"step budget", context.Background(), []util.Option{util.WithStepBudget(1000)},
+			`while (true) {}`, interpreter.ErrBudgetExceeded},
+		{"step budget in calls", context.Background(), []util.Option{util.WithStepBudget(1000)},
+			`fun f(n) { return f(n + 1); } f(0);`, interpreter.ErrBudgetExceeded},
+		{"time budget", context.Background(), []util.Option{util.WithTimeBudget(10 * time.Millisecond)},
+			`while (true) {}`, interpreter.ErrBudgetExceeded},
+		{"memory quota", context.Background(), []util.Option{util.WithMemoryQuota(1 << 16)},
+			`var s = ""; while (true) s = s + "x";`, interpreter.ErrMemoryQuotaExceeded},
+		{"memory quota in lists", context.Background(), []util.Option{util.WithMemoryQuota(1 << 16)},
+			`var xs = []; while (true) xs.push([1, 2, 3]);`, interpreter.ErrMemoryQuotaExceeded},
+		{"memory quota in methods", context.Background(), []util.Option{util.WithMemoryQuota(1 << 16)},
+			`var s = "x"; while (true) s = s.replace("x", "xx");`, interpreter.ErrMemoryQuotaExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := NewVM(append(test.opts, util.WithStderr(io.Discard))...)
+			err := vm.InterpretContext(test.ctx, parse(t, test.source))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			var runtimeErr *interpreter.RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Errorf("err = %T, want a runtime error", err)
+			}
+
+			// the budgets apply per run
+			if err := vm.Interpret(parse(t, `var done = true;`)); err != nil {
+				t.Errorf("run after interrupt: %s", err)
+			}
+		})
+	}
+}
+
+// TestInterruptNotCaught checks that catch clauses can't swallow an
+// interrupted run, while finally clauses still run.
+func TestInterruptNotCaught(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(util.WithStdout(&stdout), util.WithStderr(io.Discard), util.WithStepBudget(1000))
+	err := vm.Interpret(parse(t, `
+try {
+  while (true) {}
+} catch (e) {
+  print "caught";
+} finally {
+  print "finally";
+}
+print "after";`))
+	if !errors.Is(err, interpreter.ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want %v", err, interpreter.ErrBudgetExceeded)
+	}
+	if got := stdout.String(); got != "finally\n" {
+		t.Errorf("output = %q, want %q", got, "finally\n")
+	}
+}
+
+// TestWithinBudget checks that a script within its budgets runs to the end.
+func TestWithinBudget(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(util.WithStdout(&stdout), util.WithStderr(io.Discard),
+		util.WithStepBudget(1000), util.WithTimeBudget(time.Minute), util.WithMemoryQuota(1<<16))
+	err := vm.Interpret(parse(t, `
+fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+var s = "";
+for (var i = 0; i < 10; i = i + 1) s = s + str(i);
+print fib(10);
+print s;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "55\n0123456789\n" {
+		t.Errorf("output = %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+var (
+	// ErrCancelled is raised when the context of a run is done.
+	ErrCancelled = errors.New("execution cancelled")
+	// ErrBudgetExceeded is raised when a run executes more statements or
+	// takes longer than its budget allows.
+	ErrBudgetExceeded = errors.New("execution budget exceeded")
+)
+
+// pollInterval is the number of check points between two polls of the
+// context and the clock, which are too slow to consult on every iteration.
+const pollInterval = 1024
+
+// begin prepares the budgets of a new run, and reports whether it did: a run
+// begun while another is in progress, as when a native calls back into Lox,
+// keeps the context and the budgets of the outer run.
+func (a *Interpreter) begin(ctx context.Context) bool {
+	if a.running {
+		return false
+	}
+	a.running = true
+	a.ctx = ctx
+	a.steps = 0
+	a.checks = 0
+	a.allocated = 0
+	a.deadline = time.Time{}
+	if a.opts.Timeout > 0 {
+		a.deadline = time.Now().Add(a.opts.Timeout)
+	}
+	return true
+}
+
+// end finishes the run begun by begin.
+func (a *Interpreter) end() {
+	a.running = false
+	a.ctx = context.Background()
+	a.deadline = time.Time{}
+}
+
+// checkpoint runs at loop back-edges and calls, and interrupts the run once
+// the context is done or a budget is spent.
+func (a *Interpreter) checkpoint(token syntax.Token) error {
+	if a.opts.MaxSteps > 0 && a.steps > a.opts.MaxSteps {
+		return Interrupt(token, ErrBudgetExceeded)
+	}
+	a.checks++
+	if a.checks%pollInterval != 0 {
+		return nil
+	}
+	return a.poll(token)
+}
+
+func (a *Interpreter) poll(token syntax.Token) error {
+	if a.ctx.Err() != nil {
+		return Interrupt(token, ErrCancelled)
+	}
+	if !a.deadline.IsZero() && time.Now().After(a.deadline) {
+		return Interrupt(token, ErrBudgetExceeded)
+	}
+	return nil
+}
+
+// Interrupt returns the error stopping a run at token because of cause:
+// ErrCancelled, ErrBudgetExceeded or ErrMemoryQuotaExceeded. The bytecode VM
+// raises it too.
+func Interrupt(token syntax.Token, cause error) error {
+	return &RuntimeError{
+		Diagnostic: syntax.ErrorAt(token, util.CodeInterrupted, cause.Error()),
+		cause:      cause,
+	}
+}
+
+// Interrupted reports whether err stopped a run, which catch clauses can't
+// catch.
+func Interrupted(err error) bool {
+	var runtimeErr *RuntimeError
+	return errors.As(err, &runtimeErr) && runtimeErr.cause != nil
+}
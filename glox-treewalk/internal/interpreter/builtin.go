@@ -1,26 +1,111 @@
 package interpreter
 
 import (
-	"time"
-
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
 	"github.com/littlekuo/glox-treewalk/internal/syntax"
 )
 
-type Clock struct {
+// VariadicArity marks a native function that accepts any number of arguments.
+const VariadicArity = stdlib.VariadicArity
+
+type NativeFn func(args []any) (any, error)
+
+type NativeFunction struct {
+	name  string
+	arity int
+	fn    NativeFn
+}
+
+func NewNativeFunction(name string, arity int, fn NativeFn) *NativeFunction {
+	return &NativeFunction{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
 }
 
-func NewClock() *Clock {
-	return &Clock{}
+func (n *NativeFunction) Arity() int {
+	return n.arity
 }
 
-func (c *Clock) Arity() int {
-	return 0
+func (n *NativeFunction) Call(interpreter *Interpreter, args []any) syntax.Result {
+	value, err := n.fn(args)
+	if err != nil {
+		return syntax.Result{Err: err}
+	}
+	return syntax.Result{Value: value}
 }
 
-func (c *Clock) Call(interpreter *Interpreter, args []any) syntax.Result {
-	return syntax.Result{Value: float64(time.Now().UnixMilli())}
+func (n *NativeFunction) Name() string {
+	return n.name
 }
 
-func (c *Clock) String() string {
+func (n *NativeFunction) String() string {
 	return "<native fn>"
 }
+
+// nativeMethod is a method of a builtin type such as LoxList, implemented
+// in Go.
+type nativeMethod[T any] struct {
+	arity int
+	fn    func(i *Interpreter, receiver T, args []any) (any, error)
+}
+
+// bindMethod looks up the method name of receiver in methods and binds it.
+func bindMethod[T any](i *Interpreter, methods map[string]nativeMethod[T], receiver T, typeName string, name syntax.Token) (any, error) {
+	method, err := stdlib.Lookup(methods, typeName, name.Lexeme, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewNativeFunction(name.Lexeme, method.arity, func(args []any) (any, error) {
+		return method.fn(i, receiver, args)
+	}), nil
+}
+
+// adaptMethods turns methods of the stdlib into methods of the interpreter.
+func adaptMethods[T any](methods map[string]stdlib.Method[T]) map[string]nativeMethod[T] {
+	adapted := make(map[string]nativeMethod[T], len(methods))
+	for name, method := range methods {
+		adapted[name] = nativeMethod[T]{method.Arity, func(i *Interpreter, receiver T, args []any) (any, error) {
+			result, err := method.Fn((*quota)(i), receiver, args)
+			if err != nil {
+				return nil, err
+			}
+			return fromStdlib(result), nil
+		}}
+	}
+	return adapted
+}
+
+// defineStdlib defines the natives and constants of the stdlib. random()
+// draws from a generator seeded with the RandomSeed option.
+func (a *Interpreter) defineStdlib() {
+	for name, native := range stdlib.Natives(a.opts.RandomSeed) {
+		a.RegisterNative(name, native.Arity, func(args []any) (any, error) {
+			result, err := native.Fn(args)
+			if err != nil {
+				return nil, err
+			}
+			return fromStdlib(result), nil
+		})
+	}
+	for name, value := range stdlib.Constants {
+		a.SetGlobal(name, value)
+	}
+	a.RegisterNative("Error", 1, newError)
+	a.RegisterNative("str", 1, a.str)
+	a.RegisterNative("type", 1, typeOf)
+}
+
+// fromStdlib converts a result of the stdlib to a value. The methods have
+// charged the strings and lists they made already.
+func fromStdlib(result any) any {
+	if parts, ok := result.([]string); ok {
+		elements := make([]any, len(parts))
+		for idx, part := range parts {
+			elements[idx] = part
+		}
+		return NewLoxList(elements)
+	}
+	return result
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 
 	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
 )
 
 type Environment struct {
 	values    []interface{}          // valid for local scope
 	valueMap  map[string]interface{} // valid for global scope
+	natives   map[string]bool        // globals set by the host, which a script may re-define
+	redefine  bool                   // every global may be re-defined
 	enclosing *Environment
 }
 
@@ -17,6 +20,7 @@ func NewEnvironment(e *Environment) *Environment {
 		// e is nil means top level
 		return &Environment{
 			valueMap: make(map[string]interface{}),
+			natives:  make(map[string]bool),
 		}
 	}
 	return &Environment{
@@ -30,9 +34,10 @@ func (e *Environment) defineGlobal(name string, val any) error {
 	if e.valueMap == nil {
 		panic("valueMap is nil")
 	}
-	if _, ok := e.valueMap[name]; ok {
+	if _, ok := e.valueMap[name]; ok && !e.natives[name] && !e.redefine {
 		return fmt.Errorf("re-define variable %s", name)
 	}
+	delete(e.natives, name)
 	e.valueMap[name] = val
 	return nil
 }
@@ -43,7 +48,20 @@ func (e *Environment) getGlobal(name syntax.Token) (interface{}, error) {
 	if ok {
 		return val, nil
 	}
-	return nil, fmt.Errorf("undefined variable '%s'", name.Lexeme)
+	return nil, syntax.ErrorAt(name, util.CodeUndefinedVariable, fmt.Sprintf("undefined variable '%s'", name.Lexeme))
+}
+
+// set in global scope by the host, defining the name if it does not exist
+// yet. Unlike a variable declared by a script, the name can be re-defined.
+func (e *Environment) setGlobal(name string, val any) {
+	e.valueMap[name] = val
+	e.natives[name] = true
+}
+
+// lookup in global scope by name
+func (e *Environment) lookupGlobal(name string) (interface{}, bool) {
+	val, ok := e.valueMap[name]
+	return val, ok
 }
 
 // assign in global scope
@@ -52,7 +70,7 @@ func (e *Environment) assignGlobal(name syntax.Token, value any) error {
 		e.valueMap[name.Lexeme] = value
 		return nil
 	}
-	return fmt.Errorf("undefined variable '%s'", name.Lexeme)
+	return syntax.ErrorAt(name, util.CodeUndefinedVariable, fmt.Sprintf("undefined variable '%s'", name.Lexeme))
 }
 
 // define in local scope
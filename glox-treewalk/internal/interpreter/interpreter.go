@@ -1,11 +1,16 @@
 package interpreter
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"reflect"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
 	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
 )
 
 var (
@@ -37,24 +42,40 @@ type Interpreter struct {
 	localAccess  map[syntax.Expr]*Loc // track local variable access
 	localDefs    map[syntax.Token]int // track local variable definition
 	globals      *Environment
-}
-
-func NewInterpreter() *Interpreter {
+	frames       []callFrame // active calls, for tracebacks
+	opts         *util.Options
+	// budgets of the current run
+	running   bool
+	ctx       context.Context
+	deadline  time.Time
+	steps     int64 // statements executed
+	checks    int   // check points passed
+	allocated int64 // approximate bytes allocated
+}
+
+func NewInterpreter(opts ...util.Option) *Interpreter {
 	globals := NewEnvironment(nil)
-	_ = globals.defineGlobal("clock", NewClock())
-	return &Interpreter{
+	a := &Interpreter{
 		localAccess: make(map[syntax.Expr]*Loc),
 		localDefs:   make(map[syntax.Token]int),
 		env:         globals,
 		globals:     globals,
+		opts:        util.NewOptions(opts...),
+		ctx:         context.Background(),
 	}
+	globals.redefine = a.opts.Redefine
+	a.defineStdlib()
+	return a
 }
 
 func (a *Interpreter) define(name syntax.Token, value any) error {
+	if err := a.charge(name, sizeValue); err != nil {
+		return err
+	}
 	if idx, ok := a.localDefs[name]; ok {
-		return a.env.defineLocal(idx, value)
+		return withLocation(name, a.env.defineLocal(idx, value))
 	} else {
-		return a.globals.defineGlobal(name.Lexeme, value)
+		return withLocation(name, a.globals.defineGlobal(name.Lexeme, value))
 	}
 }
 
@@ -63,16 +84,152 @@ func (a *Interpreter) GetError() error {
 }
 
 func (a *Interpreter) Interpret(stmts []syntax.Stmt) {
+	_ = a.InterpretContext(context.Background(), stmts)
+}
+
+// InterpretContext works like Interpret, but stops with an error wrapping
+// ErrCancelled once ctx is done, and with one wrapping ErrBudgetExceeded
+// once the step or time budget of the options is spent. The returned error
+// is also available from GetError.
+func (a *Interpreter) InterpretContext(ctx context.Context, stmts []syntax.Stmt) error {
+	_, err := a.InterpretValueContext(ctx, stmts)
+	return err
+}
+
+// InterpretValue works like Interpret, and additionally returns the value of
+// the last statement if it is an expression statement.
+func (a *Interpreter) InterpretValue(stmts []syntax.Stmt) any {
+	value, _ := a.InterpretValueContext(context.Background(), stmts)
+	return value
+}
+
+// InterpretValueContext combines InterpretValue and InterpretContext.
+func (a *Interpreter) InterpretValueContext(ctx context.Context, stmts []syntax.Stmt) (any, error) {
+	a.interpretErr = nil
+	if a.begin(ctx) {
+		defer a.end()
+		if err := a.poll(syntax.Token{}); err != nil {
+			a.reportError(err)
+			return nil, a.interpretErr
+		}
+	}
+	var last *syntax.Expression
+	if len(stmts) > 0 {
+		if expr, ok := stmts[len(stmts)-1].(*syntax.Expression); ok {
+			last = expr
+			stmts = stmts[:len(stmts)-1]
+		}
+	}
 	for _, stmt := range stmts {
 		if err := a.execute(stmt); err != nil {
-			fmt.Printf("interpret error: %s\n", err.Error())
-			a.interpretErr = err
-			return
+			a.reportError(err)
+			return nil, a.interpretErr
 		}
 	}
+	if last == nil {
+		return nil, nil
+	}
+	result := a.executeExpr(last.Expression)
+	if result.Err != nil {
+		a.reportError(result.Err)
+		return nil, a.interpretErr
+	}
+	return result.Value, nil
+}
+
+// reportError reports a runtime error, GetError then returns it as a
+// *RuntimeError.
+func (a *Interpreter) reportError(err error) {
+	err = a.withStack(err)
+	a.opts.ReportDiagnostic(util.AsDiagnostic(err))
+	a.interpretErr = err
+}
+
+// Evaluate evaluates a single expression in the current environment, with
+// the budgets of the options like a run of Interpret.
+func (a *Interpreter) Evaluate(expr syntax.Expr) (any, error) {
+	if a.begin(context.Background()) {
+		defer a.end()
+	}
+	result := a.executeExpr(expr)
+	return result.Value, a.withStack(result.Err)
+}
+
+// SetGlobal defines or overwrites a global variable. Like the natives, it
+// can be re-defined by a script.
+func (a *Interpreter) SetGlobal(name string, value any) {
+	a.globals.setGlobal(name, value)
+}
+
+func (a *Interpreter) GetGlobal(name string) (any, bool) {
+	return a.globals.lookupGlobal(name)
+}
+
+// Globals returns a copy of the global variables.
+func (a *Interpreter) Globals() map[string]any {
+	globals := make(map[string]any, len(a.globals.valueMap))
+	for name, value := range a.globals.valueMap {
+		globals[name] = value
+	}
+	return globals
+}
+
+// RegisterNative defines a global native function. Use VariadicArity for
+// natives that accept any number of arguments.
+func (a *Interpreter) RegisterNative(name string, arity int, fn NativeFn) {
+	a.globals.setGlobal(name, NewNativeFunction(name, arity, fn))
+}
+
+// Call invokes a callable Lox value with already evaluated arguments.
+func (a *Interpreter) Call(callee any, args []any) (any, error) {
+	return a.CallContext(context.Background(), callee, args)
+}
+
+// CallContext works like Call, but is interrupted like InterpretContext.
+// Called by a native during a run, it shares the context and the budgets of
+// that run instead.
+func (a *Interpreter) CallContext(ctx context.Context, callee any, args []any) (any, error) {
+	if a.begin(ctx) {
+		defer a.end()
+		if err := a.poll(syntax.Token{}); err != nil {
+			return nil, err
+		}
+	}
+	result := a.call(syntax.Token{}, callee, args)
+	return result.Value, a.withStack(result.Err)
+}
+
+// call invokes callee; paren locates errors raised by native functions.
+func (a *Interpreter) call(paren syntax.Token, callee any, args []any) syntax.Result {
+	if calleeVal, ok := callee.(Callable); ok {
+		if arity := calleeVal.Arity(); arity != VariadicArity && arity != len(args) {
+			return syntax.Result{Err: syntax.ErrorAt(paren, util.CodeArity,
+				fmt.Sprintf("wrong number of arguments: want=%d, got=%d", calleeVal.Arity(), len(args)))}
+		}
+		if err := a.checkpoint(paren); err != nil {
+			return syntax.Result{Err: err}
+		}
+		name, ok := frameName(calleeVal)
+		if ok {
+			if len(a.frames) >= a.opts.MaxCallDepth {
+				return syntax.Result{Err: syntax.ErrorAt(paren, util.CodeStackOverflow, "Stack overflow.")}
+			}
+			a.frames = append(a.frames, callFrame{function: name, line: paren.Line, offset: paren.Pos})
+		}
+		result := calleeVal.Call(a, args)
+		if result.Err != nil {
+			result.Err = a.withStack(withLocation(paren, result.Err))
+		}
+		if ok {
+			a.frames = a.frames[:len(a.frames)-1]
+		}
+		return result
+	}
+	return syntax.Result{Err: syntax.ErrorAt(paren, util.CodeNotCallable, "can only call functions and classes")}
 }
 
 func (a *Interpreter) execute(stmt syntax.Stmt) error {
+	a.steps++
 	return stmt.Accept(a)
 }
 
@@ -92,14 +249,53 @@ func (a *Interpreter) VisitReturnStmt(stmt *syntax.Return) error {
 		}
 		return &ErrReturn{Value: result.Value}
 	}
-	return nil
+	return &ErrReturn{}
 }
 
 func (a *Interpreter) VisitFunctionStmt(stmt *syntax.Function) error {
+	if err := a.charge(stmt.Name, sizeFunction); err != nil {
+		return err
+	}
 	fn := NewLoxFunction(stmt, a.env, false)
 	return a.define(stmt.Name, fn)
 }
 
+func (a *Interpreter) VisitThrowStmt(stmt *syntax.Throw) error {
+	result := stmt.Value.Accept(a)
+	if result.Err != nil {
+		return result.Err
+	}
+	return a.throw(stmt.Keyword, result.Value)
+}
+
+// VisitTryStmt runs the finally block however the try statement is left.
+// A finally block that itself returns, breaks or throws replaces the error
+// the statement was left with.
+func (a *Interpreter) VisitTryStmt(stmt *syntax.Try) error {
+	err := a.execute(stmt.Body)
+	if stmt.Handler != nil {
+		if value, ok := a.catch(err); ok {
+			err = a.executeHandler(stmt, value)
+		}
+	}
+	if stmt.Finally != nil {
+		if finallyErr := a.execute(stmt.Finally); finallyErr != nil {
+			return finallyErr
+		}
+	}
+	return err
+}
+
+func (a *Interpreter) executeHandler(stmt *syntax.Try, value any) error {
+	previousEnv := a.env
+	a.env = NewEnvironment(a.env)
+	defer func() { a.env = previousEnv }()
+	if err := a.define(stmt.Name, value); err != nil {
+		return err
+	}
+	return a.execute(stmt.Handler)
+}
+
 func (a *Interpreter) VisitBreakStmt(stmt *syntax.Break) error {
 	return errBreak
 }
@@ -110,6 +306,9 @@ func (a *Interpreter) VisitContinueStmt(stmt *syntax.Continue) error {
 
 func (a *Interpreter) VisitForDesugaredWhileStmt(stmt *syntax.ForDesugaredWhile) error {
 	for {
+		if err := a.checkpoint(stmt.Keyword); err != nil {
+			return err
+		}
 		condResult := stmt.Condition.Accept(a)
 		if condResult.Err != nil {
 			return condResult.Err
@@ -135,8 +334,55 @@ func (a *Interpreter) VisitForDesugaredWhileStmt(stmt *syntax.ForDesugaredWhile)
 	return nil
 }
 
+func (a *Interpreter) VisitForInStmt(stmt *syntax.ForIn) error {
+	iterable := stmt.Iterable.Accept(a)
+	if iterable.Err != nil {
+		return iterable.Err
+	}
+	next, err := a.iterate(stmt.Keyword, iterable.Value)
+	if err != nil {
+		return err
+	}
+	for {
+		if err := a.checkpoint(stmt.Keyword); err != nil {
+			return err
+		}
+		value, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := a.executeIteration(stmt, value); err != nil {
+			if errors.Is(err, errBreak) {
+				return nil
+			} else if errors.Is(err, errContinue) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// executeIteration runs the body of a for-in loop with a fresh binding of
+// the loop variable, so closures capture the element of their iteration.
+func (a *Interpreter) executeIteration(stmt *syntax.ForIn, value any) error {
+	previousEnv := a.env
+	a.env = NewEnvironment(a.env)
+	defer func() { a.env = previousEnv }()
+	if err := a.define(stmt.Name, value); err != nil {
+		return err
+	}
+	return a.execute(stmt.Body)
+}
+
 func (a *Interpreter) VisitWhileStmt(stmt *syntax.While) error {
 	for {
+		if err := a.checkpoint(stmt.Keyword); err != nil {
+			return err
+		}
 		condResult := stmt.Condition.Accept(a)
 		if condResult.Err != nil {
 			return condResult.Err
@@ -182,6 +428,9 @@ func (a *Interpreter) VisitVarStmt(stmt *syntax.Var) error {
 }
 
 func (a *Interpreter) VisitBlockStmt(stmt *syntax.Block) error {
+	if err := a.charge(syntax.Token{}, sizeEnvironment); err != nil {
+		return err
+	}
 	previousEnv := a.env
 	a.env = NewEnvironment(a.env)
 	defer func() { a.env = previousEnv }()
@@ -206,7 +455,7 @@ func (a *Interpreter) VisitPrintStmt(stmt *syntax.Print) error {
 	if result.Err != nil {
 		return result.Err
 	}
-	fmt.Printf("%v\n", result.Value)
+	fmt.Fprintln(a.opts.Stdout, stringify(result.Value))
 	return nil
 }
 
@@ -220,7 +469,8 @@ func (a *Interpreter) VisitClassStmt(stmt *syntax.Class) error {
 		var ok bool
 		superClass, ok = result.Value.(*LoxClass)
 		if !ok {
-			return fmt.Errorf("superclass [%s] must be a class", stmt.Superclass.Name.Lexeme)
+			return syntax.ErrorAt(stmt.Superclass.Name, util.CodeRuntime,
+				fmt.Sprintf("superclass [%s] must be a class", stmt.Superclass.Name.Lexeme))
 		}
 	}
 
@@ -245,7 +495,7 @@ func (a *Interpreter) VisitClassStmt(stmt *syntax.Class) error {
 	}
 
 	if err := a.env.defineGlobal(stmt.Name.Lexeme, nil); err != nil {
-		return err
+		return withLocation(stmt.Name, err)
 	}
 	if superClass != nil {
 		a.env = NewEnvironment(a.env)
@@ -301,7 +551,7 @@ func (a *Interpreter) VisitAssignExpr(expr *syntax.Assign) syntax.Result {
 		err = a.globals.assignGlobal(expr.Name, result.Value)
 	}
 	if err != nil {
-		return syntax.Result{Err: err}
+		return syntax.Result{Err: withLocation(expr.Name, err)}
 	}
 	return result
 }
@@ -329,7 +579,7 @@ func (a *Interpreter) VisitUnaryExpr(expr *syntax.Unary) syntax.Result {
 		return syntax.Result{Value: !isTruthy(right.Value)}
 	}
 	// unreachable
-	return syntax.Result{Err: fmt.Errorf("unknown unary operator: %s", expr.Operator.Lexeme)}
+	return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeRuntime, fmt.Sprintf("unknown unary operator: %s", expr.Operator.Lexeme))}
 }
 
 func (a *Interpreter) VisitBinaryExpr(expr *syntax.Binary) syntax.Result {
@@ -353,22 +603,37 @@ func (a *Interpreter) VisitBinaryExpr(expr *syntax.Binary) syntax.Result {
 			if rightVal, ok_ := right.Value.(float64); ok_ {
 				return syntax.Result{Value: leftVal + rightVal}
 			}
-			return syntax.Result{Err: fmt.Errorf("right value is not a number: %v", left.Value)}
+			return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeOperandType,
+				fmt.Sprintf("right value is not a number: %v", right.Value))}
 		}
 		if leftVal, ok := left.Value.(string); ok {
 			if rightVal, ok_ := right.Value.(string); ok_ {
+				if err := a.charge(expr.Operator, sizeString+len(leftVal)+len(rightVal)); err != nil {
+					return syntax.Result{Err: err}
+				}
 				return syntax.Result{Value: leftVal + rightVal}
 			}
-			return syntax.Result{Err: fmt.Errorf("right value is not a string: %v", left.Value)}
+			return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeOperandType,
+				fmt.Sprintf("right value is not a string: %v", right.Value))}
 		}
+		return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeOperandType,
+			"operands must be two numbers or two strings")}
 	case syntax.TOKEN_SLASH:
 		if cErr := checkNumberOperands(expr.Operator, left.Value, right.Value); cErr != nil {
 			return syntax.Result{Err: cErr}
 		}
 		if right.Value.(float64) == 0 {
-			return syntax.Result{Err: fmt.Errorf("division by zero")}
+			return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeDivisionByZero, "division by zero")}
 		}
 		return syntax.Result{Value: left.Value.(float64) / right.Value.(float64)}
+	case syntax.TOKEN_PERCENT:
+		if cErr := checkNumberOperands(expr.Operator, left.Value, right.Value); cErr != nil {
+			return syntax.Result{Err: cErr}
+		}
+		if right.Value.(float64) == 0 {
+			return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeDivisionByZero, "modulo by zero")}
+		}
+		return syntax.Result{Value: math.Mod(left.Value.(float64), right.Value.(float64))}
 	case syntax.TOKEN_STAR:
 		if cErr := checkNumberOperands(expr.Operator, left.Value, right.Value); cErr != nil {
 			return syntax.Result{Err: cErr}
@@ -399,7 +664,7 @@ func (a *Interpreter) VisitBinaryExpr(expr *syntax.Binary) syntax.Result {
 	case syntax.TOKEN_EQUAL_EQUAL:
 		return syntax.Result{Value: isEqual(left.Value, right.Value)}
 	}
-	return syntax.Result{Err: fmt.Errorf("unknown unary operator: %s", expr.Operator.Lexeme)}
+	return syntax.Result{Err: syntax.ErrorAt(expr.Operator, util.CodeRuntime, fmt.Sprintf("unknown binary operator: %s", expr.Operator.Lexeme))}
 }
 
 func (a *Interpreter) VisitCallExpr(expr *syntax.Call) syntax.Result {
@@ -415,17 +680,13 @@ func (a *Interpreter) VisitCallExpr(expr *syntax.Call) syntax.Result {
 		}
 		args[i] = argVal.Value
 	}
-
-	if calleeVal, ok := callee.Value.(Callable); ok {
-		if calleeVal.Arity() != len(args) {
-			return syntax.Result{Err: fmt.Errorf("wrong number of arguments: want=%d, got=%d", calleeVal.Arity(), len(args))}
-		}
-		return calleeVal.Call(a, args)
-	}
-	return syntax.Result{Err: fmt.Errorf("can only call functions and classes")}
+	return a.call(expr.Paren, callee.Value, args)
 }
 
 func (a *Interpreter) VisitAnonymousFunctionExpr(expr *syntax.AnonymousFunction) syntax.Result {
+	if err := a.charge(syntax.Token{}, sizeFunction); err != nil {
+		return syntax.Result{Err: err}
+	}
 	loxFunc := NewLoxFunction(expr.Decl, a.env, false)
 	return syntax.Result{Value: loxFunc}
 }
@@ -435,14 +696,149 @@ func (a *Interpreter) VisitGetExpr(expr *syntax.Get) syntax.Result {
 	if obj.Err != nil {
 		return syntax.Result{Err: obj.Err}
 	}
-	if objVal, ok := obj.Value.(*LoxInstance); ok {
-		property, gErr := objVal.Get(expr.Name)
-		if gErr != nil {
-			return syntax.Result{Err: gErr}
+	var property any
+	var gErr error
+	switch objVal := obj.Value.(type) {
+	case *LoxInstance:
+		property, gErr = objVal.Get(expr.Name)
+	case *LoxList:
+		property, gErr = bindMethod(a, listMethods, objVal, "list", expr.Name)
+	case *LoxMap:
+		property, gErr = bindMethod(a, mapMethods, objVal, "map", expr.Name)
+	case string:
+		property, gErr = bindMethod(a, stringMethods, objVal, "string", expr.Name)
+	default:
+		return syntax.Result{Err: syntax.ErrorAt(expr.Name, util.CodeRuntime, "can only get properties from instances, lists, maps and strings")}
+	}
+	if gErr != nil {
+		return syntax.Result{Err: gErr}
+	}
+	return syntax.Result{Value: property}
+}
+
+func (a *Interpreter) VisitListExpr(expr *syntax.List) syntax.Result {
+	elements := make([]any, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		result := element.Accept(a)
+		if result.Err != nil {
+			return result
+		}
+		elements = append(elements, result.Value)
+	}
+	if err := a.charge(expr.Bracket, sizeList+sizeValue*len(elements)); err != nil {
+		return syntax.Result{Err: err}
+	}
+	return syntax.Result{Value: NewLoxList(elements)}
+}
+
+func (a *Interpreter) VisitIndexExpr(expr *syntax.Index) syntax.Result {
+	obj := expr.Object.Accept(a)
+	if obj.Err != nil {
+		return obj
+	}
+	index := expr.Index.Accept(a)
+	if index.Err != nil {
+		return index
+	}
+	switch objVal := obj.Value.(type) {
+	case *LoxList:
+		value, err := objVal.Index(index.Value)
+		if err != nil {
+			return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeIndex, err.Error())}
+		}
+		return syntax.Result{Value: value}
+	case *LoxMap:
+		value, ok := objVal.Get(index.Value)
+		if !ok {
+			return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeIndex, fmt.Sprintf("undefined key %v", index.Value))}
+		}
+		return syntax.Result{Value: value}
+	case string:
+		value, err := stdlib.CharAt(objVal, index.Value)
+		if err != nil {
+			return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeIndex, err.Error())}
+		}
+		return syntax.Result{Value: value}
+	}
+	return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeOperandType, "can only index lists, maps and strings")}
+}
+
+func (a *Interpreter) VisitIndexSetExpr(expr *syntax.IndexSet) syntax.Result {
+	obj := expr.Object.Accept(a)
+	if obj.Err != nil {
+		return obj
+	}
+	index := expr.Index.Accept(a)
+	if index.Err != nil {
+		return index
+	}
+	value := expr.Value.Accept(a)
+	if value.Err != nil {
+		return value
+	}
+	var err error
+	switch objVal := obj.Value.(type) {
+	case *LoxList:
+		err = objVal.SetIndex(index.Value, value.Value)
+	case *LoxMap:
+		if _, ok := objVal.Get(index.Value); !ok {
+			if cErr := a.charge(expr.Bracket, sizeField); cErr != nil {
+				return syntax.Result{Err: cErr}
+			}
 		}
-		return syntax.Result{Value: property}
+		err = objVal.Set(index.Value, value.Value)
+	case string:
+		return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeOperandType, "strings are immutable")}
+	default:
+		return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeOperandType, "can only index lists and maps")}
 	}
-	return syntax.Result{Err: errors.New("can only get properties from instance")}
+	if err != nil {
+		return syntax.Result{Err: syntax.ErrorAt(expr.Bracket, util.CodeIndex, err.Error())}
+	}
+	return value
+}
+
+// VisitInterpolationExpr concatenates the parts of an interpolated string,
+// converting values that aren't strings the way print does.
+func (a *Interpreter) VisitInterpolationExpr(expr *syntax.Interpolation) syntax.Result {
+	if err := a.charge(expr.Quote, sizeString); err != nil {
+		return syntax.Result{Err: err}
+	}
+	var builder strings.Builder
+	for _, part := range expr.Parts {
+		result := part.Accept(a)
+		if result.Err != nil {
+			return result
+		}
+		text := stringify(result.Value)
+		// charged before the result grows by it
+		if err := a.charge(expr.Quote, len(text)); err != nil {
+			return syntax.Result{Err: err}
+		}
+		builder.WriteString(text)
+	}
+	return syntax.Result{Value: builder.String()}
+}
+
+func (a *Interpreter) VisitMapExpr(expr *syntax.Map) syntax.Result {
+	m := NewLoxMap()
+	for idx := range expr.Keys {
+		key := expr.Keys[idx].Accept(a)
+		if key.Err != nil {
+			return key
+		}
+		value := expr.Values[idx].Accept(a)
+		if value.Err != nil {
+			return value
+		}
+		if err := m.Set(key.Value, value.Value); err != nil {
+			return syntax.Result{Err: syntax.ErrorAt(expr.Brace, util.CodeIndex, err.Error())}
+		}
+	}
+	if err := a.charge(expr.Brace, sizeMap+sizeField*m.Len()); err != nil {
+		return syntax.Result{Err: err}
+	}
+	return syntax.Result{Value: m}
 }
 
 func (a *Interpreter) VisitSetExpr(expr *syntax.Set) syntax.Result {
@@ -455,13 +851,18 @@ func (a *Interpreter) VisitSetExpr(expr *syntax.Set) syntax.Result {
 		if value.Err != nil {
 			return syntax.Result{Err: value.Err}
 		}
+		if _, ok := objVal.fields[expr.Name.Lexeme]; !ok {
+			if err := a.charge(expr.Name, sizeField+len(expr.Name.Lexeme)); err != nil {
+				return syntax.Result{Err: err}
+			}
+		}
 		gErr := objVal.Set(expr.Name, value.Value)
 		if gErr != nil {
 			return syntax.Result{Err: gErr}
 		}
 		return syntax.Result{Value: value.Value}
 	}
-	return syntax.Result{Err: errors.New("can only set properties on instances")}
+	return syntax.Result{Err: syntax.ErrorAt(expr.Name, util.CodeRuntime, "can only set properties on instances")}
 }
 
 func (a *Interpreter) VisitVariableExpr(expr *syntax.Variable) syntax.Result {
@@ -478,7 +879,7 @@ func (a *Interpreter) lookupVariable(name syntax.Token, expr syntax.Expr) syntax
 		obj, err = a.globals.getGlobal(name)
 	}
 	if err != nil {
-		return syntax.Result{Err: err}
+		return syntax.Result{Err: withLocation(name, err)}
 	}
 	return syntax.Result{Value: obj}
 }
@@ -486,7 +887,7 @@ func (a *Interpreter) lookupVariable(name syntax.Token, expr syntax.Expr) syntax
 func (a *Interpreter) VisitSuperExpr(expr *syntax.Super) syntax.Result {
 	loc, ok := a.localAccess[expr]
 	if !ok {
-		return syntax.Result{Err: errors.New("no super class")}
+		return syntax.Result{Err: syntax.ErrorAt(expr.Keyword, util.CodeRuntime, "no super class")}
 	}
 	class, err := a.env.getAt(loc.depth, loc.idx)
 	if err != nil {
@@ -501,13 +902,38 @@ func (a *Interpreter) VisitSuperExpr(expr *syntax.Super) syntax.Result {
 		if instance, ok := obj.(*LoxInstance); ok {
 			method := superClass.FindMethod(expr.Method.Lexeme)
 			if method == nil {
-				return syntax.Result{Err: fmt.Errorf("undefined method '%s'", expr.Method.Lexeme)}
+				return syntax.Result{Err: syntax.ErrorAt(expr.Method, util.CodeUndefinedProperty,
+					fmt.Sprintf("undefined method '%s'", expr.Method.Lexeme))}
 			}
 			return syntax.Result{Value: method.Bind(instance)}
 		}
-		return syntax.Result{Err: errors.New("instance of LoxClass expected")}
+		return syntax.Result{Err: syntax.ErrorAt(expr.Keyword, util.CodeRuntime, "instance of LoxClass expected")}
+	}
+	return syntax.Result{Err: syntax.ErrorAt(expr.Keyword, util.CodeRuntime, "no super class")}
+}
+
+// withLocation attaches token to err unless err is already located.
+func withLocation(token syntax.Token, err error) error {
+	if err == nil {
+		return nil
+	}
+	var d *util.Diagnostic
+	if !errors.As(err, &d) {
+		return syntax.ErrorAt(token, util.CodeRuntime, err.Error())
 	}
-	return syntax.Result{Err: errors.New("no super class")}
+	if d.Line == 0 && !token.IsEmpty() {
+		located := syntax.ErrorAt(token, d.Code, d.Message)
+		d.Line, d.Offset, d.Length, d.Where = located.Line, located.Offset, located.Length, located.Where
+	}
+	return err
+}
+
+// stringify returns the text print shows for value.
+func stringify(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
 }
 
 func isTruthy(value interface{}) bool {
@@ -522,40 +948,42 @@ func isTruthy(value interface{}) bool {
 	}
 }
 
+// isEqual compares nil, bools, numbers and strings by value, and every
+// other value by identity. It agrees with the key equality of LoxMap.
 func isEqual(a, b interface{}) bool {
-	if a == nil || b == nil {
-		return true
-	}
-
 	switch aVal := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bVal, ok := b.(bool)
+		return ok && aVal == bVal
 	case float64:
-		if bVal, ok := b.(float64); ok {
-			return aVal == bVal
-		}
-		return false
+		bVal, ok := b.(float64)
+		return ok && aVal == bVal
 	case string:
-		if bVal, ok := b.(string); ok {
-			return aVal == bVal
-		}
-		return false
+		bVal, ok := b.(string)
+		return ok && aVal == bVal
 	default:
-		return reflect.DeepEqual(a, b)
+		return a == b
 	}
 }
 
 func checkNumberOperand(operator syntax.Token, operand interface{}) error {
 	if _, ok := operand.(float64); !ok {
-		return fmt.Errorf("operator %s: operand must be a number", syntax.TokenTypeStr[operator.TokenType])
+		return syntax.ErrorAt(operator, util.CodeOperandType,
+			fmt.Sprintf("operator %s: operand must be a number", syntax.TokenTypeStr[operator.TokenType]))
 	}
 	return nil
 }
 
 func checkNumberOperands(operator syntax.Token, left, right interface{}) error {
 	if _, ok := left.(float64); !ok {
-		return fmt.Errorf("operator %s: left operand must be a number", syntax.TokenTypeStr[operator.TokenType])
+		return syntax.ErrorAt(operator, util.CodeOperandType,
+			fmt.Sprintf("operator %s: left operand must be a number", syntax.TokenTypeStr[operator.TokenType]))
 	}
 	if _, ok := right.(float64); !ok {
-		return fmt.Errorf("operator %s: right operand must be a number", syntax.TokenTypeStr[operator.TokenType])
+		return syntax.ErrorAt(operator, util.CodeOperandType,
+			fmt.Sprintf("operator %s: right operand must be a number", syntax.TokenTypeStr[operator.TokenType]))
 	}
 	return nil
 }
@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// nextFunc returns the next element of an iteration, or false once it is
+// exhausted.
+type nextFunc func() (any, bool, error)
+
+// iterate starts iterating over value for a for-in loop. Lists yield their
+// elements, maps their keys and strings their characters. An instance takes
+// part when its class defines iterator(), which must return an object whose
+// class defines hasNext() and next().
+func (a *Interpreter) iterate(keyword syntax.Token, value any) (nextFunc, error) {
+	switch iterable := value.(type) {
+	case *LoxList:
+		// the length is checked on every step, so the body may grow or
+		// shrink the list
+		idx := 0
+		return func() (any, bool, error) {
+			if idx >= iterable.Len() {
+				return nil, false, nil
+			}
+			idx++
+			return iterable.elements[idx-1], true, nil
+		}, nil
+	case *LoxMap:
+		keys := iterable.Keys()
+		return iterateSlice(keys), nil
+	case string:
+		chars := make([]any, 0, len(iterable))
+		for _, char := range iterable {
+			chars = append(chars, string(char))
+		}
+		return iterateSlice(chars), nil
+	case *LoxInstance:
+		iterator, err := a.callMethod(keyword, iterable, "iterator")
+		if err != nil {
+			return nil, err
+		}
+		instance, ok := iterator.(*LoxInstance)
+		if !ok {
+			return nil, syntax.ErrorAt(keyword, util.CodeRuntime,
+				fmt.Sprintf("iterator() must return an instance, got %v", iterator))
+		}
+		return func() (any, bool, error) {
+			hasNext, err := a.callMethod(keyword, instance, "hasNext")
+			if err != nil || !isTruthy(hasNext) {
+				return nil, false, err
+			}
+			next, err := a.callMethod(keyword, instance, "next")
+			return next, err == nil, err
+		}, nil
+	}
+	return nil, syntax.ErrorAt(keyword, util.CodeRuntime,
+		fmt.Sprintf("can only iterate over lists, maps, strings and instances defining iterator(), got %v", value))
+}
+
+func iterateSlice(elements []any) nextFunc {
+	idx := 0
+	return func() (any, bool, error) {
+		if idx >= len(elements) {
+			return nil, false, nil
+		}
+		idx++
+		return elements[idx-1], true, nil
+	}
+}
+
+// callMethod calls the method name of instance's class without arguments.
+func (a *Interpreter) callMethod(token syntax.Token, instance *LoxInstance, name string) (any, error) {
+	method := instance.loxClass.FindMethod(name)
+	if method == nil {
+		return nil, syntax.ErrorAt(token, util.CodeUndefinedProperty,
+			fmt.Sprintf("%s is not iterable: class %s has no method '%s'", instance, instance.loxClass.name, name))
+	}
+	result := a.call(token, method.Bind(instance), nil)
+	return result.Value, result.Err
+}
@@ -24,14 +24,32 @@ func (c *LoxClass) Arity() int {
 }
 
 func (c *LoxClass) Call(interpreter *Interpreter, args []interface{}) syntax.Result {
+	if err := interpreter.charge(syntax.Token{}, sizeInstance); err != nil {
+		return syntax.Result{Err: err}
+	}
 	loxInstance := NewLoxInstance(c)
 	initializer := c.FindMethod("init")
 	if initializer != nil {
-		initializer.Bind(loxInstance).Call(interpreter, args)
+		if result := initializer.Bind(loxInstance).Call(interpreter, args); result.Err != nil {
+			return result
+		}
 	}
 	return syntax.Result{Value: loxInstance}
 }
 
+// MethodNames returns the names of the methods of the class, including the
+// inherited ones.
+func (c *LoxClass) MethodNames() []string {
+	names := make([]string, 0, len(c.methods))
+	for name := range c.methods {
+		names = append(names, name)
+	}
+	if c.superClass != nil {
+		names = append(names, c.superClass.MethodNames()...)
+	}
+	return names
+}
+
 func (c *LoxClass) FindMethod(methodName string) *LoxFunction {
 	if method, ok := c.methods[methodName]; ok {
 		return method
@@ -21,6 +21,9 @@ func NewLoxFunction(f *syntax.Function, closure *Environment, isInitializer bool
 }
 
 func (l *LoxFunction) Call(i *Interpreter, args []any) syntax.Result {
+	if err := i.charge(syntax.Token{}, sizeEnvironment); err != nil {
+		return syntax.Result{Err: err}
+	}
 	previousEnv := i.env
 	i.env = NewEnvironment(l.closure)
 	defer func() {
@@ -34,8 +37,10 @@ func (l *LoxFunction) Call(i *Interpreter, args []any) syntax.Result {
 	result := syntax.Result{}
 	for _, stmt := range l.declaration.Body {
 		if err := i.execute(stmt); err != nil {
-			var ret *ErrReturn
-			if errors.As(err, &ret) {
+			// return statements are the common case, so try them without
+			// unwrapping first
+			ret, ok := err.(*ErrReturn)
+			if ok || errors.As(err, &ret) {
 				result.Value = ret.Value
 				break
 			}
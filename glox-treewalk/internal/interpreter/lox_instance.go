@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
 )
 
 type LoxInstance struct {
@@ -18,6 +19,32 @@ func NewLoxInstance(loxClass *LoxClass) *LoxInstance {
 	}
 }
 
+// objectClass is the class of instances built from Go maps.
+var objectClass = NewLoxClass("Object", nil, map[string]*LoxFunction{})
+
+// NewObject returns an instance of the builtin Object class holding fields.
+func NewObject(fields map[string]interface{}) *LoxInstance {
+	instance := NewLoxInstance(objectClass)
+	for name, value := range fields {
+		instance.fields[name] = value
+	}
+	return instance
+}
+
+// Fields returns a copy of the instance's fields.
+func (i *LoxInstance) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(i.fields))
+	for name, value := range i.fields {
+		fields[name] = value
+	}
+	return fields
+}
+
+// Class returns the class the instance was created from.
+func (i *LoxInstance) Class() *LoxClass {
+	return i.loxClass
+}
+
 func (i *LoxInstance) String() string {
 	return "<instance of " + i.loxClass.name + ">"
 }
@@ -31,7 +58,7 @@ func (i *LoxInstance) Get(name syntax.Token) (interface{}, error) {
 		return method.Bind(i), nil
 	}
 
-	return nil, fmt.Errorf("undefined property %s", name.Lexeme)
+	return nil, syntax.ErrorAt(name, util.CodeUndefinedProperty, fmt.Sprintf("undefined property '%s'", name.Lexeme))
 }
 
 func (i *LoxInstance) Set(name syntax.Token, value interface{}) error {
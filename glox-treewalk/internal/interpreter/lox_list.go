@@ -0,0 +1,96 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+type LoxList struct {
+	elements []interface{}
+	printing bool // guards String against lists that contain themselves
+}
+
+func NewLoxList(elements []interface{}) *LoxList {
+	return &LoxList{elements: elements}
+}
+
+func (l *LoxList) Elements() []interface{} {
+	return l.elements
+}
+
+func (l *LoxList) Len() int {
+	return len(l.elements)
+}
+
+func (l *LoxList) String() string {
+	if l.printing {
+		return "[...]"
+	}
+	l.printing = true
+	defer func() { l.printing = false }()
+	parts := make([]string, 0, len(l.elements))
+	for _, element := range l.elements {
+		parts = append(parts, fmt.Sprintf("%v", element))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// Index returns the element at index.
+func (l *LoxList) Index(index any) (any, error) {
+	idx, err := l.position(index, len(l.elements)-1)
+	if err != nil {
+		return nil, err
+	}
+	return l.elements[idx], nil
+}
+
+// SetIndex replaces the element at index.
+func (l *LoxList) SetIndex(index any, value any) error {
+	idx, err := l.position(index, len(l.elements)-1)
+	if err != nil {
+		return err
+	}
+	l.elements[idx] = value
+	return nil
+}
+
+// position checks that index is an integer between 0 and last.
+func (l *LoxList) position(index any, last int) (int, error) {
+	return stdlib.Position("list", index, len(l.elements), last)
+}
+
+var listMethods = map[string]nativeMethod[*LoxList]{
+	"push": {1, func(i *Interpreter, l *LoxList, args []any) (any, error) {
+		if err := i.charge(syntax.Token{}, sizeValue); err != nil {
+			return nil, err
+		}
+		l.elements = append(l.elements, args[0])
+		return nil, nil
+	}},
+	"pop": {0, func(i *Interpreter, l *LoxList, args []any) (last any, err error) {
+		l.elements, last, err = stdlib.Pop(l.elements)
+		return last, err
+	}},
+	"insert": {2, func(i *Interpreter, l *LoxList, args []any) (any, error) {
+		if err := i.charge(syntax.Token{}, sizeValue); err != nil {
+			return nil, err
+		}
+		elements, err := stdlib.Insert(l.elements, args[0], args[1])
+		l.elements = elements
+		return nil, err
+	}},
+	"remove": {1, func(i *Interpreter, l *LoxList, args []any) (removed any, err error) {
+		l.elements, removed, err = stdlib.Remove(l.elements, args[0])
+		return removed, err
+	}},
+	"slice": {2, func(i *Interpreter, l *LoxList, args []any) (any, error) {
+		elements, err := stdlib.Slice((*quota)(i), l.elements, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return NewLoxList(elements), nil
+	}},
+}
@@ -0,0 +1,94 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// LoxMap is a hash map keyed by strings, numbers, bools and nil. It
+// remembers the order in which keys were first inserted.
+type LoxMap struct {
+	entries  stdlib.OrderedMap[any, any]
+	printing bool // guards String against maps that contain themselves
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{}
+}
+
+// Keys returns the keys in insertion order.
+func (m *LoxMap) Keys() []any {
+	return m.entries.Keys()
+}
+
+func (m *LoxMap) Len() int {
+	return m.entries.Len()
+}
+
+// Get returns the value of key, and whether key is present.
+func (m *LoxMap) Get(key any) (any, bool) {
+	return m.entries.Get(key)
+}
+
+// Set adds or replaces the value of key.
+func (m *LoxMap) Set(key any, value any) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	m.entries.Set(key, value)
+	return nil
+}
+
+// Remove deletes key and returns its value, or nil if it was not present.
+func (m *LoxMap) Remove(key any) any {
+	value, _ := m.entries.Remove(key)
+	return value
+}
+
+func (m *LoxMap) String() string {
+	if m.printing {
+		return "{...}"
+	}
+	m.printing = true
+	defer func() { m.printing = false }()
+	parts := make([]string, 0, m.entries.Len())
+	for _, key := range m.entries.Keys() {
+		value, _ := m.entries.Get(key)
+		parts = append(parts, fmt.Sprintf("%v: %v", key, value))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// checkKey rejects keys that have no value equality.
+func checkKey(key any) error {
+	switch key.(type) {
+	case nil, bool, float64, string:
+		return nil
+	}
+	return fmt.Errorf("map keys must be strings, numbers, bools or nil, got %v", key)
+}
+
+var mapMethods = map[string]nativeMethod[*LoxMap]{
+	"keys": {0, func(i *Interpreter, m *LoxMap, args []any) (any, error) {
+		if err := i.charge(syntax.Token{}, sizeList+sizeValue*m.Len()); err != nil {
+			return nil, err
+		}
+		return NewLoxList(m.Keys()), nil
+	}},
+	"values": {0, func(i *Interpreter, m *LoxMap, args []any) (any, error) {
+		if err := i.charge(syntax.Token{}, sizeList+sizeValue*m.Len()); err != nil {
+			return nil, err
+		}
+		return NewLoxList(m.entries.Values()), nil
+	}},
+	"has": {1, func(i *Interpreter, m *LoxMap, args []any) (any, error) {
+		_, ok := m.Get(args[0])
+		return ok, nil
+	}},
+	"remove": {1, func(i *Interpreter, m *LoxMap, args []any) (any, error) {
+		return m.Remove(args[0]), nil
+	}},
+}
@@ -0,0 +1,47 @@
+package interpreter
+
+import (
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// newString charges a string built by a method for its bytes.
+func newString(i *Interpreter, s string) (any, error) {
+	if err := i.charge(syntax.Token{}, sizeString+len(s)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stringMethods are the methods of strings from the stdlib.
+var stringMethods = adaptMethods(stdlib.StringMethods)
+
+// str converts any value to the string print shows for it.
+func (a *Interpreter) str(args []any) (any, error) {
+	return newString(a, stringify(args[0]))
+}
+
+// typeOf returns the name of the type of a value.
+func typeOf(args []any) (any, error) {
+	switch args[0].(type) {
+	case nil:
+		return "nil", nil
+	case bool:
+		return "bool", nil
+	case float64:
+		return "number", nil
+	case string:
+		return "string", nil
+	case *LoxList:
+		return "list", nil
+	case *LoxMap:
+		return "map", nil
+	case *LoxClass:
+		return "class", nil
+	case *LoxInstance:
+		return "instance", nil
+	case Callable:
+		return "function", nil
+	}
+	return "unknown", nil
+}
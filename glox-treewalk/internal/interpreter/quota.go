@@ -0,0 +1,46 @@
+package interpreter
+
+import (
+	"errors"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// ErrMemoryQuotaExceeded is raised when a run allocates more than the memory
+// quota of the options allows.
+var ErrMemoryQuotaExceeded = errors.New("memory quota exceeded")
+
+// approximate sizes in bytes of the values a script allocates
+const (
+	sizeString      = 16 // plus the bytes of the string
+	sizeInstance    = 48
+	sizeField       = 32 // plus the bytes of the name
+	sizeFunction    = 48
+	sizeEnvironment = 48
+	sizeList        = 32 // plus a value per element
+	sizeMap         = 48 // plus a field per entry
+	sizeValue       = 16 // a variable slot
+)
+
+// charge accounts size bytes allocated by the current run. Allocations are
+// counted as they happen and never given back, so the quota bounds the
+// total a run allocates rather than what it keeps alive. An empty token
+// leaves the error to be located at the enclosing call.
+func (a *Interpreter) charge(token syntax.Token, size int) error {
+	a.allocated += int64(size)
+	if a.opts.MemoryQuota > 0 && a.allocated > a.opts.MemoryQuota {
+		return Interrupt(token, ErrMemoryQuotaExceeded)
+	}
+	return nil
+}
+
+// quota charges the results of stdlib methods to the interpreter.
+type quota Interpreter
+
+func (q *quota) Strings(n int, bytes int) error {
+	return (*Interpreter)(q).charge(syntax.Token{}, sizeString*n+bytes)
+}
+
+func (q *quota) List(n int) error {
+	return (*Interpreter)(q).charge(syntax.Token{}, sizeList+sizeValue*n)
+}
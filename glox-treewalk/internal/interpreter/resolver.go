@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
 )
 
 type FuncType int
@@ -25,8 +26,8 @@ const (
 
 type VarInfo struct {
 	defined bool
-	used    bool
 	idx     int
+	symbol  *Symbol // nil unless the resolver records symbols
 }
 
 type Resolver struct {
@@ -34,16 +35,20 @@ type Resolver struct {
 	scopes       []map[string]*VarInfo
 	indices      []int // track indices of local scopes
 	resolveErr   error
+	errs         []*util.Diagnostic
 	curFuncType  FuncType
 	curClassType ClassType
+	symbols      *Symbols
+	opts         *util.Options
 }
 
-func NewResolver(interpreter *Interpreter) *Resolver {
+func NewResolver(interpreter *Interpreter, opts ...util.Option) *Resolver {
 	return &Resolver{
 		interpreter:  interpreter,
 		scopes:       make([]map[string]*VarInfo, 0),
 		curFuncType:  FuncTypeNone,
 		curClassType: ClassTypeNone,
+		opts:         util.NewOptions(opts...),
 	}
 }
 
@@ -51,11 +56,29 @@ func (r *Resolver) GetError() error {
 	return r.resolveErr
 }
 
+// GetErrors returns the resolution errors of every top-level declaration.
+func (r *Resolver) GetErrors() []*util.Diagnostic {
+	return r.errs
+}
+
+// Resolve resolves each top-level declaration in turn. Errors don't stop
+// it, so every error of the program is reported. A resolver can be reused
+// for further input, e.g. in the REPL; errors are kept per call.
 func (r *Resolver) Resolve(stmts []syntax.Stmt) {
-	if rErr := r.resolveStmts(stmts); rErr != nil {
-		fmt.Printf("resolve error: %s\n", rErr.Error())
-		r.resolveErr = rErr
+	r.resolveErr = nil
+	r.errs = nil
+	for _, stmt := range stmts {
+		_ = r.resolveStmt(stmt)
 	}
+	r.symbols.finish()
+}
+
+// error records a resolution error at token and lets resolving go on.
+func (r *Resolver) error(token syntax.Token, message string) {
+	d := util.AsDiagnostic(syntax.ErrorAt(token, util.CodeResolve, message))
+	r.opts.ReportDiagnostic(d)
+	r.errs = append(r.errs, d)
+	r.resolveErr = d
 }
 
 func (r *Resolver) resolveStmts(statements []syntax.Stmt) error {
@@ -80,38 +103,28 @@ func (r *Resolver) beginScope() {
 	newScope := make(map[string]*VarInfo)
 	r.scopes = append(r.scopes, newScope)
 	r.indices = append(r.indices, 0)
+	r.symbols.beginScope()
 }
 
-func (r *Resolver) endScope() error {
-	curScope := r.scopes[len(r.scopes)-1]
-	for name, info := range curScope {
-		if name != "this" && name != "super" && info.defined && !info.used {
-			return fmt.Errorf("variable [%s] is not used in local", name)
-		}
-	}
+// endScope closes the innermost scope. Unused variables are not an error,
+// lox-lint reports them.
+func (r *Resolver) endScope() {
 	r.scopes = r.scopes[:len(r.scopes)-1]
 	r.indices = r.indices[:len(r.indices)-1]
-	return nil
+	r.symbols.endScope()
 }
 
 func (r *Resolver) VisitBlockStmt(stmt *syntax.Block) error {
 	r.beginScope()
-	err := r.resolveStmts(stmt.Statements)
-	if err != nil {
-		return err
-	}
-	err = r.endScope()
-	if err != nil {
+	if err := r.resolveStmts(stmt.Statements); err != nil {
 		return err
 	}
+	r.endScope()
 	return nil
 }
 
 func (r *Resolver) VisitVarStmt(stmt *syntax.Var) error {
-	err := r.declare(stmt.Name)
-	if err != nil {
-		return err
-	}
+	r.declare(stmt.Name, SymbolVariable)
 	if stmt.Initializer != nil {
 		result := r.resolveExpr(stmt.Initializer)
 		if result.Err != nil {
@@ -122,20 +135,22 @@ func (r *Resolver) VisitVarStmt(stmt *syntax.Var) error {
 	return nil
 }
 
-func (r *Resolver) declare(name syntax.Token) error {
+func (r *Resolver) declare(name syntax.Token, kind SymbolKind) {
 	if len(r.scopes) == 0 {
-		return nil
+		r.symbols.declare(name, kind)
+		return
 	}
 	scope := r.scopes[len(r.scopes)-1]
 	if _, ok := scope[name.Lexeme]; ok {
-		return fmt.Errorf("re-declare variable [%s]", name.Lexeme)
+		r.error(name, fmt.Sprintf("re-declare variable [%s]", name.Lexeme))
+		return
 	}
 	curIdx := r.indices[len(r.indices)-1]
 	scope[name.Lexeme] = &VarInfo{
-		idx: curIdx,
+		idx:    curIdx,
+		symbol: r.symbols.declare(name, kind),
 	}
 	r.indices[len(r.indices)-1]++
-	return nil
 }
 
 func (r *Resolver) define(name syntax.Token) {
@@ -161,9 +176,7 @@ func (r *Resolver) peek() map[string]*VarInfo {
 func (r *Resolver) VisitVariableExpr(expr *syntax.Variable) syntax.Result {
 	if len(r.scopes) > 0 {
 		if info, ok := r.peek()[expr.Name.Lexeme]; ok && !info.defined {
-			return syntax.Result{
-				Err: fmt.Errorf("can't read local variable [%s] in its own initializer", expr.Name.Lexeme),
-			}
+			r.error(expr.Name, fmt.Sprintf("can't read local variable [%s] in its own initializer", expr.Name.Lexeme))
 		}
 	}
 
@@ -174,11 +187,12 @@ func (r *Resolver) VisitVariableExpr(expr *syntax.Variable) syntax.Result {
 func (r *Resolver) resolveLocal(expr syntax.Expr, name syntax.Token) {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		if info, ok := r.scopes[i][name.Lexeme]; ok {
-			info.used = true
 			r.interpreter.resolve(expr, len(r.scopes)-1-i, info.idx)
+			r.symbols.use(info.symbol, name)
 			return
 		}
 	}
+	r.symbols.useGlobal(name)
 }
 
 func (r *Resolver) VisitAssignExpr(expr *syntax.Assign) syntax.Result {
@@ -193,10 +207,7 @@ func (r *Resolver) VisitAssignExpr(expr *syntax.Assign) syntax.Result {
 func (r *Resolver) VisitFunctionStmt(stmt *syntax.Function) error {
 	if !stmt.Name.IsEmpty() {
 		// means it is not anonymous function
-		err := r.declare(stmt.Name)
-		if err != nil {
-			return err
-		}
+		r.declare(stmt.Name, SymbolFunction)
 		r.define(stmt.Name)
 	}
 	return r.resolveFunctionStmt(stmt, FuncTypeFunction)
@@ -208,18 +219,13 @@ func (r *Resolver) resolveFunctionStmt(f *syntax.Function, funcType FuncType) er
 	defer func() { r.curFuncType = enclosingFunc }()
 	r.beginScope()
 	for _, param := range f.Params {
-		err := r.declare(param)
-		if err != nil {
-			return err
-		}
+		r.declare(param, SymbolParameter)
 		r.define(param)
 	}
 	if err := r.resolveStmts(f.Body); err != nil {
 		return err
 	}
-	if err := r.endScope(); err != nil {
-		return err
-	}
+	r.endScope()
 	return nil
 }
 
@@ -257,13 +263,11 @@ func (r *Resolver) VisitPrintStmt(stmt *syntax.Print) error {
 
 func (r *Resolver) VisitReturnStmt(stmt *syntax.Return) error {
 	if r.curFuncType == FuncTypeNone {
-		r.resolveErr = fmt.Errorf("can't return from top-level code")
-		return r.resolveErr
+		r.error(stmt.Keyword, "can't return from top-level code")
 	}
 	if stmt.Value != nil {
 		if r.curFuncType == FuncTypeInitializer {
-			r.resolveErr = fmt.Errorf("can't return a value from an initializer")
-			return r.resolveErr
+			r.error(stmt.Keyword, "can't return a value from an initializer")
 		}
 		result := r.resolveExpr(stmt.Value)
 		if result.Err != nil {
@@ -273,6 +277,22 @@ func (r *Resolver) VisitReturnStmt(stmt *syntax.Return) error {
 	return nil
 }
 
+// VisitForInStmt resolves the loop variable in a scope of its own, which the
+// interpreter creates anew for each element.
+func (r *Resolver) VisitForInStmt(stmt *syntax.ForIn) error {
+	if result := r.resolveExpr(stmt.Iterable); result.Err != nil {
+		return result.Err
+	}
+	r.beginScope()
+	r.declare(stmt.Name, SymbolVariable)
+	r.define(stmt.Name)
+	if err := r.resolveStmt(stmt.Body); err != nil {
+		return err
+	}
+	r.endScope()
+	return nil
+}
+
 func (r *Resolver) VisitWhileStmt(stmt *syntax.While) error {
 	result := r.resolveExpr(stmt.Condition)
 	if result.Err != nil {
@@ -284,6 +304,34 @@ func (r *Resolver) VisitWhileStmt(stmt *syntax.While) error {
 	return nil
 }
 
+func (r *Resolver) VisitThrowStmt(stmt *syntax.Throw) error {
+	if result := r.resolveExpr(stmt.Value); result.Err != nil {
+		return result.Err
+	}
+	return nil
+}
+
+// VisitTryStmt resolves the catch variable in a scope of its own around the
+// handler.
+func (r *Resolver) VisitTryStmt(stmt *syntax.Try) error {
+	if err := r.resolveStmt(stmt.Body); err != nil {
+		return err
+	}
+	if stmt.Handler != nil {
+		r.beginScope()
+		r.declare(stmt.Name, SymbolVariable)
+		r.define(stmt.Name)
+		if err := r.resolveStmt(stmt.Handler); err != nil {
+			return err
+		}
+		r.endScope()
+	}
+	if stmt.Finally != nil {
+		return r.resolveStmt(stmt.Finally)
+	}
+	return nil
+}
+
 func (r *Resolver) VisitBreakStmt(stmt *syntax.Break) error {
 	return nil
 }
@@ -296,12 +344,10 @@ func (r *Resolver) VisitClassStmt(stmt *syntax.Class) error {
 	enclosingClass := r.curClassType
 	r.curClassType = ClassTypeClass
 	defer func() { r.curClassType = enclosingClass }()
-	if err := r.declare(stmt.Name); err != nil {
-		return err
-	}
+	r.declare(stmt.Name, SymbolClass)
 	r.define(stmt.Name)
 	if stmt.Superclass != nil && stmt.Name.Lexeme == stmt.Superclass.Name.Lexeme {
-		return fmt.Errorf("class %s can't inherit from itself", stmt.Name.Lexeme)
+		r.error(stmt.Superclass.Name, fmt.Sprintf("class %s can't inherit from itself", stmt.Name.Lexeme))
 	}
 	if stmt.Superclass != nil {
 		r.curClassType = ClassTypeSubclass
@@ -310,16 +356,12 @@ func (r *Resolver) VisitClassStmt(stmt *syntax.Class) error {
 		}
 		r.beginScope()
 		super := syntax.NewToken(syntax.TOKEN_SUPER, "super", nil, stmt.Superclass.Name.Line, stmt.Superclass.Name.Pos)
-		if err := r.declare(super); err != nil {
-			return err
-		}
+		r.declare(super, SymbolVariable)
 		r.define(super)
 	}
 	r.beginScope()
 	mockThis := syntax.NewToken(syntax.TOKEN_THIS, "this", nil, stmt.Name.Line, stmt.Name.Pos)
-	if err := r.declare(mockThis); err != nil {
-		return err
-	}
+	r.declare(mockThis, SymbolVariable)
 	r.define(mockThis)
 	for _, method := range stmt.Methods {
 		funcType := FuncType(FuncTypeMethod)
@@ -330,13 +372,9 @@ func (r *Resolver) VisitClassStmt(stmt *syntax.Class) error {
 			return err
 		}
 	}
-	if err := r.endScope(); err != nil {
-		return err
-	}
+	r.endScope()
 	if stmt.Superclass != nil {
-		if err := r.endScope(); err != nil {
-			return err
-		}
+		r.endScope()
 	}
 	return nil
 }
@@ -436,9 +474,57 @@ func (r *Resolver) VisitSetExpr(expr *syntax.Set) syntax.Result {
 	return r.resolveExpr(expr.Object)
 }
 
+func (r *Resolver) VisitListExpr(expr *syntax.List) syntax.Result {
+	for _, element := range expr.Elements {
+		if result := r.resolveExpr(element); result.Err != nil {
+			return result
+		}
+	}
+	return syntax.Result{}
+}
+
+func (r *Resolver) VisitInterpolationExpr(expr *syntax.Interpolation) syntax.Result {
+	for _, part := range expr.Parts {
+		if result := r.resolveExpr(part); result.Err != nil {
+			return result
+		}
+	}
+	return syntax.Result{}
+}
+
+func (r *Resolver) VisitMapExpr(expr *syntax.Map) syntax.Result {
+	for idx := range expr.Keys {
+		if result := r.resolveExpr(expr.Keys[idx]); result.Err != nil {
+			return result
+		}
+		if result := r.resolveExpr(expr.Values[idx]); result.Err != nil {
+			return result
+		}
+	}
+	return syntax.Result{}
+}
+
+func (r *Resolver) VisitIndexExpr(expr *syntax.Index) syntax.Result {
+	if result := r.resolveExpr(expr.Object); result.Err != nil {
+		return result
+	}
+	return r.resolveExpr(expr.Index)
+}
+
+func (r *Resolver) VisitIndexSetExpr(expr *syntax.IndexSet) syntax.Result {
+	if result := r.resolveExpr(expr.Value); result.Err != nil {
+		return result
+	}
+	if result := r.resolveExpr(expr.Object); result.Err != nil {
+		return result
+	}
+	return r.resolveExpr(expr.Index)
+}
+
 func (r *Resolver) VisitThisExpr(expr *syntax.This) syntax.Result {
 	if r.curClassType == ClassTypeNone {
-		return syntax.Result{Err: fmt.Errorf("can't use 'this' outside of a class")}
+		r.error(expr.Keyword, "can't use 'this' outside of a class")
+		return syntax.Result{}
 	}
 	r.resolveLocal(expr, expr.Keyword)
 	return syntax.Result{}
@@ -446,9 +532,11 @@ func (r *Resolver) VisitThisExpr(expr *syntax.This) syntax.Result {
 
 func (r *Resolver) VisitSuperExpr(expr *syntax.Super) syntax.Result {
 	if r.curClassType == ClassTypeNone {
-		return syntax.Result{Err: fmt.Errorf("can't use 'super' outside of a class")}
+		r.error(expr.Keyword, "can't use 'super' outside of a class")
+		return syntax.Result{}
 	} else if r.curClassType != ClassTypeSubclass {
-		return syntax.Result{Err: fmt.Errorf("can't use 'super' in a class with no superclass")}
+		r.error(expr.Keyword, "can't use 'super' in a class with no superclass")
+		return syntax.Result{}
 	}
 	r.resolveLocal(expr, expr.Keyword)
 	return syntax.Result{}
@@ -0,0 +1,74 @@
+package interpreter
+
+import (
+	"errors"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// scriptFrame names the top-level code in tracebacks.
+const scriptFrame = "<script>"
+
+// RuntimeError is a runtime error raised while executing Lox code. Stack
+// holds the Lox call stack at the point the error was raised, innermost
+// call first.
+type RuntimeError struct {
+	*util.Diagnostic
+	Value any   // the thrown value of an uncaught throw statement
+	cause error // ErrCancelled or ErrBudgetExceeded for an interrupted run
+}
+
+func (e *RuntimeError) Unwrap() []error {
+	if e.cause != nil {
+		return []error{e.Diagnostic, e.cause}
+	}
+	return []error{e.Diagnostic}
+}
+
+// callFrame is an active call of a Lox function or class.
+type callFrame struct {
+	function string
+	line     int // of the closing paren of the call
+	offset   int
+}
+
+// frameName returns the name callee is shown with in tracebacks. Native
+// functions get no frame of their own, their errors point at the call site.
+func frameName(callee Callable) (string, bool) {
+	switch fn := callee.(type) {
+	case *LoxFunction:
+		if fn.declaration.Name.IsEmpty() {
+			return "<anonymous>", true
+		}
+		return fn.declaration.Name.Lexeme, true
+	case *LoxClass:
+		return fn.name, true
+	}
+	return "", false
+}
+
+// withStack turns err into a *RuntimeError carrying the current call stack,
+// unless it already carries one.
+func (a *Interpreter) withStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		runtimeErr = &RuntimeError{Diagnostic: util.AsDiagnostic(err)}
+		err = runtimeErr
+	}
+	if runtimeErr.Stack != nil {
+		return err
+	}
+	d := runtimeErr.Diagnostic
+	stack := make([]util.Frame, 0, len(a.frames)+1)
+	line, offset := d.Line, d.Offset
+	for idx := len(a.frames) - 1; idx >= 0; idx-- {
+		frame := a.frames[idx]
+		stack = append(stack, util.Frame{Function: frame.function, Line: line, Offset: offset})
+		line, offset = frame.line, frame.offset
+	}
+	d.Stack = append(stack, util.Frame{Function: scriptFrame, Line: line, Offset: offset})
+	return err
+}
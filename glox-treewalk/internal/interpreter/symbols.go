@@ -0,0 +1,162 @@
+package interpreter
+
+import "github.com/littlekuo/glox-treewalk/internal/syntax"
+
+// SymbolKind is the kind of declaration that introduced a name.
+type SymbolKind int
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolParameter
+	SymbolFunction
+	SymbolClass
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolParameter:
+		return "parameter"
+	case SymbolFunction:
+		return "function"
+	case SymbolClass:
+		return "class"
+	}
+	return "variable"
+}
+
+// Symbol is a variable, function or class declared in a program, with the
+// uses the resolver bound to it.
+type Symbol struct {
+	Name  syntax.Token
+	Kind  SymbolKind
+	Scope *Scope         // nil for a global
+	Refs  []syntax.Token // the uses of the name, and redeclarations of a global
+}
+
+// Scope is a local scope. The scope extends at least to End, the offset
+// just past the last token the resolver met directly in it, and usually
+// further, to its closing brace.
+type Scope struct {
+	Parent *Scope
+	End    int
+}
+
+// Symbols is the scope analysis of a program: what each name refers to.
+// A resolver only collects it once RecordSymbols is called.
+type Symbols struct {
+	Decls   []*Symbol      // in the order of declaration
+	Unbound []syntax.Token // uses of names the program doesn't declare, like natives
+	globals map[string]*Symbol
+	pending map[string][]syntax.Token // uses of globals not declared yet
+	scope   *Scope
+}
+
+// RecordSymbols makes the resolver collect the symbols of the programs it
+// resolves from now on, and returns them.
+func (r *Resolver) RecordSymbols() *Symbols {
+	r.symbols = &Symbols{
+		globals: make(map[string]*Symbol),
+		pending: make(map[string][]syntax.Token),
+	}
+	return r.symbols
+}
+
+// At returns the symbol declared or used at offset, and the token there.
+// The symbol is nil for a use of an undeclared name.
+func (s *Symbols) At(offset int) (*Symbol, syntax.Token, bool) {
+	covers := func(token syntax.Token) bool {
+		return token.Pos <= offset && offset <= token.Pos+len(token.Lexeme)
+	}
+	for _, symbol := range s.Decls {
+		if covers(symbol.Name) {
+			return symbol, symbol.Name, true
+		}
+		for _, ref := range symbol.Refs {
+			if covers(ref) {
+				return symbol, ref, true
+			}
+		}
+	}
+	for _, token := range s.Unbound {
+		if covers(token) {
+			return nil, token, true
+		}
+	}
+	return nil, syntax.Token{}, false
+}
+
+func (s *Symbols) beginScope() {
+	if s != nil {
+		s.scope = &Scope{Parent: s.scope}
+	}
+}
+
+func (s *Symbols) endScope() {
+	if s != nil {
+		s.scope = s.scope.Parent
+	}
+}
+
+// see extends the innermost scope to the end of token.
+func (s *Symbols) see(token syntax.Token) {
+	if s.scope != nil {
+		s.scope.End = max(s.scope.End, token.Pos+len(token.Lexeme))
+	}
+}
+
+// declare records a declaration in the innermost scope, or a global one if
+// there is none. The names the resolver makes up for 'this' and 'super'
+// aren't symbols.
+func (s *Symbols) declare(name syntax.Token, kind SymbolKind) *Symbol {
+	if s == nil || name.TokenType != syntax.TOKEN_IDENTIFIER {
+		return nil
+	}
+	if s.scope == nil {
+		if symbol, ok := s.globals[name.Lexeme]; ok {
+			symbol.Refs = append(symbol.Refs, name)
+			return symbol
+		}
+	}
+	s.see(name)
+	symbol := &Symbol{Name: name, Kind: kind, Scope: s.scope}
+	s.Decls = append(s.Decls, symbol)
+	if s.scope == nil {
+		s.globals[name.Lexeme] = symbol
+		symbol.Refs = append(symbol.Refs, s.pending[name.Lexeme]...)
+		delete(s.pending, name.Lexeme)
+	}
+	return symbol
+}
+
+// use records a use of a local symbol.
+func (s *Symbols) use(symbol *Symbol, name syntax.Token) {
+	if s == nil || symbol == nil {
+		return
+	}
+	s.see(name)
+	symbol.Refs = append(symbol.Refs, name)
+}
+
+// useGlobal records a use of a name that isn't declared in any scope.
+func (s *Symbols) useGlobal(name syntax.Token) {
+	if s == nil || name.TokenType != syntax.TOKEN_IDENTIFIER {
+		return
+	}
+	s.see(name)
+	if global, ok := s.globals[name.Lexeme]; ok {
+		global.Refs = append(global.Refs, name)
+	} else {
+		s.pending[name.Lexeme] = append(s.pending[name.Lexeme], name)
+	}
+}
+
+// finish leaves the uses of globals that were never declared unbound.
+func (s *Symbols) finish() {
+	if s == nil {
+		return
+	}
+	for name, uses := range s.pending {
+		s.Unbound = append(s.Unbound, uses...)
+		delete(s.pending, name)
+	}
+}
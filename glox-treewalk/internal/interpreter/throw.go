@@ -0,0 +1,82 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/littlekuo/glox-treewalk/internal/stdlib"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// errorClass is the class of the error instances created by Error() and of
+// the runtime errors caught by a catch clause. They have the fields message,
+// line and stack, the latter a list of traceback lines, innermost first.
+var errorClass = NewLoxClass("Error", nil, map[string]*LoxFunction{})
+
+func newErrorInstance(message string, line any, stack any) *LoxInstance {
+	instance := NewLoxInstance(errorClass)
+	instance.fields["message"] = message
+	instance.fields["line"] = line
+	instance.fields["stack"] = stack
+	return instance
+}
+
+// newError implements Error(message). Line and stack are filled in when the
+// error is thrown.
+func newError(args []any) (any, error) {
+	return newErrorInstance(stdlib.ErrorMessage(args[0]), nil, nil), nil
+}
+
+func isErrorInstance(value any) (*LoxInstance, bool) {
+	instance, ok := value.(*LoxInstance)
+	return instance, ok && instance.loxClass == errorClass
+}
+
+// throw raises value as a RuntimeError with the code CodeThrow, which a
+// catch clause turns back into value.
+func (a *Interpreter) throw(keyword syntax.Token, value any) error {
+	message := fmt.Sprintf("uncaught exception: %v", value)
+	instance, isError := isErrorInstance(value)
+	if isError {
+		message = fmt.Sprintf("uncaught Error: %v", instance.fields["message"])
+	}
+	err := a.withStack(&RuntimeError{Diagnostic: syntax.ErrorAt(keyword, util.CodeThrow, message), Value: value})
+	if isError && instance.fields["line"] == nil {
+		instance.fields["line"] = float64(keyword.Line)
+		instance.fields["stack"] = stackList(err.(*RuntimeError).Stack)
+	}
+	return err
+}
+
+// catch returns the value a catch clause binds for err. Control flow, and
+// runs interrupted by cancellation or a budget, can't be caught.
+func (a *Interpreter) catch(err error) (any, bool) {
+	if err == nil || errors.Is(err, errBreak) || errors.Is(err, errContinue) {
+		return nil, false
+	}
+	var ret *ErrReturn
+	if errors.As(err, &ret) {
+		return nil, false
+	}
+	var runtimeErr *RuntimeError
+	if !errors.As(a.withStack(err), &runtimeErr) || runtimeErr.cause != nil {
+		return nil, false
+	}
+	if runtimeErr.Code == util.CodeThrow {
+		return runtimeErr.Value, true
+	}
+	var line any
+	if runtimeErr.Line > 0 {
+		line = float64(runtimeErr.Line)
+	}
+	return newErrorInstance(runtimeErr.Message, line, stackList(runtimeErr.Stack)), true
+}
+
+func stackList(stack []util.Frame) *LoxList {
+	frames := make([]any, 0, len(stack))
+	for _, frame := range stack {
+		frames = append(frames, frame.String())
+	}
+	return NewLoxList(frames)
+}
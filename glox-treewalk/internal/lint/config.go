@@ -0,0 +1,120 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rule IDs
+const (
+	RuleUnusedVariable        = "unused-variable"
+	RuleUnusedParameter       = "unused-parameter"
+	RuleUnreachableCode       = "unreachable-code"
+	RuleShadowing             = "shadowing"
+	RuleSelfComparison        = "self-comparison"
+	RuleAssignmentInCondition = "assignment-in-condition"
+	RuleEmptyBlock            = "empty-block"
+	RuleWrongArity            = "wrong-arity"
+)
+
+// Rule is a check of the linter. Its ID is the code of the warnings it
+// reports and the name it is enabled or disabled by.
+type Rule struct {
+	ID          string
+	Description string
+}
+
+// Rules lists every rule of the linter.
+var Rules = []Rule{
+	{RuleUnusedVariable, "a local variable, function or class that is never read"},
+	{RuleUnusedParameter, "a parameter that is never read"},
+	{RuleUnreachableCode, "statements after return, break, continue or throw"},
+	{RuleShadowing, "a declaration that hides a variable of an enclosing scope"},
+	{RuleSelfComparison, "an operand compared with itself"},
+	{RuleAssignmentInCondition, "an assignment used as the condition of if, while or for"},
+	{RuleEmptyBlock, "a block with neither statements nor comments"},
+	{RuleWrongArity, "a call of a known global function or class with the wrong number of arguments"},
+}
+
+// ConfigFile is the name of the configuration file searched for by FindConfig.
+const ConfigFile = ".loxlint.json"
+
+// Config selects the rules to run. Rules missing from Rules are enabled.
+//
+//	{"rules": {"shadowing": false, "unused-parameter": false}}
+type Config struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+// DefaultConfig returns a configuration that enables every rule.
+func DefaultConfig() *Config {
+	return &Config{Rules: make(map[string]bool)}
+}
+
+// LoadConfig reads the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for id := range config.Rules {
+		if !IsRule(id) {
+			return nil, fmt.Errorf("%s: unknown rule %q", path, id)
+		}
+	}
+	return config, nil
+}
+
+// FindConfig returns the path of the configuration file in dir or the
+// nearest of its parents, or "" if there is none.
+func FindConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Set enables or disables the rules of a comma-separated list of IDs.
+func (c *Config) Set(ids string, enabled bool) error {
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !IsRule(id) {
+			return fmt.Errorf("unknown rule %q", id)
+		}
+		c.Rules[id] = enabled
+	}
+	return nil
+}
+
+// Enabled reports whether the rule with the given ID runs.
+func (c *Config) Enabled(id string) bool {
+	enabled, ok := c.Rules[id]
+	return !ok || enabled
+}
+
+// IsRule reports whether id names a rule.
+func IsRule(id string) bool {
+	return slices.ContainsFunc(Rules, func(rule Rule) bool { return rule.ID == id })
+}
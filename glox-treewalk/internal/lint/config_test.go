@@ -0,0 +1,110 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "project", "src", "lib")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// a configuration above the temporary directory isn't ours to test
+	if got := FindConfig(nested); strings.HasPrefix(got, root) {
+		t.Errorf("found %s before writing one", got)
+	}
+
+	project := filepath.Join(root, "project", ConfigFile)
+	writeFile(t, project, `{"rules": {}}`)
+	if got := FindConfig(nested); got != project {
+		t.Errorf("from %s: got %q, want %q", nested, got, project)
+	}
+
+	// the nearest configuration wins
+	src := filepath.Join(root, "project", "src", ConfigFile)
+	writeFile(t, src, `{"rules": {}}`)
+	if got := FindConfig(nested); got != src {
+		t.Errorf("from %s: got %q, want %q", nested, got, src)
+	}
+	if got := FindConfig(filepath.Join(root, "project")); got != project {
+		t.Errorf("from the project: got %q, want %q", got, project)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string
+		disabled []string
+		wantErr  bool
+	}{
+		{"rules", `{"rules": {"shadowing": false, "unused-parameter": false, "empty-block": true}}`,
+			[]string{RuleShadowing, RuleUnusedParameter}, false},
+		{"no rules", `{}`, nil, false},
+		{"unknown rule", `{"rules": {"no-such-rule": false}}`, nil, true},
+		{"invalid JSON", `{"rules": `, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name+".json")
+			writeFile(t, path, test.content)
+			config, err := LoadConfig(path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, rule := range Rules {
+				disabled := false
+				for _, id := range test.disabled {
+					disabled = disabled || id == rule.ID
+				}
+				if config.Enabled(rule.ID) == disabled {
+					t.Errorf("%s: enabled is %v", rule.ID, !disabled)
+				}
+			}
+		})
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file: want an error")
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	config := DefaultConfig()
+	config.Rules[RuleShadowing] = false
+	if err := config.Set("shadowing, empty-block", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set("wrong-arity,,", false); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Enabled(RuleShadowing) || !config.Enabled(RuleEmptyBlock) {
+		t.Error("--enable didn't enable shadowing and empty-block")
+	}
+	if config.Enabled(RuleWrongArity) {
+		t.Error("--disable didn't disable wrong-arity")
+	}
+	if err := config.Set("shadowing,nope", false); err == nil {
+		t.Error("unknown rule: want an error")
+	}
+}
@@ -0,0 +1,520 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// Source lints Lox source code. Source that doesn't scan or parse is not
+// linted; its diagnostics are reported through opts.
+func Source(source string, config *Config, opts ...util.Option) ([]*util.Diagnostic, error) {
+	opts = append(opts, util.WithComments())
+	scanner := syntax.NewScanner(source, opts...)
+	tokens := scanner.ScanTokens()
+	if err := scanner.GetError(); err != nil {
+		return nil, err
+	}
+	parser := syntax.NewParser(tokens, opts...)
+	stmts := parser.Parse()
+	if err := parser.GetError(); err != nil {
+		return nil, err
+	}
+	return NewLinter(config, parser.Comments()).Lint(stmts), nil
+}
+
+// binding is a name declared in a scope.
+type binding struct {
+	name syntax.Token
+	kind string // "variable", "function", "class" or "parameter"; "" if it needn't be used
+	used bool
+}
+
+// Linter checks a parsed program against the enabled rules. Warnings are
+// diagnostics with util.SeverityWarning whose code is the ID of the rule.
+type Linter struct {
+	config   *Config
+	comments *syntax.Comments
+	arities  map[string]int // of the known global callables, VariadicArity if unknown
+	scopes   [][]*binding   // the top level first
+	warnings []*util.Diagnostic
+}
+
+// NewLinter returns a linter for a program parsed with the given comments,
+// which may be nil. Without them, unreachable code is reported at the
+// statement that jumps over it.
+func NewLinter(config *Config, comments *syntax.Comments) *Linter {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if comments == nil {
+		comments = &syntax.Comments{Stmts: make(map[syntax.Stmt]*syntax.Trivia)}
+	}
+	return &Linter{config: config, comments: comments}
+}
+
+// Lint returns the warnings for stmts, in source order.
+func (l *Linter) Lint(stmts []syntax.Stmt) []*util.Diagnostic {
+	l.arities = globalArities(stmts)
+	l.scopes = [][]*binding{nil}
+	l.warnings = nil
+	l.stmts(stmts)
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		return l.warnings[i].Offset < l.warnings[j].Offset
+	})
+	return l.warnings
+}
+
+// globalArities returns the arities of the native functions and of the
+// functions and classes declared at the top level of stmts.
+func globalArities(stmts []syntax.Stmt) map[string]int {
+	arities := make(map[string]int)
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.Function:
+			setArity(arities, stmt.Name.Lexeme, len(stmt.Params))
+		case *syntax.Class:
+			setArity(arities, stmt.Name.Lexeme, classArity(stmt))
+		case *syntax.Var:
+			arities[stmt.Name.Lexeme] = interpreter.VariadicArity
+		}
+	}
+	for name, value := range interpreter.NewInterpreter().Globals() {
+		if _, ok := arities[name]; ok {
+			continue // re-defined by the script
+		}
+		if callable, ok := value.(interpreter.Callable); ok {
+			arities[name] = callable.Arity()
+		}
+	}
+	return arities
+}
+
+// setArity records the arity of a global declared at the top level. A name
+// declared twice has no known arity.
+func setArity(arities map[string]int, name string, arity int) {
+	if _, ok := arities[name]; ok {
+		arity = interpreter.VariadicArity
+	}
+	arities[name] = arity
+}
+
+// classArity returns the arity of a class, unknown if it may inherit its
+// initializer.
+func classArity(class *syntax.Class) int {
+	for _, method := range class.Methods {
+		if method.Name.Lexeme == "init" {
+			return len(method.Params)
+		}
+	}
+	if class.Superclass != nil {
+		return interpreter.VariadicArity
+	}
+	return 0
+}
+
+func (l *Linter) warn(rule string, token syntax.Token, message string) {
+	if !l.config.Enabled(rule) {
+		return
+	}
+	d := syntax.ErrorAt(token, rule, message)
+	d.Severity = util.SeverityWarning
+	l.warnings = append(l.warnings, d)
+}
+
+func (l *Linter) beginScope() {
+	l.scopes = append(l.scopes, nil)
+}
+
+// endScope reports the bindings of the innermost scope that were never read.
+func (l *Linter) endScope() {
+	scope := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+	for _, b := range scope {
+		if b.used || b.kind == "" {
+			continue
+		}
+		if b.kind == "parameter" {
+			l.warn(RuleUnusedParameter, b.name, fmt.Sprintf("parameter '%s' is never used", b.name.Lexeme))
+		} else {
+			l.warn(RuleUnusedVariable, b.name, fmt.Sprintf("local %s '%s' is never used", b.kind, b.name.Lexeme))
+		}
+	}
+}
+
+// declare adds name to the innermost scope. Names starting with '_' are
+// meant to be unused and may shadow others.
+func (l *Linter) declare(name syntax.Token, kind string) {
+	if strings.HasPrefix(name.Lexeme, "_") {
+		kind = ""
+	} else if len(l.scopes) > 1 {
+		if shadowed := l.lookup(name.Lexeme); shadowed != nil {
+			l.warn(RuleShadowing, name, fmt.Sprintf("'%s' shadows the declaration on line %d",
+				name.Lexeme, shadowed.name.Line))
+		}
+	}
+	scope := &l.scopes[len(l.scopes)-1]
+	*scope = append(*scope, &binding{name: name, kind: kind})
+}
+
+// lookup returns the innermost binding of name, nil if it's undeclared.
+func (l *Linter) lookup(name string) *binding {
+	_, b := l.resolve(name)
+	return b
+}
+
+// resolve returns the innermost binding of name and the depth of its scope,
+// 0 for the top level.
+func (l *Linter) resolve(name string) (int, *binding) {
+	for depth := len(l.scopes) - 1; depth >= 0; depth-- {
+		scope := l.scopes[depth]
+		for idx := len(scope) - 1; idx >= 0; idx-- {
+			if scope[idx].name.Lexeme == name {
+				return depth, scope[idx]
+			}
+		}
+	}
+	return 0, nil
+}
+
+// stmts lints a list of statements, reporting the ones that follow a jump.
+func (l *Linter) stmts(stmts []syntax.Stmt) {
+	reported := false
+	for idx, stmt := range stmts {
+		l.stmt(stmt)
+		if reported || idx == len(stmts)-1 {
+			continue
+		}
+		if keyword, ok := jump(stmt); ok {
+			l.warn(RuleUnreachableCode, l.first(stmts[idx+1], keyword),
+				fmt.Sprintf("code after '%s' is unreachable", keyword.Lexeme))
+			reported = true
+		}
+	}
+}
+
+// first returns the first token of stmt, which is only known from its
+// comments; fallback stands in for it in a program parsed without them.
+func (l *Linter) first(stmt syntax.Stmt, fallback syntax.Token) syntax.Token {
+	if trivia, ok := l.comments.Stmts[stmt]; ok && trivia.First.Lexeme != "" {
+		return trivia.First
+	}
+	return fallback
+}
+
+// jump returns the keyword of a statement that never completes normally.
+func jump(stmt syntax.Stmt) (syntax.Token, bool) {
+	switch stmt := stmt.(type) {
+	case *syntax.Return:
+		return stmt.Keyword, true
+	case *syntax.Break:
+		return stmt.Keyword, true
+	case *syntax.Continue:
+		return stmt.Keyword, true
+	case *syntax.Throw:
+		return stmt.Keyword, true
+	}
+	return syntax.Token{}, false
+}
+
+func (l *Linter) stmt(stmt syntax.Stmt) {
+	if stmt != nil {
+		stmt.Accept(l)
+	}
+}
+
+func (l *Linter) expr(expr syntax.Expr) {
+	if expr != nil {
+		expr.Accept(l)
+	}
+}
+
+func (l *Linter) block(block *syntax.Block) {
+	if len(block.Statements) == 0 {
+		if trivia := l.comments.Stmts[block]; trivia == nil || len(trivia.Inner) == 0 && len(trivia.Header) == 0 {
+			l.warn(RuleEmptyBlock, block.Brace, "empty block")
+		}
+	}
+	l.beginScope()
+	l.stmts(block.Statements)
+	l.endScope()
+}
+
+// condition lints the condition of an if, while or for statement.
+func (l *Linter) condition(expr syntax.Expr) {
+	l.expr(expr)
+	var target syntax.Token
+	switch expr := expr.(type) {
+	case *syntax.Assign:
+		target = expr.Name
+	case *syntax.Set:
+		target = expr.Name
+	case *syntax.IndexSet:
+		target = expr.Bracket
+	default:
+		return
+	}
+	l.warn(RuleAssignmentInCondition, target,
+		"assignment used as a condition; compare with '==' or wrap the assignment in parentheses")
+}
+
+func (l *Linter) function(decl *syntax.Function) {
+	l.beginScope()
+	for _, param := range decl.Params {
+		l.declare(param, "parameter")
+	}
+	l.stmts(decl.Body)
+	l.endScope()
+}
+
+func (l *Linter) VisitBlockStmt(stmt *syntax.Block) error {
+	l.block(stmt)
+	return nil
+}
+
+func (l *Linter) VisitExpressionStmt(stmt *syntax.Expression) error {
+	l.expr(stmt.Expression)
+	return nil
+}
+
+func (l *Linter) VisitPrintStmt(stmt *syntax.Print) error {
+	l.expr(stmt.Expression)
+	return nil
+}
+
+func (l *Linter) VisitVarStmt(stmt *syntax.Var) error {
+	l.expr(stmt.Initializer)
+	l.declare(stmt.Name, "variable")
+	return nil
+}
+
+func (l *Linter) VisitFunctionStmt(stmt *syntax.Function) error {
+	l.declare(stmt.Name, "function")
+	l.function(stmt)
+	return nil
+}
+
+func (l *Linter) VisitIfStmt(stmt *syntax.If) error {
+	l.condition(stmt.Condition)
+	l.stmt(stmt.Thenbranch)
+	if stmt.Elsebranch != nil {
+		l.stmt(stmt.Elsebranch)
+	}
+	return nil
+}
+
+func (l *Linter) VisitWhileStmt(stmt *syntax.While) error {
+	l.condition(stmt.Condition)
+	l.stmt(stmt.Body)
+	return nil
+}
+
+func (l *Linter) VisitReturnStmt(stmt *syntax.Return) error {
+	l.expr(stmt.Value)
+	return nil
+}
+
+func (l *Linter) VisitBreakStmt(stmt *syntax.Break) error {
+	return nil
+}
+
+func (l *Linter) VisitForDesugaredWhileStmt(stmt *syntax.ForDesugaredWhile) error {
+	l.condition(stmt.Condition)
+	l.stmt(stmt.Body)
+	l.expr(stmt.Increment)
+	return nil
+}
+
+func (l *Linter) VisitForInStmt(stmt *syntax.ForIn) error {
+	l.expr(stmt.Iterable)
+	l.beginScope()
+	l.declare(stmt.Name, "variable")
+	l.stmt(stmt.Body)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitContinueStmt(stmt *syntax.Continue) error {
+	return nil
+}
+
+func (l *Linter) VisitClassStmt(stmt *syntax.Class) error {
+	l.declare(stmt.Name, "class")
+	if stmt.Superclass != nil {
+		l.expr(stmt.Superclass)
+	}
+	for _, method := range stmt.Methods {
+		l.function(method)
+	}
+	return nil
+}
+
+func (l *Linter) VisitThrowStmt(stmt *syntax.Throw) error {
+	l.expr(stmt.Value)
+	return nil
+}
+
+func (l *Linter) VisitTryStmt(stmt *syntax.Try) error {
+	l.block(stmt.Body)
+	if stmt.Handler != nil {
+		l.beginScope()
+		l.declare(stmt.Name, "")
+		l.block(stmt.Handler)
+		l.endScope()
+	}
+	if stmt.Finally != nil {
+		l.block(stmt.Finally)
+	}
+	return nil
+}
+
+func (l *Linter) VisitAssignExpr(expr *syntax.Assign) syntax.Result {
+	l.expr(expr.Value)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitLogicalExpr(expr *syntax.Logical) syntax.Result {
+	l.expr(expr.Left)
+	l.expr(expr.Right)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitBinaryExpr(expr *syntax.Binary) syntax.Result {
+	l.expr(expr.Left)
+	l.expr(expr.Right)
+	switch expr.Operator.TokenType {
+	case syntax.TOKEN_EQUAL_EQUAL, syntax.TOKEN_BANG_EQUAL,
+		syntax.TOKEN_LESS, syntax.TOKEN_LESS_EQUAL, syntax.TOKEN_GREATER, syntax.TOKEN_GREATER_EQUAL:
+		if pure(expr.Left) && pure(expr.Right) {
+			if left := syntax.FormatExpr(expr.Left); left == syntax.FormatExpr(expr.Right) {
+				l.warn(RuleSelfComparison, expr.Operator, fmt.Sprintf("'%s' is compared with itself", left))
+			}
+		}
+	}
+	return syntax.Result{}
+}
+
+// pure reports whether expr reads a variable, property or element without
+// side effects, so that it has the same value on both sides of a comparison.
+func pure(expr syntax.Expr) bool {
+	switch expr := expr.(type) {
+	case *syntax.Variable, *syntax.This:
+		return true
+	case *syntax.Get:
+		return pure(expr.Object)
+	case *syntax.Index:
+		return pure(expr.Object) && (pure(expr.Index) || isLiteral(expr.Index))
+	case *syntax.Grouping:
+		return pure(expr.Expression)
+	}
+	return false
+}
+
+func isLiteral(expr syntax.Expr) bool {
+	_, ok := expr.(*syntax.Literal)
+	return ok
+}
+
+func (l *Linter) VisitUnaryExpr(expr *syntax.Unary) syntax.Result {
+	l.expr(expr.Right)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitCallExpr(expr *syntax.Call) syntax.Result {
+	l.expr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		l.expr(argument)
+	}
+	callee, ok := expr.Callee.(*syntax.Variable)
+	if !ok {
+		return syntax.Result{}
+	}
+	if depth, b := l.resolve(callee.Name.Lexeme); b != nil && depth > 0 {
+		return syntax.Result{}
+	}
+	arity, ok := l.arities[callee.Name.Lexeme]
+	if ok && arity != interpreter.VariadicArity && arity != len(expr.Arguments) {
+		l.warn(RuleWrongArity, expr.Paren, fmt.Sprintf("wrong number of arguments to '%s': want=%d, got=%d",
+			callee.Name.Lexeme, arity, len(expr.Arguments)))
+	}
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitGetExpr(expr *syntax.Get) syntax.Result {
+	l.expr(expr.Object)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitSetExpr(expr *syntax.Set) syntax.Result {
+	l.expr(expr.Object)
+	l.expr(expr.Value)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitSuperExpr(expr *syntax.Super) syntax.Result {
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitThisExpr(expr *syntax.This) syntax.Result {
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitGroupingExpr(expr *syntax.Grouping) syntax.Result {
+	l.expr(expr.Expression)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitLiteralExpr(expr *syntax.Literal) syntax.Result {
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitVariableExpr(expr *syntax.Variable) syntax.Result {
+	if b := l.lookup(expr.Name.Lexeme); b != nil {
+		b.used = true
+	}
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitAnonymousFunctionExpr(expr *syntax.AnonymousFunction) syntax.Result {
+	l.function(expr.Decl)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitListExpr(expr *syntax.List) syntax.Result {
+	for _, element := range expr.Elements {
+		l.expr(element)
+	}
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitIndexExpr(expr *syntax.Index) syntax.Result {
+	l.expr(expr.Object)
+	l.expr(expr.Index)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitIndexSetExpr(expr *syntax.IndexSet) syntax.Result {
+	l.expr(expr.Object)
+	l.expr(expr.Index)
+	l.expr(expr.Value)
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitMapExpr(expr *syntax.Map) syntax.Result {
+	for idx := range expr.Keys {
+		l.expr(expr.Keys[idx])
+		l.expr(expr.Values[idx])
+	}
+	return syntax.Result{}
+}
+
+func (l *Linter) VisitInterpolationExpr(expr *syntax.Interpolation) syntax.Result {
+	for _, part := range expr.Parts {
+		l.expr(part)
+	}
+	return syntax.Result{}
+}
@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// lint returns the warnings for source as "line:column rule" strings.
+func lint(t *testing.T, source string, config *Config) []string {
+	t.Helper()
+	warnings, err := Source(source, config)
+	if err != nil {
+		t.Fatalf("lint: %s", err)
+	}
+	got := make([]string, 0, len(warnings))
+	for _, d := range warnings {
+		d.Locate("test.lox", source)
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Line, d.Column, d.Code))
+	}
+	return got
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		// unused-variable
+		{"unused local", "fun f() { var a = 1; }\nf();", []string{"1:15 unused-variable"}},
+		{"used local", "fun f() { var a = 1; print a; }\nf();", nil},
+		{"unused local function", "fun f() { fun g() {} }\nf();", []string{"1:15 unused-variable"}},
+		{"unused local class", "{ class A {} }", []string{"1:9 unused-variable"}},
+		{"underscore local", "fun f() { var _a = 1; }\nf();", nil},
+		{"unused global", "var a = 1;", nil},
+		{"local read by a closure", "fun f() { var a = 1; return fun() { return a; }; }\nf();", nil},
+
+		// unused-parameter
+		{"unused parameter", "fun f(a) { return 1; }\nf(1);", []string{"1:7 unused-parameter"}},
+		{"used parameter", "fun f(a) { return a; }\nf(1);", nil},
+		{"underscore parameter", "fun f(_a) { return 1; }\nf(1);", nil},
+		{"unused method parameter", "class A { m(x) {} }", []string{"1:13 unused-parameter"}},
+
+		// unreachable-code
+		{"after return", "fun f() {\n  return 1;\n  print 2;\n  print 3;\n}\nf();", []string{"3:3 unreachable-code"}},
+		{"after break", "while (true) {\n  break;\n  var a = 1;\n  print a;\n}", []string{"3:3 unreachable-code"}},
+		{"after continue", "for (var x in [1]) {\n  continue;\n  print x;\n}", []string{"3:3 unreachable-code"}},
+		{"after throw", "{\n  throw 1;\n  if (true) print 2;\n}", []string{"3:3 unreachable-code"}},
+		{"return last", "fun f() {\n  print 1;\n  return 2;\n}\nf();", nil},
+		{"return in a branch", "fun f(a) {\n  if (a) return 1;\n  return 2;\n}\nf(1);", nil},
+
+		// shadowing
+		{"shadowed local", "fun f() {\n  var a = 1;\n  { var a = 2; print a; }\n  print a;\n}\nf();", []string{"3:9 shadowing"}},
+		{"shadowed global", "var a = 1;\nfun f() { var a = 2; print a; }\nf();", []string{"2:15 shadowing"}},
+		{"shadowed across functions", "fun f(a) {\n  fun g() { var a = 1; print a; }\n  g();\n  print a;\n}\nf(1);",
+			[]string{"2:17 shadowing"}},
+		{"parameter shadowing a global", "var a = 1;\nfun f(a) { print a; }\nf(1);", []string{"2:7 shadowing"}},
+		{"sibling functions", "fun f(a) { print a; }\nfun g(a) { print a; }\nf(1);\ng(1);", nil},
+		{"underscore shadowing", "var _a = 1;\nfun f() { var _a = 2; }\nf();", nil},
+		{"global redeclared", "var a = 1;\nvar a = 2;", nil},
+
+		// self-comparison
+		{"self comparison", "var a = 1;\nprint a == a;", []string{"2:9 self-comparison"}},
+		{"self comparison of properties", "var a = 1;\nprint a.b[0] < a.b[0];", []string{"2:14 self-comparison"}},
+		{"different operands", "var a = 1;\nvar b = 2;\nprint a == b;", nil},
+		{"calls compared", "fun f() { return 1; }\nprint f() == f();", nil},
+		{"arithmetic on itself", "var a = 1;\nprint a + a;", nil},
+
+		// assignment-in-condition
+		{"assignment as if condition", "var a;\nif (a = 1) print a;", []string{"2:5 assignment-in-condition"}},
+		{"assignment as while condition", "var a;\nwhile (a = false) print a;", []string{"2:8 assignment-in-condition"}},
+		{"property set as for condition", "var a;\nfor (; a.b = 1;) print a;", []string{"2:10 assignment-in-condition"}},
+		{"parenthesized assignment", "var a;\nif ((a = 1)) print a;", nil},
+		{"comparison", "var a;\nif (a == 1) print a;", nil},
+
+		// empty-block
+		{"empty block", "{}", []string{"1:1 empty-block"}},
+		{"empty if body", "if (true) {}", []string{"1:11 empty-block"}},
+		{"empty catch", "try { print 1; } catch (e) {}", []string{"1:28 empty-block"}},
+		{"comment-only block", "if (true) {\n  // nothing to do\n}", nil},
+		{"comment after the brace", "if (true) { // nothing to do\n}", nil},
+		{"empty function", "fun f() {}\nf();", nil},
+
+		// wrong-arity
+		{"too many arguments", "fun f(a) { return a; }\nf(1, 2);", []string{"2:7 wrong-arity"}},
+		{"too few arguments to a class", "class A { init(a, b) { this.a = a + b; } }\nA(1);", []string{"2:4 wrong-arity"}},
+		{"native", "print len(1, 2);", []string{"1:15 wrong-arity"}},
+		{"right arity", "fun f(a) { return a; }\nf(1);\nprint len(\"a\");", nil},
+		{"variadic native", "print max(1, 2, 3);", nil},
+		{"inherited initializer", "class A { init(a) { this.a = a; } }\nclass B < A {}\nB(1, 2);", nil},
+		{"shadowed by a local", "fun f(a) { return a; }\nfun g() { var f = fun(a, b) { return a + b; }; return f(1, 2); }\ng();",
+			[]string{"2:15 shadowing"}},
+		{"redefined native", "fun len(a, b) { return a + b; }\nprint len(1, 2);", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := lint(t, test.source, nil); !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestConfigSelectsRules runs each rule alone on a program that breaks
+// all of them.
+func TestConfigSelectsRules(t *testing.T) {
+	for _, rule := range Rules {
+		config := DefaultConfig()
+		for _, other := range Rules {
+			config.Rules[other.ID] = other.ID == rule.ID
+		}
+		source := "fun f(a) {\n  var b = 1;\n  { var f; }\n  if (b = b == b) {}\n  return;\n  f(1, 2);\n}"
+		got := lint(t, source, config)
+		if len(got) == 0 {
+			t.Errorf("%s: no warning", rule.ID)
+		}
+		for _, warning := range got {
+			if !strings.HasSuffix(warning, " "+rule.ID) {
+				t.Errorf("%s: got %s with the other rules disabled", rule.ID, warning)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package loxtest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+var corpusRoot = filepath.Join("..", "..", "..", "test")
+
+func TestCorpus(t *testing.T) {
+	testCorpus(t, BackendTreewalk)
+}
+
+func TestCorpusVM(t *testing.T) {
+	testCorpus(t, BackendVM)
+}
+
+func testCorpus(t *testing.T, backend Backend) {
+	results, err := RunSuite(corpusRoot, backend)
+	if err != nil {
+		t.Fatalf("run suite: %s", err.Error())
+	}
+	if len(results) == 0 {
+		t.Fatalf("no tests found under %s", corpusRoot)
+	}
+	for _, result := range results {
+		t.Run(result.Path, func(t *testing.T) {
+			switch result.Status {
+			case StatusSkip:
+				t.Skip(result.Reason)
+			case StatusFail:
+				t.Error(strings.Join(result.Failures, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseExpectations(t *testing.T) {
+	source := strings.Join([]string{
+		`print 1; // expect: 1`,
+		`print "";  // expect: `,
+		`a.b; // expect runtime error: Undefined variable 'a'.`,
+		`// [line 5] Error at 'x': Expect ';'.`,
+		`// [c line 6] Error at end: Expect '}' after block.`,
+		`var = 1; // Error at '=': Expect variable name.`,
+		`var 名 = @; // [line 8:10] Error: Unexpected character.`,
+		`// [java line 8] Error at 'b': Expect ')' after arguments.`,
+	}, "\n")
+	expect := ParseExpectations(source)
+	if len(expect.Output) != 2 || expect.Output[0] != "1" || expect.Output[1] != "" {
+		t.Errorf("output = %q", expect.Output)
+	}
+	if expect.RuntimeError == nil || expect.RuntimeError.Line != 3 {
+		t.Errorf("runtime error = %+v", expect.RuntimeError)
+	}
+	if len(expect.CompileErrors) != 3 {
+		t.Fatalf("compile errors = %+v", expect.CompileErrors)
+	}
+	if expect.CompileErrors[0].Line != 5 || expect.CompileErrors[1].Line != 6 {
+		t.Errorf("compile error lines = %+v", expect.CompileErrors)
+	}
+	if located := expect.CompileErrors[2]; located.Line != 8 || located.Column != 10 ||
+		located.Message != "Error: Unexpected character." {
+		t.Errorf("compile error with a column = %+v", located)
+	}
+}
+
+func TestCheckErrorLines(t *testing.T) {
+	at := func(line int) *util.Diagnostic {
+		return &util.Diagnostic{Code: util.CodeRuntime, Message: "error", Line: line}
+	}
+	tests := []struct {
+		name   string
+		expect *Expectation
+		exec   *execution
+		fail   bool
+	}{
+		{"runtime line", &Expectation{RuntimeError: &ExpectedError{Line: 2, Message: "error"}}, &execution{runtimeErr: at(2)}, false},
+		{"runtime wrong line", &Expectation{RuntimeError: &ExpectedError{Line: 2, Message: "error"}}, &execution{runtimeErr: at(3)}, true},
+		{"compile lines", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Message: "error"}, {Line: 4, Message: "error"}}},
+			&execution{compileErr: util.Diagnostics{at(1), at(4)}}, false},
+		{"compile missing line", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Message: "error"}, {Line: 4, Message: "error"}}},
+			&execution{compileErr: util.Diagnostics{at(1)}}, true},
+		{"compile unexpected error", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Message: "error"}}},
+			&execution{compileErr: util.Diagnostics{at(1), at(2)}}, true},
+		{"compile wrong line", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Message: "error"}}},
+			&execution{compileErr: at(2)}, true},
+		{"compile column", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Column: 3, Message: "error"}}},
+			&execution{compileErr: util.Diagnostics{&util.Diagnostic{Message: "error", Line: 1, Column: 3}}}, false},
+		{"compile wrong column", &Expectation{CompileErrors: []ExpectedError{{Line: 1, Column: 3, Message: "error"}}},
+			&execution{compileErr: util.Diagnostics{&util.Diagnostic{Message: "error", Line: 1, Column: 4}}}, true},
+	}
+	for _, test := range tests {
+		if failures := check(test.expect, test.exec); (len(failures) > 0) != test.fail {
+			t.Errorf("%s: failures = %q, want failing %t", test.name, failures, test.fail)
+		}
+	}
+}
+
+func TestCheckErrorMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		got  string
+		same bool
+	}{
+		{"same", "Stack overflow.", "Stack overflow.", true},
+		{"case and period", "Undefined variable 'a'.", "undefined variable 'a'", true},
+		{"compile prefix", "Error at 'this': Can't use 'this' outside of a class.", "can't use 'this' outside of a class", true},
+		{"prefix at end", "Error at end: Expect property name after '.'.", "expect property name after '.'", true},
+		{"scanner prefix", "Error: Unexpected character.", "Unexpected character.", true},
+		{"different name", "Undefined variable 'a'.", "undefined variable 'A'", false},
+		{"different message", "Error at ';': Expect expression.", "expect ';' after value", false},
+		{"rewording", "Operands must be numbers.", "operator <: left operand must be a number", true},
+		{"rewording with submatches", "Expected 2 arguments but got 1.", "wrong number of arguments: want=2, got=1", true},
+		{"rewording with other submatches", "Expected 2 arguments but got 1.", "wrong number of arguments: want=1, got=2", false},
+		{"rewording of a name", "Error at 'a+': Already a variable with this name in this scope.", "re-declare variable [a+]", true},
+		{"rewording of another name", "Error at 'a': Already a variable with this name in this scope.", "re-declare variable [b]", false},
+	}
+	for _, test := range tests {
+		if same := sameMessage(test.want, test.got); same != test.same {
+			t.Errorf("%s: sameMessage(%q, %q) = %t", test.name, test.want, test.got, same)
+		}
+	}
+
+	expect := &Expectation{RuntimeError: &ExpectedError{Line: 1, Message: "Operand must be a number."}}
+	exec := &execution{runtimeErr: &util.Diagnostic{Message: "can only call functions and classes", Line: 1}}
+	if failures := check(expect, exec); len(failures) == 0 {
+		t.Error("a runtime error with another message passed")
+	}
+	expect = &Expectation{CompileErrors: []ExpectedError{
+		{Line: 1, Message: "Error at 'a': Expect ';' after value."},
+		{Line: 1, Message: "Error: Unexpected character."},
+	}}
+	exec = &execution{compileErr: util.Diagnostics{
+		{Message: "Unexpected character.", Line: 1},
+		{Message: "expect ';' after value", Line: 1},
+	}}
+	if failures := check(expect, exec); len(failures) > 0 {
+		t.Errorf("failures = %q for two errors on the line", failures)
+	}
+}
@@ -0,0 +1,70 @@
+package loxtest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	expectOutputPattern  = regexp.MustCompile(`// expect: ?(.*)`)
+	expectRuntimePattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectErrorPattern   = regexp.MustCompile(`// (Error.*)`)
+	expectLinePattern    = regexp.MustCompile(`// \[((java|c) )?line (\d+)(:(\d+))?\] (Error.*)`)
+	nonTestPattern       = regexp.MustCompile(`// nontest`)
+)
+
+// ExpectedError is a compile or runtime error annotated in a test file.
+type ExpectedError struct {
+	Line    int
+	Column  int // 0 if not annotated
+	Message string
+}
+
+// Expectation collects the annotations of a single .lox test file.
+type Expectation struct {
+	Output        []string
+	CompileErrors []ExpectedError
+	RuntimeError  *ExpectedError
+	NonTest       bool
+}
+
+// ParseExpectations extracts the `// expect:` style annotations from source.
+//
+// `[c line N]` and `[java line N]` annotations only apply to one
+// implementation of the reference suite and are ignored. `[line N:M]` also expects the error at
+// column M, counted in characters.
+func ParseExpectations(source string) *Expectation {
+	expect := &Expectation{
+		Output: make([]string, 0),
+	}
+	for idx, line := range strings.Split(source, "\n") {
+		lineNo := idx + 1
+		if nonTestPattern.MatchString(line) {
+			expect.NonTest = true
+			return expect
+		}
+		if match := expectOutputPattern.FindStringSubmatch(line); match != nil {
+			expect.Output = append(expect.Output, match[1])
+			continue
+		}
+		if match := expectRuntimePattern.FindStringSubmatch(line); match != nil {
+			expect.RuntimeError = &ExpectedError{Line: lineNo, Message: match[1]}
+			continue
+		}
+		if match := expectLinePattern.FindStringSubmatch(line); match != nil {
+			if match[2] != "" {
+				continue
+			}
+			errLine, _ := strconv.Atoi(match[3])
+			errColumn, _ := strconv.Atoi(match[5])
+			expect.CompileErrors = append(expect.CompileErrors,
+				ExpectedError{Line: errLine, Column: errColumn, Message: match[6]})
+			continue
+		}
+		if match := expectErrorPattern.FindStringSubmatch(line); match != nil {
+			expect.CompileErrors = append(expect.CompileErrors, ExpectedError{Line: lineNo, Message: match[1]})
+		}
+	}
+	return expect
+}
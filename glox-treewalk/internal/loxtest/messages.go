@@ -0,0 +1,74 @@
+package loxtest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errorPrefix is the location the reference implementation puts before a
+// compile error message; glox keeps it in Diagnostic.Where.
+var errorPrefix = regexp.MustCompile(`^Error(?: at '.*?'| at end)?: `)
+
+// rewordings lists the errors glox words differently from the reference
+// implementation. reference is matched against the whole annotation, prefix
+// included, and glox against the whole message glox reports, after ${N} is
+// replaced by the Nth submatch of reference.
+var rewordings = []struct {
+	reference *regexp.Regexp
+	glox      string
+}{
+	{regexp.MustCompile(`^Only instances have fields\.$`), `can only set properties on instances`},
+	// strings have methods in glox, so a property of one is an unknown method
+	{regexp.MustCompile(`^Only instances have properties\.$`),
+		`can only get properties from instances, lists, maps and strings|undefined string method '.*'`},
+	{regexp.MustCompile(`^Undefined property '(.*)'\.$`), `undefined (property|method) '${1}'`},
+	{regexp.MustCompile(`^Operand must be a number\.$`), `operator -: operand must be a number`},
+	{regexp.MustCompile(`^Operands must be numbers\.$`), `operator \S+: (left|right) operand must be a number`},
+	{regexp.MustCompile(`^Operands must be two numbers or two strings\.$`),
+		`operands must be two numbers or two strings|right value is not a (number|string): .*`},
+	{regexp.MustCompile(`^Expected (\d+) arguments but got (\d+)\.$`), `wrong number of arguments: want=${1}, got=${2}`},
+	{regexp.MustCompile(`^Superclass must be a class\.$`), `superclass \[.*\] must be a class`},
+	{regexp.MustCompile(`^Error at '(.*)': Already a variable with this name in this scope\.$`),
+		`re-declare variable \[${1}\]`},
+	{regexp.MustCompile(`^Error at '(.*)': Can't read local variable in its own initializer\.$`),
+		`can't read local variable \[${1}\] in its own initializer`},
+	{regexp.MustCompile(`^Error at '(.*)': A class can't inherit from itself\.$`), `class ${1} can't inherit from itself`},
+	// 'fun' starts an anonymous function in glox, which then expects a '('
+	{regexp.MustCompile(`^Error at 'fun': Expect expression\.$`), `expect '\(' after function name`},
+}
+
+// sameMessage reports whether glox's message got is the error annotated as
+// want. Messages that only differ in the case of their first letter and a
+// final period are the same; other differences must be listed in
+// rewordings.
+func sameMessage(want string, got string) bool {
+	if normalize(errorPrefix.ReplaceAllString(want, "")) == normalize(got) {
+		return true
+	}
+	for _, rewording := range rewordings {
+		match := rewording.reference.FindStringSubmatch(want)
+		if match == nil {
+			continue
+		}
+		pattern := rewording.glox
+		for idx, submatch := range match[1:] {
+			pattern = strings.ReplaceAll(pattern, "${"+strconv.Itoa(idx+1)+"}", regexp.QuoteMeta(submatch))
+		}
+		if regexp.MustCompile("^(?:" + pattern + ")$").MatchString(got) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(message string) string {
+	message = strings.TrimSuffix(message, ".")
+	if message == "" {
+		return message
+	}
+	first, size := utf8.DecodeRuneInString(message)
+	return string(unicode.ToLower(first)) + message[size:]
+}
@@ -0,0 +1,303 @@
+package loxtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/bytecode"
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusFail
+	StatusSkip
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusFail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// Backend selects what runs the resolved program.
+type Backend string
+
+const (
+	BackendTreewalk Backend = "treewalk" // the tree-walking interpreter
+	BackendVM       Backend = "vm"       // the bytecode compiler and VM
+)
+
+// Result is the outcome of running one test file.
+type Result struct {
+	Path     string // relative to the suite root, slash separated
+	Status   Status
+	Failures []string
+	Reason   string // why the test was skipped
+}
+
+// DirSummary counts results per test directory.
+type DirSummary struct {
+	Dir  string
+	Pass int
+	Fail int
+	Skip int
+}
+
+type execution struct {
+	output     []string
+	compileErr error
+	runtimeErr error
+}
+
+// RunSuite runs every .lox file under root on backend, in lexical order.
+func RunSuite(root string, backend Backend) ([]*Result, error) {
+	paths := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+		rel, rErr := filepath.Rel(root, path)
+		if rErr != nil {
+			return rErr
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	results := make([]*Result, 0, len(paths))
+	for _, path := range paths {
+		results = append(results, RunFile(root, path, backend))
+	}
+	return results, nil
+}
+
+// RunFile runs the test at root/path on backend and checks it against its
+// annotations.
+func RunFile(root string, path string, backend Backend) *Result {
+	result := &Result{Path: path}
+	if reason, ok := SkipReason(path, backend); ok {
+		result.Status = StatusSkip
+		result.Reason = reason
+		return result
+	}
+	source, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if err != nil {
+		result.Status = StatusFail
+		result.Failures = append(result.Failures, err.Error())
+		return result
+	}
+	expect := ParseExpectations(string(source))
+	if expect.NonTest {
+		result.Status = StatusSkip
+		result.Reason = "nontest"
+		return result
+	}
+	result.Failures = check(expect, execute(string(source), backend))
+	if len(result.Failures) > 0 {
+		result.Status = StatusFail
+	}
+	return result
+}
+
+// Summarize groups results by their top-level directory.
+func Summarize(results []*Result) []DirSummary {
+	byDir := make(map[string]*DirSummary)
+	dirs := make([]string, 0)
+	for _, result := range results {
+		dir := "."
+		if idx := strings.Index(result.Path, "/"); idx >= 0 {
+			dir = result.Path[:idx]
+		}
+		summary, ok := byDir[dir]
+		if !ok {
+			summary = &DirSummary{Dir: dir}
+			byDir[dir] = summary
+			dirs = append(dirs, dir)
+		}
+		switch result.Status {
+		case StatusPass:
+			summary.Pass++
+		case StatusFail:
+			summary.Fail++
+		case StatusSkip:
+			summary.Skip++
+		}
+	}
+	sort.Strings(dirs)
+	summaries := make([]DirSummary, 0, len(dirs))
+	for _, dir := range dirs {
+		summaries = append(summaries, *byDir[dir])
+	}
+	return summaries
+}
+
+// check compares an execution against the expectation. Error messages are
+// compared with sameMessage, as glox words some of its diagnostics
+// differently from the reference implementation.
+func check(expect *Expectation, exec *execution) []string {
+	failures := make([]string, 0)
+	if len(expect.CompileErrors) > 0 {
+		if exec.compileErr == nil {
+			return append(failures, fmt.Sprintf("expected compile error %q, got none", expect.CompileErrors[0].Message))
+		}
+		for _, want := range expect.CompileErrors {
+			if !reported(diagnostics(exec.compileErr), want) {
+				failures = append(failures, fmt.Sprintf("expected compile error %q at %s, got: %s",
+					want.Message, location(want), exec.compileErr.Error()))
+			}
+		}
+		for _, got := range diagnostics(exec.compileErr) {
+			if !expected(expect.CompileErrors, got) {
+				failures = append(failures, fmt.Sprintf("unexpected compile error: %s", got.Error()))
+			}
+		}
+		return failures
+	}
+	if exec.compileErr != nil {
+		return append(failures, fmt.Sprintf("unexpected compile error: %s", exec.compileErr.Error()))
+	}
+
+	if expect.RuntimeError != nil && exec.runtimeErr == nil {
+		failures = append(failures, fmt.Sprintf("expected runtime error %q at line %d, got none",
+			expect.RuntimeError.Message, expect.RuntimeError.Line))
+	} else if expect.RuntimeError == nil && exec.runtimeErr != nil {
+		failures = append(failures, fmt.Sprintf("unexpected runtime error: %s", exec.runtimeErr.Error()))
+	} else if expect.RuntimeError != nil {
+		got := util.AsDiagnostic(exec.runtimeErr)
+		if got.Line != expect.RuntimeError.Line || !sameMessage(expect.RuntimeError.Message, got.Message) {
+			failures = append(failures, fmt.Sprintf("expected runtime error %q at line %d, got: %s",
+				expect.RuntimeError.Message, expect.RuntimeError.Line, exec.runtimeErr.Error()))
+		}
+	}
+
+	for idx, want := range expect.Output {
+		if idx >= len(exec.output) {
+			failures = append(failures, fmt.Sprintf("missing expected output %q", want))
+			continue
+		}
+		if exec.output[idx] != want {
+			failures = append(failures, fmt.Sprintf("expected output %q, got %q", want, exec.output[idx]))
+		}
+	}
+	for _, got := range exec.output[min(len(exec.output), len(expect.Output)):] {
+		failures = append(failures, fmt.Sprintf("unexpected output %q", got))
+	}
+	return failures
+}
+
+// reported reports whether one of ds is want, at its line, and column if
+// given.
+func reported(ds []*util.Diagnostic, want ExpectedError) bool {
+	for _, d := range ds {
+		if d.Line == want.Line && (want.Column == 0 || d.Column == want.Column) && sameMessage(want.Message, d.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+// expected reports whether got is one of the errors in wants.
+func expected(wants []ExpectedError, got *util.Diagnostic) bool {
+	for _, want := range wants {
+		if reported([]*util.Diagnostic{got}, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func location(want ExpectedError) string {
+	if want.Column == 0 {
+		return fmt.Sprintf("line %d", want.Line)
+	}
+	return fmt.Sprintf("line %d:%d", want.Line, want.Column)
+}
+
+// diagnostics returns the diagnostics of a compile error.
+func diagnostics(err error) []*util.Diagnostic {
+	if ds, ok := err.(util.Diagnostics); ok {
+		return ds
+	}
+	return []*util.Diagnostic{util.AsDiagnostic(err)}
+}
+
+// execute runs source through the scanner, parser, resolver and backend,
+// the same pipeline as cmd/interpreter.
+func execute(source string, backend Backend) (exec *execution) {
+	exec = &execution{}
+	defer func() {
+		if r := recover(); r != nil {
+			exec.runtimeErr = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	var stdout, stderr bytes.Buffer
+	opts := []util.Option{util.WithStdout(&stdout), util.WithStderr(&stderr)}
+	scanner := syntax.NewScanner(source, opts...)
+	tokens := scanner.ScanTokens()
+	if errs := scanner.GetErrors(); len(errs) > 0 {
+		exec.compileErr = located(errs, source)
+		return exec
+	}
+	parser := syntax.NewParser(tokens, opts...)
+	stmts := parser.Parse()
+	if errs := parser.GetErrors(); len(errs) > 0 {
+		exec.compileErr = located(errs, source)
+		return exec
+	}
+	interpret := interpreter.NewInterpreter(opts...)
+	resolver := interpreter.NewResolver(interpret, opts...)
+	resolver.Resolve(stmts)
+	if errs := resolver.GetErrors(); len(errs) > 0 {
+		exec.compileErr = located(errs, source)
+		return exec
+	}
+	if backend == BackendVM {
+		// the bytecode compiler reports its limits as util.Diagnostics
+		err := bytecode.NewVM(opts...).Interpret(stmts)
+		if errs, ok := err.(util.Diagnostics); ok {
+			exec.compileErr = located(errs, source)
+			return exec
+		}
+		exec.runtimeErr = err
+	} else {
+		interpret.Interpret(stmts)
+		exec.runtimeErr = interpret.GetError()
+	}
+
+	exec.output = make([]string, 0)
+	if output := stdout.String(); output != "" {
+		exec.output = strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	}
+	return exec
+}
+
+// located computes the columns of compile errors in source.
+func located(errs []*util.Diagnostic, source string) util.Diagnostics {
+	for _, d := range errs {
+		d.Locate("", source)
+	}
+	return util.Diagnostics(errs)
+}
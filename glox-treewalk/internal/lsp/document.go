@@ -0,0 +1,222 @@
+package lsp
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// document is an open text document and its analysis, redone on every
+// change: the diagnostics of the scanner, parser and resolver, and the
+// symbols the resolver bound the names to.
+type document struct {
+	uri         string
+	version     int
+	text        string
+	lines       []int // byte offsets of the line starts
+	tokens      []syntax.Token
+	stmts       []syntax.Stmt
+	symbols     *interpreter.Symbols
+	diagnostics []*util.Diagnostic
+	decls       map[int]syntax.Stmt // functions and classes by the offset of their name
+}
+
+func newDocument(uri string, version int, text string) *document {
+	doc := &document{uri: uri, version: version, text: text, lines: []int{0}}
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] == '\n' {
+			doc.lines = append(doc.lines, idx+1)
+		}
+	}
+	doc.analyze()
+	return doc
+}
+
+// analyze scans, parses and resolves the text. The parser and resolver
+// recover from errors, so whatever is valid is still analysed.
+func (d *document) analyze() {
+	report := util.WithReporter(func(diagnostic *util.Diagnostic) {
+		d.diagnostics = append(d.diagnostics, diagnostic)
+	})
+	d.tokens = syntax.NewScanner(d.text, report).ScanTokens()
+	d.stmts = syntax.NewParser(d.tokens, report).Parse()
+	resolver := interpreter.NewResolver(interpreter.NewInterpreter(), report)
+	d.symbols = resolver.RecordSymbols()
+	resolver.Resolve(d.stmts)
+
+	d.decls = make(map[int]syntax.Stmt)
+	walkDecls(d.stmts, func(stmt syntax.Stmt) {
+		switch stmt := stmt.(type) {
+		case *syntax.Function:
+			d.decls[stmt.Name.Pos] = stmt
+		case *syntax.Class:
+			d.decls[stmt.Name.Pos] = stmt
+		}
+	})
+}
+
+// walkDecls calls visit for every function and class declared in stmts,
+// outer ones first. Methods aren't visited.
+func walkDecls(stmts []syntax.Stmt, visit func(syntax.Stmt)) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.Function:
+			visit(stmt)
+			walkDecls(stmt.Body, visit)
+		case *syntax.Class:
+			visit(stmt)
+			for _, method := range stmt.Methods {
+				walkDecls(method.Body, visit)
+			}
+		default:
+			walkDecls(nested(stmt), visit)
+		}
+	}
+}
+
+// nested returns the statements directly nested in stmt.
+func nested(stmt syntax.Stmt) []syntax.Stmt {
+	var stmts []syntax.Stmt
+	switch stmt := stmt.(type) {
+	case *syntax.Block:
+		stmts = stmt.Statements
+	case *syntax.If:
+		stmts = []syntax.Stmt{stmt.Thenbranch, stmt.Elsebranch}
+	case *syntax.While:
+		stmts = []syntax.Stmt{stmt.Body}
+	case *syntax.ForDesugaredWhile:
+		stmts = []syntax.Stmt{stmt.Body}
+	case *syntax.ForIn:
+		stmts = []syntax.Stmt{stmt.Body}
+	case *syntax.Try:
+		stmts = []syntax.Stmt{stmt.Body}
+		if stmt.Handler != nil {
+			stmts = append(stmts, stmt.Handler)
+		}
+		if stmt.Finally != nil {
+			stmts = append(stmts, stmt.Finally)
+		}
+	}
+	nonNil := make([]syntax.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt != nil {
+			nonNil = append(nonNil, stmt)
+		}
+	}
+	return nonNil
+}
+
+// position converts a byte offset into a protocol position.
+func (d *document) position(offset int) Position {
+	offset = max(0, min(offset, len(d.text)))
+	line := sort.Search(len(d.lines), func(idx int) bool { return d.lines[idx] > offset }) - 1
+	character := 0
+	for _, r := range d.text[d.lines[line]:offset] {
+		character += utf16.RuneLen(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a protocol position into a byte offset.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[pos.Line]
+	for character := 0; character < pos.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+// span returns the range of length bytes at offset.
+func (d *document) span(offset int, length int) Range {
+	return Range{Start: d.position(offset), End: d.position(offset + length)}
+}
+
+func (d *document) tokenRange(token syntax.Token) Range {
+	return d.span(token.Pos, len(token.Lexeme))
+}
+
+// closingBrace returns the offset just past the brace that closes the
+// braces open at offset, or the end of the text.
+func (d *document) closingBrace(offset int) int {
+	depth := 0
+	for _, token := range d.tokens {
+		if token.Pos < offset {
+			continue
+		}
+		switch token.TokenType {
+		case syntax.TOKEN_LEFT_BRACE:
+			depth++
+		case syntax.TOKEN_RIGHT_BRACE:
+			if depth == 0 {
+				return token.Pos + 1
+			}
+			depth--
+		}
+	}
+	return len(d.text)
+}
+
+// declRange returns the range of a function or class declaration, from its
+// name to the end of its body.
+func (d *document) declRange(name syntax.Token) Range {
+	for _, token := range d.tokens {
+		if token.Pos > name.Pos && token.TokenType == syntax.TOKEN_LEFT_BRACE {
+			return Range{Start: d.position(name.Pos), End: d.position(d.closingBrace(token.Pos + 1))}
+		}
+	}
+	return d.tokenRange(name)
+}
+
+// visible reports whether a symbol can be referred to at offset: a global
+// anywhere, a local after its declaration and until its scope closes.
+func (d *document) visible(symbol *interpreter.Symbol, offset int) bool {
+	if symbol.Scope == nil {
+		return true
+	}
+	return symbol.Name.Pos+len(symbol.Name.Lexeme) < offset && offset < d.scopeEnd(symbol)
+}
+
+// scopeEnd returns the offset just past the closing brace of the scope of a
+// local symbol. The scope of a parameter may not have reached the body yet.
+func (d *document) scopeEnd(symbol *interpreter.Symbol) int {
+	end := symbol.Scope.End
+	if symbol.Kind == interpreter.SymbolParameter {
+		for _, token := range d.tokens {
+			if token.Pos > symbol.Name.Pos && token.TokenType == syntax.TOKEN_LEFT_BRACE {
+				end = max(end, token.Pos+1)
+				break
+			}
+		}
+	}
+	return d.closingBrace(end)
+}
+
+// wordBefore returns the identifier characters right before offset.
+func (d *document) wordBefore(offset int) string {
+	start := offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(d.text[:start])
+		if !isIdentifierRune(r) {
+			break
+		}
+		start -= size
+	}
+	return d.text[start:offset]
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
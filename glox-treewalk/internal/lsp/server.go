@@ -0,0 +1,517 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// ErrNoShutdown is returned by Run when the client asks the server to exit
+// without shutting it down first.
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+// Server is a Language Server Protocol server for Lox, speaking JSON-RPC
+// over a pair of streams. Documents are synchronised in full and analysed
+// on every change.
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	docs        map[string]*document
+	natives     map[string]interpreter.Callable
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	natives := make(map[string]interpreter.Callable)
+	for name, value := range interpreter.NewInterpreter().Globals() {
+		if callable, ok := value.(interpreter.Callable); ok {
+			natives[name] = callable
+		}
+	}
+	return &Server{
+		in:      bufio.NewReader(in),
+		out:     out,
+		docs:    make(map[string]*document),
+		natives: natives,
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.replyError(nil, &ResponseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		if err := s.dispatch(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch handles a request or notification; only errors writing the
+// reply are returned.
+func (s *Server) dispatch(msg *message) error {
+	handler, ok := handlers[msg.Method]
+	if msg.ID == nil {
+		if ok && (s.initialized || msg.Method == "initialize") {
+			_, err := handler(s, msg.Params)
+			var responseErr *ResponseError
+			if err != nil && !errors.As(err, &responseErr) {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case !ok:
+		return s.replyError(msg.ID, &ResponseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+	case !s.initialized && msg.Method != "initialize":
+		return s.replyError(msg.ID, &ResponseError{Code: codeServerNotInitialized, Message: "server not initialized"})
+	case s.shutdown:
+		return s.replyError(msg.ID, &ResponseError{Code: codeInvalidRequest, Message: "server is shut down"})
+	}
+	result, err := handler(s, msg.Params)
+	if err != nil {
+		var responseErr *ResponseError
+		if !errors.As(err, &responseErr) {
+			responseErr = &ResponseError{Code: codeInternalError, Message: err.Error()}
+		}
+		return s.replyError(msg.ID, responseErr)
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *ResponseError) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"initialized":                 ignore,
+	"shutdown":                    (*Server).shutdownServer,
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/rename":         (*Server).rename,
+}
+
+func ignore(*Server, json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+// decode unmarshals the params of a request into v.
+func decode(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	s.initialized = true
+	var result InitializeResult
+	result.Capabilities = ServerCapabilities{
+		TextDocumentSync:       syncFull,
+		DefinitionProvider:     true,
+		ReferencesProvider:     true,
+		HoverProvider:          true,
+		DocumentSymbolProvider: true,
+		CompletionProvider:     map[string]any{},
+		RenameProvider:         true,
+	}
+	result.ServerInfo.Name = "lox-lsp"
+	return result, nil
+}
+
+func (s *Server) shutdownServer(json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text))
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, text))
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics",
+		PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update replaces a document with its new analysis and publishes its
+// diagnostics.
+func (s *Server) update(doc *document) error {
+	s.docs[doc.uri] = doc
+	diagnostics := make([]Diagnostic, 0, len(doc.diagnostics))
+	for _, d := range doc.diagnostics {
+		severity := severityError
+		if d.Severity == util.SeverityWarning {
+			severity = severityWarning
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.span(d.Offset, d.Length),
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "lox",
+			Message:  d.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics",
+		PublishDiagnosticsParams{URI: doc.uri, Version: doc.version, Diagnostics: diagnostics})
+}
+
+// document returns the open document with the given URI.
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: "document not open: " + uri}
+	}
+	return doc, nil
+}
+
+// symbolAt returns the document of a position request, and the symbol and
+// token at the position. The symbol is nil for an undeclared name.
+func (s *Server) symbolAt(p *TextDocumentPositionParams) (*document, *interpreter.Symbol, syntax.Token, error) {
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, syntax.Token{}, err
+	}
+	symbol, token, _ := doc.symbols.At(doc.offset(p.Position))
+	return doc, symbol, token, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, _, err := s.symbolAt(&p)
+	if err != nil || symbol == nil {
+		return nil, err
+	}
+	return Location{URI: doc.uri, Range: doc.tokenRange(symbol.Name)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, _, err := s.symbolAt(&p.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	locations := []Location{}
+	if symbol == nil {
+		return locations, nil
+	}
+	for _, token := range occurrences(symbol) {
+		if token.Pos == symbol.Name.Pos && !p.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.uri, Range: doc.tokenRange(token)})
+	}
+	return locations, nil
+}
+
+// occurrences returns the declaration and the uses of a symbol in source
+// order.
+func occurrences(symbol *interpreter.Symbol) []syntax.Token {
+	tokens := append([]syntax.Token{symbol.Name}, symbol.Refs...)
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Pos < tokens[j].Pos })
+	return tokens
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, token, err := s.symbolAt(&p)
+	if err != nil || token.IsEmpty() {
+		return nil, err
+	}
+	var signature, description string
+	if symbol == nil {
+		native, ok := s.natives[token.Lexeme]
+		if !ok {
+			return nil, nil
+		}
+		signature = "fun " + token.Lexeme + "(...)"
+		description = "native function"
+		switch arity := native.Arity(); arity {
+		case interpreter.VariadicArity:
+			description += ", any number of arguments"
+		case 1:
+			description += ", 1 argument"
+		default:
+			description += fmt.Sprintf(", %d arguments", arity)
+		}
+	} else {
+		signature, description = doc.describe(symbol)
+	}
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```lox\n" + signature + "\n```\n" + description},
+		Range:    doc.tokenRange(token),
+	}, nil
+}
+
+// describe returns the declaration of a symbol as Lox code, and what it is.
+func (d *document) describe(symbol *interpreter.Symbol) (string, string) {
+	name := symbol.Name.Lexeme
+	scope := "local"
+	if symbol.Scope == nil {
+		scope = "global"
+	}
+	description := fmt.Sprintf("%s %s, declared on line %d", scope, symbol.Kind, symbol.Name.Line)
+	switch decl := d.decls[symbol.Name.Pos].(type) {
+	case *syntax.Function:
+		return "fun " + name + "(" + joinNames(decl.Params) + ")", description
+	case *syntax.Class:
+		signature := "class " + name
+		if decl.Superclass != nil {
+			signature += " < " + decl.Superclass.Name.Lexeme
+		}
+		return signature, description
+	}
+	if symbol.Kind == interpreter.SymbolParameter {
+		return name, fmt.Sprintf("parameter, declared on line %d", symbol.Name.Line)
+	}
+	return "var " + name, description
+}
+
+func joinNames(tokens []syntax.Token) string {
+	names := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		names = append(names, token.Lexeme)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (any, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := doc.documentSymbols(doc.stmts)
+	for _, stmt := range doc.stmts {
+		if decl, ok := stmt.(*syntax.Var); ok {
+			symbols = append(symbols, DocumentSymbol{
+				Name:           decl.Name.Lexeme,
+				Kind:           symbolKindVariable,
+				Range:          doc.tokenRange(decl.Name),
+				SelectionRange: doc.tokenRange(decl.Name),
+			})
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return doc.offset(symbols[i].SelectionRange.Start) < doc.offset(symbols[j].SelectionRange.Start)
+	})
+	return symbols, nil
+}
+
+// documentSymbols returns the outline of the classes and functions declared
+// in stmts, with the methods of classes and the functions nested in
+// functions as children.
+func (d *document) documentSymbols(stmts []syntax.Stmt) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.Function:
+			symbols = append(symbols, d.functionSymbol(stmt, symbolKindFunction))
+		case *syntax.Class:
+			class := DocumentSymbol{
+				Name:           stmt.Name.Lexeme,
+				Kind:           symbolKindClass,
+				Range:          d.declRange(stmt.Name),
+				SelectionRange: d.tokenRange(stmt.Name),
+				Children:       []DocumentSymbol{},
+			}
+			if stmt.Superclass != nil {
+				class.Detail = "< " + stmt.Superclass.Name.Lexeme
+			}
+			for _, method := range stmt.Methods {
+				kind := symbolKindMethod
+				if method.Name.Lexeme == "init" {
+					kind = symbolKindConstructor
+				}
+				class.Children = append(class.Children, d.functionSymbol(method, kind))
+			}
+			symbols = append(symbols, class)
+		default:
+			symbols = append(symbols, d.documentSymbols(nested(stmt))...)
+		}
+	}
+	return symbols
+}
+
+func (d *document) functionSymbol(decl *syntax.Function, kind int) DocumentSymbol {
+	return DocumentSymbol{
+		Name:           decl.Name.Lexeme,
+		Detail:         "(" + joinNames(decl.Params) + ")",
+		Kind:           kind,
+		Range:          d.declRange(decl.Name),
+		SelectionRange: d.tokenRange(decl.Name),
+		Children:       d.documentSymbols(decl.Body),
+	}
+}
+
+// completion offers the names in scope at the position, the natives and
+// the keywords. Nothing is offered after a '.', as properties are only
+// known at run time.
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset := doc.offset(p.Position)
+	list := CompletionList{Items: []CompletionItem{}}
+	start := offset - len(doc.wordBefore(offset))
+	if start > 0 && doc.text[start-1] == '.' {
+		return list, nil
+	}
+
+	seen := make(map[string]bool)
+	add := func(item CompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			list.Items = append(list.Items, item)
+		}
+	}
+	// innermost declarations first, so they win over the ones they shadow
+	for idx := len(doc.symbols.Decls) - 1; idx >= 0; idx-- {
+		symbol := doc.symbols.Decls[idx]
+		if symbol.Scope == nil || !doc.visible(symbol, offset) {
+			continue
+		}
+		add(doc.completionItem(symbol))
+	}
+	for _, symbol := range doc.symbols.Decls {
+		if symbol.Scope == nil {
+			add(doc.completionItem(symbol))
+		}
+	}
+	names := make([]string, 0, len(s.natives))
+	for name := range s.natives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(CompletionItem{Label: name, Kind: completionKindFunction, Detail: "native function"})
+	}
+	for _, keyword := range syntax.Keywords() {
+		add(CompletionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+	return list, nil
+}
+
+func (d *document) completionItem(symbol *interpreter.Symbol) CompletionItem {
+	kind := completionKindVariable
+	switch symbol.Kind {
+	case interpreter.SymbolFunction:
+		kind = completionKindFunction
+	case interpreter.SymbolClass:
+		kind = completionKindClass
+	}
+	signature, _ := d.describe(symbol)
+	return CompletionItem{Label: symbol.Name.Lexeme, Kind: kind, Detail: signature}
+}
+
+func (s *Server) rename(params json.RawMessage) (any, error) {
+	var p RenameParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, token, err := s.symbolAt(&p.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	if symbol == nil {
+		message := "no symbol to rename here"
+		if !token.IsEmpty() {
+			message = fmt.Sprintf("'%s' is not declared in this file", token.Lexeme)
+		}
+		return nil, &ResponseError{Code: codeInvalidParams, Message: message}
+	}
+	if !isIdentifier(p.NewName) {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("'%s' is not a valid name", p.NewName)}
+	}
+	edits := []TextEdit{}
+	for _, token := range occurrences(symbol) {
+		edits = append(edits, TextEdit{Range: doc.tokenRange(token), NewText: p.NewName})
+	}
+	return WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: edits}}, nil
+}
+
+// isIdentifier reports whether name scans as a single identifier.
+func isIdentifier(name string) bool {
+	scanner := syntax.NewScanner(name, util.WithReporter(func(*util.Diagnostic) {}))
+	tokens := scanner.ScanTokens()
+	return scanner.GetError() == nil && len(tokens) == 2 &&
+		tokens[0].TokenType == syntax.TOKEN_IDENTIFIER && tokens[0].Lexeme == name
+}
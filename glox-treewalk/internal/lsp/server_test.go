@@ -0,0 +1,310 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client drives a server over in-memory pipes, as an editor would over
+// stdio.
+type client struct {
+	t      *testing.T
+	in     io.WriteCloser
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// incoming is a message from the server: a response or a notification.
+type incoming struct {
+	message
+	Result json.RawMessage `json:"result"`
+	Error  *ResponseError  `json:"error"`
+}
+
+func (c *client) send(v any) {
+	c.t.Helper()
+	if err := writeMessage(c.in, v); err != nil {
+		c.t.Fatalf("write: %s", err)
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// receive reads the next message from the server.
+func (c *client) receive() incoming {
+	c.t.Helper()
+	body, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("read: %s", err)
+	}
+	var msg incoming
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("decode %s: %s", body, err)
+	}
+	return msg
+}
+
+// call sends a request and returns its response, skipping the
+// notifications that arrive first.
+func (c *client) call(method string, params any) incoming {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	c.send(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Method  string           `json:"method"`
+		Params  any              `json:"params"`
+	}{"2.0", &id, method, params})
+	for {
+		msg := c.receive()
+		if msg.ID == nil {
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("response to %s, want %s", *msg.ID, id)
+		}
+		return msg
+	}
+}
+
+// result calls method and decodes its result into v.
+func (c *client) result(method string, params any, v any) {
+	c.t.Helper()
+	msg := c.call(method, params)
+	if msg.Error != nil {
+		c.t.Fatalf("%s: %s", method, msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		c.t.Fatalf("%s: decode %s: %s", method, msg.Result, err)
+	}
+}
+
+// diagnostics waits for the next published diagnostics.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got %s, want diagnostics", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatalf("decode diagnostics: %s", err)
+	}
+	return params
+}
+
+const uri = "file:///test.lox"
+
+var source = strings.Join([]string{
+	`class Shape {`,
+	`  area() { return 0; }`,
+	`}`,
+	`fun add(a, b) {`,
+	`  var sum = a + b;`,
+	`  return sum;`,
+	`}`,
+	`var total = add(1, 2);`,
+	`print len("😀") + total;`,
+}, "\n")
+
+func at(line int, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+// open starts a server, initializes it and opens source.
+func open(t *testing.T) *client {
+	c := newClient(t)
+	var initResult InitializeResult
+	c.result("initialize", map[string]any{"capabilities": map[string]any{}}, &initResult)
+	if !initResult.Capabilities.DefinitionProvider || initResult.Capabilities.TextDocumentSync != syncFull {
+		t.Errorf("capabilities = %+v", initResult.Capabilities)
+	}
+	c.notify("initialized", map[string]any{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: source},
+	})
+	if published := c.diagnostics(); published.URI != uri || len(published.Diagnostics) != 0 {
+		t.Errorf("diagnostics = %+v", published)
+	}
+	return c
+}
+
+// close shuts the server down and waits for it to stop.
+func (c *client) close() {
+	c.t.Helper()
+	if msg := c.call("shutdown", nil); msg.Error != nil || string(msg.Result) != "null" {
+		c.t.Errorf("shutdown = %s, %+v", msg.Result, msg.Error)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("run = %s", err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+	if msg := c.call("textDocument/hover", at(0, 0)); msg.Error == nil || msg.Error.Code != codeServerNotInitialized {
+		t.Errorf("hover before initialize = %+v", msg.Error)
+	}
+	var initResult InitializeResult
+	c.result("initialize", map[string]any{"capabilities": map[string]any{}}, &initResult)
+	if msg := c.call("textDocument/unknown", at(0, 0)); msg.Error == nil || msg.Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method = %+v", msg.Error)
+	}
+	c.close()
+
+	c = newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrNoShutdown {
+		t.Errorf("exit without shutdown = %v", err)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := open(t)
+	var location Location
+	c.result("textDocument/definition", at(5, 10), &location)
+	want := Range{Start: Position{4, 6}, End: Position{4, 9}}
+	if location.URI != uri || location.Range != want {
+		t.Errorf("definition of sum = %+v, want %+v", location, want)
+	}
+	c.close()
+}
+
+func TestReferences(t *testing.T) {
+	c := open(t)
+	params := ReferenceParams{TextDocumentPositionParams: at(3, 8)}
+	params.Context.IncludeDeclaration = true
+	var locations []Location
+	c.result("textDocument/references", params, &locations)
+	if len(locations) != 2 || locations[0].Range.Start != (Position{3, 8}) || locations[1].Range.Start != (Position{4, 12}) {
+		t.Errorf("references of a = %+v", locations)
+	}
+	c.close()
+}
+
+func TestHover(t *testing.T) {
+	c := open(t)
+	var hover Hover
+	c.result("textDocument/hover", at(7, 13), &hover)
+	if !strings.Contains(hover.Contents.Value, "fun add(a, b)") || !strings.Contains(hover.Contents.Value, "global function") {
+		t.Errorf("hover on add = %q", hover.Contents.Value)
+	}
+	c.result("textDocument/hover", at(8, 7), &hover)
+	if !strings.Contains(hover.Contents.Value, "native function, 1 argument") {
+		t.Errorf("hover on len = %q", hover.Contents.Value)
+	}
+	// the emoji is two UTF-16 code units
+	c.result("textDocument/hover", at(8, 20), &hover)
+	if !strings.Contains(hover.Contents.Value, "var total") || hover.Range.Start != (Position{8, 18}) {
+		t.Errorf("hover on total = %+v", hover)
+	}
+	c.close()
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	c := open(t)
+	var symbols []DocumentSymbol
+	c.result("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols)
+	var names []string
+	for _, symbol := range symbols {
+		names = append(names, symbol.Name)
+	}
+	if strings.Join(names, " ") != "Shape add total" {
+		t.Fatalf("symbols = %v", names)
+	}
+	if children := symbols[0].Children; len(children) != 1 || children[0].Name != "area" || children[0].Kind != symbolKindMethod {
+		t.Errorf("methods of Shape = %+v", children)
+	}
+	if symbols[1].Kind != symbolKindFunction || symbols[1].Range.End != (Position{6, 1}) {
+		t.Errorf("add = %+v", symbols[1])
+	}
+	c.close()
+}
+
+func TestCompletion(t *testing.T) {
+	c := open(t)
+	labels := func(line int, character int) map[string]bool {
+		var list CompletionList
+		c.result("textDocument/completion", at(line, character), &list)
+		labels := make(map[string]bool)
+		for _, item := range list.Items {
+			labels[item.Label] = true
+		}
+		return labels
+	}
+	inside := labels(5, 9)
+	for _, name := range []string{"sum", "a", "b", "add", "total", "Shape", "len", "while"} {
+		if !inside[name] {
+			t.Errorf("completion in add lacks %s", name)
+		}
+	}
+	if outside := labels(8, 0); outside["sum"] || outside["a"] {
+		t.Errorf("completion outside add offers its locals")
+	}
+	c.close()
+}
+
+func TestRename(t *testing.T) {
+	c := open(t)
+	var edit WorkspaceEdit
+	c.result("textDocument/rename", RenameParams{TextDocumentPositionParams: at(7, 5), NewName: "grand"}, &edit)
+	edits := edit.Changes[uri]
+	if len(edits) != 2 || edits[0].Range.Start != (Position{7, 4}) || edits[1].Range.Start != (Position{8, 18}) {
+		t.Errorf("rename edits = %+v", edits)
+	}
+	for _, name := range []string{"1x", "while", "a b"} {
+		msg := c.call("textDocument/rename", RenameParams{TextDocumentPositionParams: at(7, 5), NewName: name})
+		if msg.Error == nil || msg.Error.Code != codeInvalidParams {
+			t.Errorf("rename to %q = %s", name, msg.Result)
+		}
+	}
+	c.close()
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := open(t)
+	changed := DidChangeTextDocumentParams{}
+	changed.TextDocument.URI = uri
+	changed.TextDocument.Version = 2
+	changed.ContentChanges = append(changed.ContentChanges, struct {
+		Text string `json:"text"`
+	}{"print (;\n{ var a = 1; var a = 2; }\n"})
+	c.notify("textDocument/didChange", changed)
+	published := c.diagnostics()
+	if published.Version != 2 || len(published.Diagnostics) != 2 {
+		t.Fatalf("diagnostics = %+v", published)
+	}
+	syntaxErr, resolveErr := published.Diagnostics[0], published.Diagnostics[1]
+	if syntaxErr.Code != "E201" || syntaxErr.Range.Start != (Position{0, 7}) {
+		t.Errorf("syntax error = %+v", syntaxErr)
+	}
+	if resolveErr.Code != "E301" || resolveErr.Range.Start != (Position{1, 17}) || resolveErr.Severity != severityError {
+		t.Errorf("resolve error = %+v", resolveErr)
+	}
+	c.close()
+}
@@ -0,0 +1,59 @@
+package stdlib
+
+import "fmt"
+
+// The list methods work on the elements of a list of either backend and
+// return the new elements, leaving it to the backend to store them.
+
+// Insert inserts element at index, which may be one past the end.
+func Insert[E any](elements []E, index any, element E) ([]E, error) {
+	idx, err := Position("list", index, len(elements), len(elements))
+	if err != nil {
+		return elements, err
+	}
+	var zero E
+	elements = append(elements, zero)
+	copy(elements[idx+1:], elements[idx:])
+	elements[idx] = element
+	return elements, nil
+}
+
+// Pop removes the last element.
+func Pop[E any](elements []E) ([]E, E, error) {
+	var last E
+	if len(elements) == 0 {
+		return elements, last, fmt.Errorf("pop from empty list")
+	}
+	last = elements[len(elements)-1]
+	return elements[:len(elements)-1], last, nil
+}
+
+// Remove removes the element at index.
+func Remove[E any](elements []E, index any) ([]E, E, error) {
+	var removed E
+	idx, err := Position("list", index, len(elements), len(elements)-1)
+	if err != nil {
+		return elements, removed, err
+	}
+	removed = elements[idx]
+	return append(elements[:idx], elements[idx+1:]...), removed, nil
+}
+
+// Slice returns a copy of the elements from start up to end.
+func Slice[E any](quota Quota, elements []E, start any, end any) ([]E, error) {
+	from, err := Position("list", start, len(elements), len(elements))
+	if err != nil {
+		return nil, err
+	}
+	to, err := Position("list", end, len(elements), len(elements))
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("slice start %d is after end %d", from, to)
+	}
+	if err := quota.List(to - from); err != nil {
+		return nil, err
+	}
+	return append([]E{}, elements[from:to]...), nil
+}
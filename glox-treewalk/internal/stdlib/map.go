@@ -0,0 +1,60 @@
+package stdlib
+
+// OrderedMap is the storage of the maps of either backend: a hash map that
+// remembers the order in which keys were first inserted. The zero value is
+// an empty map.
+type OrderedMap[K comparable, V any] struct {
+	keys   []K
+	values map[K]V
+}
+
+func (m *OrderedMap[K, V]) Len() int {
+	return len(m.keys)
+}
+
+// Get returns the value of key, and whether key is present.
+func (m *OrderedMap[K, V]) Get(key K) (V, bool) {
+	value, ok := m.values[key]
+	return value, ok
+}
+
+// Set adds or replaces the value of key.
+func (m *OrderedMap[K, V]) Set(key K, value V) {
+	if m.values == nil {
+		m.values = make(map[K]V)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Remove deletes key and returns its value, and whether it was present.
+func (m *OrderedMap[K, V]) Remove(key K) (V, bool) {
+	value, ok := m.values[key]
+	if !ok {
+		return value, false
+	}
+	delete(m.values, key)
+	for idx, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+			break
+		}
+	}
+	return value, true
+}
+
+// Keys returns a copy of the keys in insertion order.
+func (m *OrderedMap[K, V]) Keys() []K {
+	return append([]K{}, m.keys...)
+}
+
+// Values returns the values in the order of their keys.
+func (m *OrderedMap[K, V]) Values() []V {
+	values := make([]V, 0, len(m.keys))
+	for _, key := range m.keys {
+		values = append(values, m.values[key])
+	}
+	return values
+}
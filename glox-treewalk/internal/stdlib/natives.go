@@ -0,0 +1,156 @@
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// Constants are the global numbers every run starts with.
+var Constants = map[string]float64{
+	"PI": math.Pi,
+	"E":  math.E,
+}
+
+// unaryMath are the natives wrapping a math function of one number.
+var unaryMath = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"log":   math.Log,
+	"exp":   math.Exp,
+}
+
+// Natives returns the global natives that need nothing of a backend. random()
+// draws from a generator seeded with seed, so runs are reproducible until a
+// script calls seed(n). Error(), str() and type() depend on the values of a
+// backend and are defined by each.
+func Natives(seed int64) map[string]Native {
+	natives := map[string]Native{
+		"clock": {0, clock},
+		"len":   {1, length},
+		"num":   {1, num},
+		"pow":   {2, binaryMath("pow", math.Pow)},
+		"atan2": {2, binaryMath("atan2", math.Atan2)},
+		"min":   {VariadicArity, extremum("min", math.Min)},
+		"max":   {VariadicArity, extremum("max", math.Max)},
+	}
+	for name, fn := range unaryMath {
+		natives[name] = Native{1, func(args []any) (any, error) {
+			x, err := NumberArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return fn(x), nil
+		}}
+	}
+
+	random := rand.New(rand.NewPCG(uint64(seed), 0))
+	natives["random"] = Native{0, func(args []any) (any, error) {
+		return random.Float64(), nil
+	}}
+	natives["seed"] = Native{1, func(args []any) (any, error) {
+		seed, err := NumberArg("seed", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		random = rand.New(rand.NewPCG(uint64(int64(seed)), 0))
+		return nil, nil
+	}}
+	return natives
+}
+
+func clock(args []any) (any, error) {
+	return float64(time.Now().UnixMilli()), nil
+}
+
+// Sized is implemented by the lists and maps of a backend.
+type Sized interface {
+	Len() int
+}
+
+// length returns the number of elements of a list, entries of a map or
+// characters of a string.
+func length(args []any) (any, error) {
+	switch value := args[0].(type) {
+	case Sized:
+		return float64(value.Len()), nil
+	case string:
+		return float64(utf8.RuneCountInString(value)), nil
+	}
+	return nil, fmt.Errorf("len() expects a list, a map or a string, got %v", args[0])
+}
+
+// num parses a string as a number; numbers are returned unchanged.
+func num(args []any) (any, error) {
+	switch value := args[0].(type) {
+	case float64:
+		return value, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, syntax.ErrorAt(syntax.Token{}, util.CodeOperandType,
+				fmt.Sprintf("num(): can't parse %q as a number", value))
+		}
+		return number, nil
+	}
+	return nil, syntax.ErrorAt(syntax.Token{}, util.CodeOperandType,
+		fmt.Sprintf("num(): argument must be a string or a number, got %v", args[0]))
+}
+
+// ErrorMessage returns the message Error(value) stores: value itself if it
+// is a string, otherwise the text print shows for it.
+func ErrorMessage(value any) string {
+	if message, ok := value.(string); ok {
+		return message
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func binaryMath(name string, fn func(float64, float64) float64) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		x, err := NumberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		y, err := NumberArg(name, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return fn(x, y), nil
+	}
+}
+
+// extremum folds one or more numbers with pick.
+func extremum(name string, pick func(float64, float64) float64) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		if len(args) == 0 {
+			return nil, syntax.ErrorAt(syntax.Token{}, util.CodeArity,
+				fmt.Sprintf("%s() expects at least one argument", name))
+		}
+		result := math.Inf(1)
+		if name == "max" {
+			result = math.Inf(-1)
+		}
+		for idx := range args {
+			x, err := NumberArg(name, args, idx)
+			if err != nil {
+				return nil, err
+			}
+			result = pick(result, x)
+		}
+		return result, nil
+	}
+}
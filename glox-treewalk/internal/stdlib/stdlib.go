@@ -0,0 +1,85 @@
+// Package stdlib is the standard library of Lox, shared by the tree-walking
+// interpreter and the bytecode VM. Natives and methods work on plain Go
+// values: nil, bool, float64 and string, while lists, maps and the other
+// objects of a backend pass through untouched. Results may also be a
+// []string, which a backend turns into a list. Each backend adapts its
+// values to and from these, and passes a Quota that methods charge before
+// they build a result.
+package stdlib
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// VariadicArity marks a native function that accepts any number of arguments.
+const VariadicArity = -1
+
+// Native is a global function implemented in Go.
+type Native struct {
+	Arity int
+	Fn    func(args []any) (any, error)
+}
+
+// Method is a method of a builtin type such as string, implemented in Go.
+type Method[T any] struct {
+	Arity int
+	Fn    func(quota Quota, receiver T, args []any) (any, error)
+}
+
+// Quota is charged by a method for the strings and lists it is about to
+// make, before it allocates them, so that an exhausted memory quota stops
+// an oversized result from being built at all.
+type Quota interface {
+	// Strings charges n strings of bytes bytes in total.
+	Strings(n int, bytes int) error
+	// List charges a list of n elements.
+	List(n int) error
+}
+
+// Lookup returns the method name of the builtin type typeName. An undefined
+// method is reported at token, which may be empty for the caller to locate.
+func Lookup[M any](methods map[string]M, typeName string, name string, token syntax.Token) (M, error) {
+	method, ok := methods[name]
+	if !ok {
+		return method, syntax.ErrorAt(token, util.CodeUndefinedProperty,
+			fmt.Sprintf("undefined %s method '%s'", typeName, name))
+	}
+	return method, nil
+}
+
+// NumberArg returns args[idx] of the native name, which must be a number.
+func NumberArg(name string, args []any, idx int) (float64, error) {
+	x, ok := args[idx].(float64)
+	if !ok {
+		return 0, syntax.ErrorAt(syntax.Token{}, util.CodeOperandType,
+			fmt.Sprintf("%s(): argument %d must be a number", name, idx+1))
+	}
+	return x, nil
+}
+
+// StringArg returns args[idx] of the method name, which must be a string.
+func StringArg(name string, args []any, idx int) (string, error) {
+	s, ok := args[idx].(string)
+	if !ok {
+		return "", syntax.ErrorAt(syntax.Token{}, util.CodeOperandType,
+			fmt.Sprintf("%s(): argument %d must be a string", name, idx+1))
+	}
+	return s, nil
+}
+
+// Position checks that index, into a kind such as "list" of length
+// elements, is an integer between 0 and last.
+func Position(kind string, index any, length int, last int) (int, error) {
+	number, ok := index.(float64)
+	if !ok || number != math.Trunc(number) {
+		return 0, fmt.Errorf("%s index must be an integer, got %v", kind, index)
+	}
+	if number < 0 || number > float64(last) {
+		return 0, fmt.Errorf("%s index %v out of range for length %d", kind, index, length)
+	}
+	return int(number), nil
+}
@@ -0,0 +1,139 @@
+package stdlib
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings are plain Go strings. Indices and lengths count characters, not
+// bytes, like len() and for-in do.
+
+// CharAt returns the character at index of s as a string.
+func CharAt(s string, index any) (string, error) {
+	length := utf8.RuneCountInString(s)
+	idx, err := Position("string", index, length, length-1)
+	if err != nil {
+		return "", err
+	}
+	offset := byteOffset(s, idx)
+	_, size := utf8.DecodeRuneInString(s[offset:])
+	return s[offset : offset+size], nil
+}
+
+// byteOffset returns the offset in bytes of the character at idx of s.
+func byteOffset(s string, idx int) int {
+	for offset := range s {
+		if idx == 0 {
+			return offset
+		}
+		idx--
+	}
+	return len(s)
+}
+
+// StringMethods are the methods of strings.
+var StringMethods = map[string]Method[string]{
+	"len": {0, func(quota Quota, s string, args []any) (any, error) {
+		return float64(utf8.RuneCountInString(s)), nil
+	}},
+	"upper": {0, func(quota Quota, s string, args []any) (any, error) {
+		// changing case keeps the length of most strings
+		if err := quota.Strings(1, len(s)); err != nil {
+			return nil, err
+		}
+		return strings.ToUpper(s), nil
+	}},
+	"lower": {0, func(quota Quota, s string, args []any) (any, error) {
+		if err := quota.Strings(1, len(s)); err != nil {
+			return nil, err
+		}
+		return strings.ToLower(s), nil
+	}},
+	"trim": {0, func(quota Quota, s string, args []any) (any, error) {
+		trimmed := strings.TrimSpace(s)
+		if err := quota.Strings(1, len(trimmed)); err != nil {
+			return nil, err
+		}
+		return trimmed, nil
+	}},
+	"split": {1, func(quota Quota, s string, args []any) (any, error) {
+		sep, err := StringArg("split", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		// an empty separator splits s into its characters
+		n, bytes := utf8.RuneCountInString(s), len(s)
+		if sep != "" {
+			n = strings.Count(s, sep) + 1
+			bytes -= (n - 1) * len(sep)
+		}
+		if err := quota.List(n); err != nil {
+			return nil, err
+		}
+		if err := quota.Strings(n, bytes); err != nil {
+			return nil, err
+		}
+		return strings.Split(s, sep), nil
+	}},
+	"contains": {1, func(quota Quota, s string, args []any) (any, error) {
+		sub, err := StringArg("contains", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(s, sub), nil
+	}},
+	"startsWith": {1, func(quota Quota, s string, args []any) (any, error) {
+		prefix, err := StringArg("startsWith", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(s, prefix), nil
+	}},
+	"indexOf": {1, func(quota Quota, s string, args []any) (any, error) {
+		sub, err := StringArg("indexOf", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		idx := strings.Index(s, sub)
+		if idx < 0 {
+			return float64(-1), nil
+		}
+		return float64(utf8.RuneCountInString(s[:idx])), nil
+	}},
+	"replace": {2, func(quota Quota, s string, args []any) (any, error) {
+		old, err := StringArg("replace", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		replacement, err := StringArg("replace", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		// an empty old matches before every character and at the end
+		n := strings.Count(s, old)
+		if err := quota.Strings(1, len(s)+n*(len(replacement)-len(old))); err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(s, old, replacement), nil
+	}},
+	"substr": {2, func(quota Quota, s string, args []any) (any, error) {
+		length := utf8.RuneCountInString(s)
+		start, err := Position("string", args[0], length, length)
+		if err != nil {
+			return nil, err
+		}
+		end, err := Position("string", args[1], length, length)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("substr start %d is after end %d", start, end)
+		}
+		sub := s[byteOffset(s, start):byteOffset(s, end)]
+		if err := quota.Strings(1, len(sub)); err != nil {
+			return nil, err
+		}
+		return sub, nil
+	}},
+}
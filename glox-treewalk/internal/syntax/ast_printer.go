@@ -12,14 +12,24 @@ type AstPrinter struct {
 
 func (a *AstPrinter) TopPrintStmts(stmts []Stmt) error {
 	fmt.Println("------- result -------")
+	desc, err := a.Print(stmts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(desc)
+	return nil
+}
+
+// Print returns the tree of stmts, one top-level statement after another.
+func (a *AstPrinter) Print(stmts []Stmt) (string, error) {
+	a.desc = ""
 	for _, stmt := range stmts {
 		a.ident = 0
 		if err := a.printStmt(stmt); err != nil {
-			return err
+			return "", err
 		}
 	}
-	fmt.Println(a.desc)
-	return nil
+	return a.desc, nil
 }
 
 func (a *AstPrinter) printStmt(stmt Stmt) error {
@@ -49,6 +59,38 @@ func (a *AstPrinter) VisitReturnStmt(stmt *Return) error {
 	return nil
 }
 
+func (a *AstPrinter) VisitThrowStmt(stmt *Throw) error {
+	a.desc += indentString(a.ident, "(throw "+a.PrintExpr(stmt.Value)+")")
+	return nil
+}
+
+func (a *AstPrinter) VisitTryStmt(stmt *Try) error {
+	a.desc += indentString(a.ident, "(try\n")
+	a.ident += 2
+	if err := a.printStmt(stmt.Body); err != nil {
+		return err
+	}
+	a.ident -= 2
+	if stmt.Handler != nil {
+		a.desc += indentString(a.ident, "catch "+stmt.Name.Lexeme+"\n")
+		a.ident += 2
+		if err := a.printStmt(stmt.Handler); err != nil {
+			return err
+		}
+		a.ident -= 2
+	}
+	if stmt.Finally != nil {
+		a.desc += indentString(a.ident, "finally\n")
+		a.ident += 2
+		if err := a.printStmt(stmt.Finally); err != nil {
+			return err
+		}
+		a.ident -= 2
+	}
+	a.desc += indentString(a.ident, ")")
+	return nil
+}
+
 func (a *AstPrinter) VisitFunctionStmt(stmt *Function) error {
 	a.desc += indentString(a.ident, "(fun "+stmt.Name.Lexeme+"(")
 	a.ident += 2
@@ -111,6 +153,19 @@ func (a *AstPrinter) VisitBlockStmt(stmt *Block) error {
 	return nil
 }
 
+func (a *AstPrinter) VisitForInStmt(stmt *ForIn) error {
+	a.desc += indentString(a.ident, "(forIn "+stmt.Name.Lexeme+" ")
+	a.desc += a.PrintExpr(stmt.Iterable)
+	a.desc += "\n"
+	a.ident += 2
+	if err := a.printStmt(stmt.Body); err != nil {
+		return err
+	}
+	a.ident -= 2
+	a.desc += indentString(a.ident, ")")
+	return nil
+}
+
 func (a *AstPrinter) VisitWhileStmt(stmt *While) error {
 	a.desc += indentString(a.ident, "(while ")
 	a.desc += a.PrintExpr(stmt.Condition)
@@ -224,6 +279,33 @@ func (a *AstPrinter) VisitSetExpr(expr *Set) Result {
 	return Result{Value: fmt.Sprintf("(set %s.%s %s)", objectStr, expr.Name.Lexeme, valueStr)}
 }
 
+func (a *AstPrinter) VisitListExpr(expr *List) Result {
+	return Result{Value: a.parenthesize("list", expr.Elements...)}
+}
+
+func (a *AstPrinter) VisitInterpolationExpr(expr *Interpolation) Result {
+	return Result{Value: a.parenthesize("interpolate", expr.Parts...)}
+}
+
+func (a *AstPrinter) VisitMapExpr(expr *Map) Result {
+	entries := make([]Expr, 0, 2*len(expr.Keys))
+	for idx := range expr.Keys {
+		entries = append(entries, expr.Keys[idx], expr.Values[idx])
+	}
+	return Result{Value: a.parenthesize("map", entries...)}
+}
+
+func (a *AstPrinter) VisitIndexExpr(expr *Index) Result {
+	return Result{Value: fmt.Sprintf("(%s[%s])", a.PrintExpr(expr.Object), a.PrintExpr(expr.Index))}
+}
+
+func (a *AstPrinter) VisitIndexSetExpr(expr *IndexSet) Result {
+	objectStr := a.PrintExpr(expr.Object)
+	indexStr := a.PrintExpr(expr.Index)
+	valueStr := a.PrintExpr(expr.Value)
+	return Result{Value: fmt.Sprintf("(set %s[%s] %s)", objectStr, indexStr, valueStr)}
+}
+
 func (a *AstPrinter) VisitThisExpr(expr *This) Result {
 	return Result{Value: "this"}
 }
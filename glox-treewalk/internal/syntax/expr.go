@@ -20,6 +20,11 @@ type ExprVisitor interface {
 	VisitLiteralExpr(*Literal) Result
 	VisitVariableExpr(*Variable) Result
 	VisitAnonymousFunctionExpr(*AnonymousFunction) Result
+	VisitListExpr(*List) Result
+	VisitIndexExpr(*Index) Result
+	VisitIndexSetExpr(*IndexSet) Result
+	VisitMapExpr(*Map) Result
+	VisitInterpolationExpr(*Interpolation) Result
 }
 
 type Expr interface {
@@ -171,10 +176,12 @@ func (n *Grouping) Accept(v ExprVisitor) Result {
 }
 
 type Literal struct {
+	Token Token
 	Value any
 }
-func NewLiteral(value any) *Literal {
+func NewLiteral(token Token, value any) *Literal {
 	return &Literal{
+		Token: token,
 		Value: value,
 	}
 }
@@ -206,3 +213,81 @@ func (n *AnonymousFunction) Accept(v ExprVisitor) Result {
 	return v.VisitAnonymousFunctionExpr(n)
 }
 
+type List struct {
+	Bracket Token
+	Elements []Expr
+}
+func NewList(bracket Token, elements []Expr) *List {
+	return &List{
+		Bracket: bracket,
+		Elements: elements,
+	}
+}
+func (n *List) Accept(v ExprVisitor) Result {
+	return v.VisitListExpr(n)
+}
+
+type Index struct {
+	Object Expr
+	Bracket Token
+	Index Expr
+}
+func NewIndex(object Expr, bracket Token, index Expr) *Index {
+	return &Index{
+		Object: object,
+		Bracket: bracket,
+		Index: index,
+	}
+}
+func (n *Index) Accept(v ExprVisitor) Result {
+	return v.VisitIndexExpr(n)
+}
+
+type IndexSet struct {
+	Object Expr
+	Bracket Token
+	Index Expr
+	Value Expr
+}
+func NewIndexSet(object Expr, bracket Token, index Expr, value Expr) *IndexSet {
+	return &IndexSet{
+		Object: object,
+		Bracket: bracket,
+		Index: index,
+		Value: value,
+	}
+}
+func (n *IndexSet) Accept(v ExprVisitor) Result {
+	return v.VisitIndexSetExpr(n)
+}
+
+type Map struct {
+	Brace Token
+	Keys []Expr
+	Values []Expr
+}
+func NewMap(brace Token, keys []Expr, values []Expr) *Map {
+	return &Map{
+		Brace: brace,
+		Keys: keys,
+		Values: values,
+	}
+}
+func (n *Map) Accept(v ExprVisitor) Result {
+	return v.VisitMapExpr(n)
+}
+
+type Interpolation struct {
+	Quote Token
+	Parts []Expr
+}
+func NewInterpolation(quote Token, parts []Expr) *Interpolation {
+	return &Interpolation{
+		Quote: quote,
+		Parts: parts,
+	}
+}
+func (n *Interpolation) Accept(v ExprVisitor) Result {
+	return v.VisitInterpolationExpr(n)
+}
+
@@ -0,0 +1,580 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// Formatter prints a program in the canonical layout of lox-fmt: two-space
+// indentation, opening braces on the line of their statement, spaces around
+// binary operators and one statement per line. Comments are kept, and so is
+// a single blank line between statements.
+type Formatter struct {
+	out      strings.Builder
+	indent   int
+	comments *Comments
+	methods  bool // printing the methods of a class
+}
+
+func NewFormatter(comments *Comments) *Formatter {
+	if comments == nil {
+		comments = &Comments{Stmts: make(map[Stmt]*Trivia), Exprs: make(map[Expr]*Trivia)}
+	}
+	return &Formatter{comments: comments}
+}
+
+// FormatSource formats Lox source code. Source that doesn't scan or parse
+// is not formatted; its diagnostics are reported through opts.
+func FormatSource(source string, opts ...util.Option) (string, error) {
+	opts = append(opts, util.WithComments())
+	scanner := NewScanner(source, opts...)
+	tokens := scanner.ScanTokens()
+	if err := scanner.GetError(); err != nil {
+		return "", err
+	}
+	parser := NewParser(tokens, opts...)
+	stmts := parser.Parse()
+	if err := parser.GetError(); err != nil {
+		return "", err
+	}
+	return NewFormatter(parser.Comments()).Format(stmts), nil
+}
+
+// FormatExpr returns expr in the canonical layout.
+func FormatExpr(expr Expr) string {
+	return NewFormatter(nil).expr(expr)
+}
+
+// Format returns the formatted program.
+func (f *Formatter) Format(stmts []Stmt) string {
+	f.out.Reset()
+	f.indent = 0
+	f.stmts(stmts, f.comments.End)
+	return f.out.String()
+}
+
+// stmts prints statements one per line, followed by the comments that end
+// their enclosing body.
+func (f *Formatter) stmts(stmts []Stmt, inner []Token) {
+	prevEnd := 0 // last line printed, 0 at the start of a body
+	for _, stmt := range stmts {
+		trivia := f.trivia(stmt)
+		for _, comment := range trivia.Leading {
+			// a comment hoisted out of the statement keeps to its first line
+			prevEnd = f.comment(comment, min(comment.Line, trivia.First.Line), prevEnd)
+		}
+		f.blankLine(prevEnd, trivia.First.Line)
+		f.out.WriteString(f.pad())
+		_ = stmt.Accept(f)
+		f.out.WriteString(trailing(trivia.Trailing) + "\n")
+		prevEnd = trivia.EndLine
+	}
+	for _, comment := range inner {
+		prevEnd = f.comment(comment, comment.Line, prevEnd)
+	}
+}
+
+// comment prints a comment on a line of its own, spaced as if it started
+// on line.
+func (f *Formatter) comment(comment Token, line int, prevEnd int) int {
+	f.blankLine(prevEnd, line)
+	f.out.WriteString(f.pad() + comment.Lexeme + "\n")
+	return max(endLine(comment), line)
+}
+
+// blankLine keeps one blank line between what ended on prevEnd and what
+// starts on line, if the source has any.
+func (f *Formatter) blankLine(prevEnd int, line int) {
+	if prevEnd > 0 && line > prevEnd+1 {
+		f.out.WriteString("\n")
+	}
+}
+
+func (f *Formatter) trivia(stmt Stmt) *Trivia {
+	if trivia, ok := f.comments.Stmts[stmt]; ok {
+		return trivia
+	}
+	return &Trivia{}
+}
+
+func (f *Formatter) pad() string {
+	return strings.Repeat("  ", f.indent)
+}
+
+// body prints the braces and statements of a block, function or class body
+// owned by owner.
+func (f *Formatter) body(stmts []Stmt, owner Stmt) {
+	trivia := f.trivia(owner)
+	if len(stmts) == 0 && len(trivia.Inner) == 0 && len(trivia.Header) == 0 {
+		f.out.WriteString("{}")
+		return
+	}
+	f.out.WriteString("{" + trailing(trivia.Header) + "\n")
+	f.indent++
+	f.stmts(stmts, trivia.Inner)
+	f.indent--
+	f.out.WriteString(f.pad() + "}")
+}
+
+// trailing returns comments as they follow code on its line.
+func trailing(comments []Token) string {
+	var builder strings.Builder
+	for _, comment := range comments {
+		builder.WriteString(" " + comment.Lexeme)
+	}
+	return builder.String()
+}
+
+// branch prints the body of an if or loop: a block after a space, or any
+// other statement on the same line, unless comments follow the header.
+func (f *Formatter) branch(stmt Stmt) {
+	if block, ok := stmt.(*Block); ok && !f.isDesugaredFor(block) {
+		f.out.WriteString(" ")
+		f.body(block.Statements, block)
+		return
+	}
+	header := f.trivia(stmt).Header
+	if len(header) == 0 {
+		f.out.WriteString(" ")
+		_ = stmt.Accept(f)
+		return
+	}
+	f.indent++
+	f.out.WriteString(trailing(header) + "\n" + f.pad())
+	_ = stmt.Accept(f)
+	f.indent--
+}
+
+func (f *Formatter) VisitBlockStmt(stmt *Block) error {
+	if f.isDesugaredFor(stmt) {
+		f.forLoop(stmt.Statements[0], stmt.Statements[1])
+		return nil
+	}
+	f.body(stmt.Statements, stmt)
+	return nil
+}
+
+// isDesugaredFor reports whether block is a for loop with an initializer,
+// which the parser turns into a block of the initializer and the loop.
+func (f *Formatter) isDesugaredFor(block *Block) bool {
+	if len(block.Statements) != 2 {
+		return false
+	}
+	var keyword Token
+	switch loop := block.Statements[1].(type) {
+	case *While:
+		keyword = loop.Keyword
+	case *ForDesugaredWhile:
+		keyword = loop.Keyword
+	default:
+		return false
+	}
+	if keyword.TokenType != TOKEN_FOR {
+		return false
+	}
+	switch initializer := block.Statements[0].(type) {
+	case *Var:
+		// a variable declared in the for clauses comes after the keyword
+		return initializer.Name.Pos > keyword.Pos
+	case *Expression:
+		return true
+	}
+	return false
+}
+
+// forLoop prints a for loop from its desugared parts; initializer may be nil.
+func (f *Formatter) forLoop(initializer Stmt, loop Stmt) {
+	var condition, increment Expr
+	var body Stmt
+	switch loop := loop.(type) {
+	case *While:
+		condition, body = loop.Condition, loop.Body
+	case *ForDesugaredWhile:
+		condition, body, increment = loop.Condition, loop.Body, loop.Increment
+	}
+	f.out.WriteString("for (")
+	switch initializer := initializer.(type) {
+	case *Var:
+		f.out.WriteString(f.varDecl(initializer))
+	case *Expression:
+		f.out.WriteString(f.expr(initializer.Expression))
+	}
+	f.out.WriteString(";")
+	// a missing condition is parsed as true
+	if literal, ok := condition.(*Literal); !ok || literal.Value != true {
+		f.out.WriteString(" " + f.expr(condition))
+	}
+	f.out.WriteString(";")
+	if increment != nil {
+		f.out.WriteString(" " + f.expr(increment))
+	}
+	f.out.WriteString(")")
+	f.branch(body)
+}
+
+func (f *Formatter) VisitExpressionStmt(stmt *Expression) error {
+	f.out.WriteString(f.expr(stmt.Expression) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitPrintStmt(stmt *Print) error {
+	f.out.WriteString("print " + f.expr(stmt.Expression) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitVarStmt(stmt *Var) error {
+	f.out.WriteString(f.varDecl(stmt) + ";")
+	return nil
+}
+
+func (f *Formatter) varDecl(stmt *Var) string {
+	if stmt.Initializer == nil {
+		return "var " + stmt.Name.Lexeme
+	}
+	return "var " + stmt.Name.Lexeme + " = " + f.expr(stmt.Initializer)
+}
+
+func (f *Formatter) VisitIfStmt(stmt *If) error {
+	f.out.WriteString("if (" + f.expr(stmt.Condition) + ")")
+	f.branch(stmt.Thenbranch)
+	if stmt.Elsebranch == nil {
+		return nil
+	}
+	if block, ok := stmt.Thenbranch.(*Block); ok && !f.isDesugaredFor(block) {
+		f.out.WriteString(" else")
+	} else {
+		f.out.WriteString("\n" + f.pad() + "else")
+	}
+	if elseIf, ok := stmt.Elsebranch.(*If); ok && len(f.trivia(elseIf).Header) == 0 {
+		f.out.WriteString(" ")
+		return f.VisitIfStmt(elseIf)
+	}
+	f.branch(stmt.Elsebranch)
+	return nil
+}
+
+func (f *Formatter) VisitWhileStmt(stmt *While) error {
+	if stmt.Keyword.TokenType == TOKEN_FOR {
+		f.forLoop(nil, stmt)
+		return nil
+	}
+	f.out.WriteString("while (" + f.expr(stmt.Condition) + ")")
+	f.branch(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitForDesugaredWhileStmt(stmt *ForDesugaredWhile) error {
+	f.forLoop(nil, stmt)
+	return nil
+}
+
+func (f *Formatter) VisitForInStmt(stmt *ForIn) error {
+	f.out.WriteString("for (var " + stmt.Name.Lexeme + " in " + f.expr(stmt.Iterable) + ")")
+	f.branch(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitFunctionStmt(stmt *Function) error {
+	if !f.methods {
+		f.out.WriteString("fun ")
+	}
+	f.function(stmt)
+	return nil
+}
+
+// function prints the name, parameters and body of a function.
+func (f *Formatter) function(stmt *Function) {
+	params := make([]string, 0, len(stmt.Params))
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	f.out.WriteString(stmt.Name.Lexeme + "(" + strings.Join(params, ", ") + ") ")
+	methods := f.methods
+	f.methods = false
+	f.body(stmt.Body, stmt)
+	f.methods = methods
+}
+
+func (f *Formatter) VisitReturnStmt(stmt *Return) error {
+	if stmt.Value == nil {
+		f.out.WriteString("return;")
+		return nil
+	}
+	f.out.WriteString("return " + f.expr(stmt.Value) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitBreakStmt(stmt *Break) error {
+	f.out.WriteString("break;")
+	return nil
+}
+
+func (f *Formatter) VisitContinueStmt(stmt *Continue) error {
+	f.out.WriteString("continue;")
+	return nil
+}
+
+func (f *Formatter) VisitClassStmt(stmt *Class) error {
+	f.out.WriteString("class " + stmt.Name.Lexeme)
+	if stmt.Superclass != nil {
+		f.out.WriteString(" < " + stmt.Superclass.Name.Lexeme)
+	}
+	f.out.WriteString(" ")
+	methods := make([]Stmt, 0, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		methods = append(methods, method)
+	}
+	f.methods = true
+	f.body(methods, stmt)
+	f.methods = false
+	return nil
+}
+
+func (f *Formatter) VisitThrowStmt(stmt *Throw) error {
+	f.out.WriteString("throw " + f.expr(stmt.Value) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitTryStmt(stmt *Try) error {
+	f.out.WriteString("try ")
+	f.body(stmt.Body.Statements, stmt.Body)
+	if stmt.Handler != nil {
+		f.out.WriteString(" catch (" + stmt.Name.Lexeme + ") ")
+		f.body(stmt.Handler.Statements, stmt.Handler)
+	}
+	if stmt.Finally != nil {
+		f.out.WriteString(" finally ")
+		f.body(stmt.Finally.Statements, stmt.Finally)
+	}
+	return nil
+}
+
+func (f *Formatter) expr(expr Expr) string {
+	return expr.Accept(f).Value.(string)
+}
+
+func (f *Formatter) exprs(exprs []Expr) string {
+	parts := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		parts = append(parts, f.expr(expr))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *Formatter) VisitAssignExpr(expr *Assign) Result {
+	return Result{Value: expr.Name.Lexeme + " = " + f.expr(expr.Value)}
+}
+
+func (f *Formatter) VisitLogicalExpr(expr *Logical) Result {
+	return Result{Value: f.expr(expr.Left) + " " + expr.Operator.Lexeme + " " + f.expr(expr.Right)}
+}
+
+func (f *Formatter) VisitBinaryExpr(expr *Binary) Result {
+	return Result{Value: f.expr(expr.Left) + " " + expr.Operator.Lexeme + " " + f.expr(expr.Right)}
+}
+
+func (f *Formatter) VisitUnaryExpr(expr *Unary) Result {
+	return Result{Value: expr.Operator.Lexeme + f.expr(expr.Right)}
+}
+
+func (f *Formatter) VisitCallExpr(expr *Call) Result {
+	return Result{Value: f.expr(expr.Callee) + "(" + f.exprs(expr.Arguments) + ")"}
+}
+
+func (f *Formatter) VisitGetExpr(expr *Get) Result {
+	return Result{Value: f.expr(expr.Object) + "." + expr.Name.Lexeme}
+}
+
+func (f *Formatter) VisitSetExpr(expr *Set) Result {
+	return Result{Value: f.expr(expr.Object) + "." + expr.Name.Lexeme + " = " + f.expr(expr.Value)}
+}
+
+func (f *Formatter) VisitSuperExpr(expr *Super) Result {
+	return Result{Value: "super." + expr.Method.Lexeme}
+}
+
+func (f *Formatter) VisitThisExpr(expr *This) Result {
+	return Result{Value: "this"}
+}
+
+func (f *Formatter) VisitGroupingExpr(expr *Grouping) Result {
+	return Result{Value: "(" + f.expr(expr.Expression) + ")"}
+}
+
+func (f *Formatter) VisitLiteralExpr(expr *Literal) Result {
+	switch value := expr.Value.(type) {
+	case nil:
+		return Result{Value: "nil"}
+	case bool:
+		return Result{Value: strconv.FormatBool(value)}
+	case float64:
+		return Result{Value: strconv.FormatFloat(value, 'f', -1, 64)}
+	case string:
+		return Result{Value: `"` + stringText(expr.Token, value) + `"`}
+	}
+	return Result{Value: ""}
+}
+
+// stringText returns the text of a string literal, or of the part of an
+// interpolated one that token holds, as written in the source, so that its
+// escapes are kept. value is escaped for literals that weren't scanned.
+func stringText(token Token, value string) string {
+	lexeme := token.Lexeme
+	switch {
+	// "text" or, after an interpolation, }text"
+	case token.TokenType == TOKEN_STRING && len(lexeme) >= 2:
+		return lexeme[1 : len(lexeme)-1]
+	// "text${ or }text${
+	case token.TokenType == TOKEN_INTERPOLATION && len(lexeme) >= 3:
+		return lexeme[1 : len(lexeme)-2]
+	}
+	return escape(value)
+}
+
+// isStringLiteral reports whether token is a whole string literal, such as
+// one interpolated in another string, rather than a part of a string.
+func isStringLiteral(token Token) bool {
+	return token.TokenType == TOKEN_STRING && strings.HasPrefix(token.Lexeme, `"`)
+}
+
+// escape writes s as the contents of a string literal.
+func escape(s string) string {
+	var builder strings.Builder
+	for idx, r := range s {
+		switch r {
+		case '"', '\\':
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\t':
+			builder.WriteString(`\t`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case 0:
+			builder.WriteString(`\0`)
+		case '$':
+			if strings.HasPrefix(s[idx:], "${") {
+				builder.WriteRune('\\')
+			}
+			builder.WriteRune(r)
+		default:
+			if !unicode.IsPrint(r) {
+				fmt.Fprintf(&builder, `\u{%X}`, r)
+				continue
+			}
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func (f *Formatter) VisitVariableExpr(expr *Variable) Result {
+	return Result{Value: expr.Name.Lexeme}
+}
+
+// VisitAnonymousFunctionExpr prints the body at the indentation of the
+// statement the function is part of.
+func (f *Formatter) VisitAnonymousFunctionExpr(expr *AnonymousFunction) Result {
+	inner := &Formatter{indent: f.indent, comments: f.comments}
+	inner.out.WriteString("fun")
+	inner.function(expr.Decl)
+	return Result{Value: inner.out.String()}
+}
+
+func (f *Formatter) VisitListExpr(expr *List) Result {
+	if !f.hasComments(expr, expr.Elements) {
+		return Result{Value: "[" + f.exprs(expr.Elements) + "]"}
+	}
+	// the elements are a level deeper than the brackets
+	f.indent++
+	entries := make([]string, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		entries = append(entries, f.expr(element))
+	}
+	f.indent--
+	return Result{Value: f.literalLines("[", expr, expr.Elements, entries, "]")}
+}
+
+func (f *Formatter) VisitIndexExpr(expr *Index) Result {
+	return Result{Value: f.expr(expr.Object) + "[" + f.expr(expr.Index) + "]"}
+}
+
+func (f *Formatter) VisitIndexSetExpr(expr *IndexSet) Result {
+	return Result{Value: f.expr(expr.Object) + "[" + f.expr(expr.Index) + "] = " + f.expr(expr.Value)}
+}
+
+func (f *Formatter) VisitMapExpr(expr *Map) Result {
+	multiline := f.hasComments(expr, expr.Keys)
+	if multiline {
+		f.indent++
+	}
+	entries := make([]string, 0, len(expr.Keys))
+	for idx := range expr.Keys {
+		entries = append(entries, f.expr(expr.Keys[idx])+": "+f.expr(expr.Values[idx]))
+	}
+	if !multiline {
+		return Result{Value: "{" + strings.Join(entries, ", ") + "}"}
+	}
+	f.indent--
+	return Result{Value: f.literalLines("{", expr, expr.Keys, entries, "}")}
+}
+
+// hasComments reports whether the list or map literal holds comments, which
+// keep it on several lines.
+func (f *Formatter) hasComments(literal Expr, elements []Expr) bool {
+	if _, ok := f.comments.Exprs[literal]; ok {
+		return true
+	}
+	for _, element := range elements {
+		if _, ok := f.comments.Exprs[element]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// literalLines lays out the entries of a list or map literal one per line,
+// each followed by a comma, with the comments of its elements around them.
+func (f *Formatter) literalLines(open string, literal Expr, elements []Expr, entries []string, close string) string {
+	var builder strings.Builder
+	builder.WriteString(open + "\n")
+	pad := f.pad() + "  "
+	for idx, entry := range entries {
+		trivia := f.comments.Exprs[elements[idx]]
+		if trivia == nil {
+			trivia = &Trivia{}
+		}
+		for _, comment := range trivia.Leading {
+			builder.WriteString(pad + comment.Lexeme + "\n")
+		}
+		builder.WriteString(pad + entry + "," + trailing(trivia.Trailing) + "\n")
+	}
+	if trivia, ok := f.comments.Exprs[literal]; ok {
+		for _, comment := range trivia.Inner {
+			builder.WriteString(pad + comment.Lexeme + "\n")
+		}
+	}
+	builder.WriteString(f.pad() + close)
+	return builder.String()
+}
+
+func (f *Formatter) VisitInterpolationExpr(expr *Interpolation) Result {
+	var builder strings.Builder
+	builder.WriteString(`"`)
+	for _, part := range expr.Parts {
+		if literal, ok := part.(*Literal); ok && !isStringLiteral(literal.Token) {
+			if text, ok := literal.Value.(string); ok {
+				builder.WriteString(stringText(literal.Token, text))
+				continue
+			}
+		}
+		builder.WriteString("${" + f.expr(part) + "}")
+	}
+	builder.WriteString(`"`)
+	return Result{Value: builder.String()}
+}
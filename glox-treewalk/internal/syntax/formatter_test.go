@@ -0,0 +1,211 @@
+package syntax
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+func TestFormatTrailingComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			"statement",
+			"print 1; // one\n",
+			"print 1; // one\n",
+		},
+		{
+			"after if",
+			"if(x>y){return x;}else{return y;} // after if\n",
+			"if (x > y) {\n  return x;\n} else {\n  return y;\n} // after if\n",
+		},
+		{
+			"after method",
+			"class A { m() { print this.x; } /* after m */ }\n",
+			"class A {\n  m() {\n    print this.x;\n  } /* after m */\n}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testFormat(t, test.source, test.want)
+		})
+	}
+}
+
+func TestFormatEscapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"braced unicode", `print "\u{1F600}";`, `print "\u{1F600}";`},
+		{"control character", `print "\u0001";`, `print "\u0001";`},
+		{"simple escapes", `print "a\tb\n\"c\"\\\0\r";`, `print "a\tb\n\"c\"\\\0\r";`},
+		{"raw text", `print "größe 😀";`, `print "größe 😀";`},
+		{"escaped interpolation", `print "\${x}";`, `print "\${x}";`},
+		{"interpolation", `print "é${1+2}\t${"é"}";`, `print "é${1 + 2}\t${"é"}";`},
+		{"nested interpolation", `print "a${"b${c}"}d";`, `print "a${"b${c}"}d";`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testFormat(t, test.source+"\n", test.want+"\n")
+		})
+	}
+}
+
+func TestFormatEscapeValue(t *testing.T) {
+	// literals that weren't scanned have no lexeme to keep
+	literal := NewLiteral(Token{}, "a\"\x01\n${")
+	if got, want := FormatExpr(literal), `"a\"\u{1}\n\${"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			"after if condition",
+			"if (x) // c\n  print 1;\n",
+			"if (x) // c\n  print 1;\n",
+		},
+		{
+			"after while condition",
+			"while (x)   // c\nprint 1;\n",
+			"while (x) // c\n  print 1;\n",
+		},
+		{
+			"after for clauses",
+			"for (var i = 0; i < 3; i = i + 1) // c\n  print i;\n",
+			"for (var i = 0; i < 3; i = i + 1) // c\n  print i;\n",
+		},
+		{
+			"after else",
+			"if (x) print 1; else // c\n  print 2;\n",
+			"if (x) print 1;\nelse // c\n  print 2;\n",
+		},
+		{
+			"before the brace of a body",
+			"if (x) // c\n{\n  print 1;\n}\n",
+			"if (x) { // c\n  print 1;\n}\n",
+		},
+		{
+			"after an opening brace",
+			"fun f() { // f\n  print 1;\n}\nclass A { // a\n  m() {}\n}\n",
+			"fun f() { // f\n  print 1;\n}\nclass A { // a\n  m() {}\n}\n",
+		},
+		{
+			"in a list",
+			"var xs = [\n  1, // one\n  // two\n  2\n  // end\n];\n",
+			"var xs = [\n  1, // one\n  // two\n  2,\n  // end\n];\n",
+		},
+		{
+			"in a map",
+			"fun f() {\n  return {\n    \"a\": [1, 2], // a\n    \"b\": 2\n  };\n}\n",
+			"fun f() {\n  return {\n    \"a\": [1, 2], // a\n    \"b\": 2,\n  };\n}\n",
+		},
+		{
+			"list without comments",
+			"var xs = [\n  1,\n  2,\n];\n",
+			"var xs = [1, 2];\n",
+		},
+		{
+			"leading block",
+			"// one\n// two\nprint 1;\n",
+			"// one\n// two\nprint 1;\n",
+		},
+		{
+			"blank lines kept",
+			"// header\n\nprint 1;\n\n\n// two\nprint 2;\n",
+			"// header\n\nprint 1;\n\n// two\nprint 2;\n",
+		},
+		{
+			"hoisted out of a statement",
+			"print 0;\nvar x = 1 +\n  // c\n  2;\n",
+			"print 0;\n// c\nvar x = 1 + 2;\n",
+		},
+		{
+			"end of a body",
+			"{\n  print 1;\n  // end\n}\n",
+			"{\n  print 1;\n  // end\n}\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testFormat(t, test.source, test.want)
+		})
+	}
+}
+
+// TestFormatCorpus checks that formatting is idempotent, and keeps every
+// comment, on each script of the corpus.
+func TestFormatCorpus(t *testing.T) {
+	root := filepath.Join("..", "..", "..", "test")
+	top, _ := filepath.Glob(filepath.Join(root, "*.lox"))
+	nested, _ := filepath.Glob(filepath.Join(root, "*", "*.lox"))
+	paths := append(top, nested...)
+	if len(paths) == 0 {
+		t.Fatalf("no scripts found under %s", root)
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		once, err := FormatSource(string(source), util.WithReporter(func(*util.Diagnostic) {}))
+		if err != nil {
+			continue // scripts testing syntax errors
+		}
+		twice, err := FormatSource(once)
+		if err != nil {
+			t.Errorf("%s: formatted script doesn't parse: %s", path, err)
+			continue
+		}
+		if once != twice {
+			t.Errorf("%s: formatting isn't idempotent\nonce\n%s\ntwice\n%s", path, once, twice)
+		}
+		if got, want := countComments(t, once), countComments(t, string(source)); got != want {
+			t.Errorf("%s: %d comments after formatting, want %d", path, got, want)
+		}
+	}
+}
+
+func countComments(t *testing.T, source string) int {
+	t.Helper()
+	scanner := NewScanner(source, util.WithComments(), util.WithReporter(func(*util.Diagnostic) {}))
+	count := 0
+	for _, token := range scanner.ScanTokens() {
+		if token.TokenType == TOKEN_COMMENT {
+			count++
+		}
+	}
+	return count
+}
+
+// testFormat checks that source formats as want, and that want is left as
+// it is.
+func testFormat(t *testing.T, source string, want string) {
+	t.Helper()
+	got, err := FormatSource(source)
+	if err != nil {
+		t.Fatalf("format: %s", err)
+	}
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	again, err := FormatSource(got)
+	if err != nil {
+		t.Fatalf("format again: %s", err)
+	}
+	if again != got {
+		t.Errorf("not idempotent, formatted again\n%s", again)
+	}
+}
@@ -1,7 +1,9 @@
 package syntax
 
 import (
-	"fmt"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
 )
 
 /*
@@ -18,6 +20,7 @@ Unary: 	     ! -	       Right
 
 expression     ->  assignment
 assignment     ->  (call "." )? IDENTIFIER "=" assignment
+                   | call "[" expression "]" "=" assignment
                    | logical_or
 
 logical_or     ->  logical_and ( "or" logical_and )*
@@ -25,11 +28,15 @@ logical_and    ->  equality ( "and" equality )*
 equality       ->  comparison ( ( "!=" | "==" ) comparison )*
 comparison     ->  term ( ( ">" | ">=" | "<" | "<=" ) term )*
 term           ->  factor ( ( "-" | "+" ) factor )*
-factor         ->  unary ( ( "/" | "*" ) unary )*
+factor         ->  unary ( ( "/" | "*" | "%" ) unary )*
 unary          ->  ( "!" | "-" ) unary | call
-call           → primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
+call           → primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
 primary        ->  NUMBER | STRING | "false" | "true" | "nil" | "(" expression ")" | IDENTIFIER
-                 | anonymous_func | super "." IDENTIFIER
+                 | anonymous_func | super "." IDENTIFIER | list | map | interpolation
+interpolation  ->  ( INTERPOLATION expression )+ STRING
+list           ->  "[" ( expression ( "," expression )* ","? )? "]"
+map            ->  "{" ( entry ( "," entry )* ","? )? "}"
+entry          ->  expression ":" expression
 anonymous_func ->  "fun" "(" parameters? ")" block
 arguments      ->  expression ( "," expression )* ;
 
@@ -59,6 +66,8 @@ statement      -> exprStmt
 			    | breakStmt
 			    | continueStmt
                 | returnStmt
+                | throwStmt
+                | tryStmt
 
 exprStmt       ->  expression ";" ;
 printStmt      -> "print" expression ";"
@@ -67,33 +76,48 @@ ifStmt         -> "if" "(" expression ")" statement ( "else" statement )?
 whileStmt      -> "while" "(" expression ")" statement
 forStmt        -> "for" "(" ( varDecl | exprStmt | ";" )
 				  expression? ";" expression? ")" statement
+				| "for" "(" "var" IDENTIFIER "in" expression ")" statement
 breakStmt      -> "break" ";"
 continueStmt   -> "continue" ";"
 returnStmt     -> "return" expression? ";"
+throwStmt      -> "throw" expression ";"
+tryStmt        -> "try" block ( "catch" "(" IDENTIFIER ")" block )? ( "finally" block )?
 */
 
 type Parser struct {
 	Tokens    []Token
 	Current   int
 	parseErr  error
+	errs      []*util.Diagnostic
 	loopDepth int
+	braces    int   // '{' consumed and not closed yet
+	blocks    []int // braces when each enclosing block was opened
+	opts      *util.Options
+	// with util.WithComments
+	comments *Comments
+	pending  []Token // comments not attached yet
+	inner    []Token // comments before the closing brace just consumed
+	header   []Token // comments after the opening brace of that body
 }
 
-func NewParser(tokens []Token) *Parser {
-	return &Parser{
-		Tokens:  tokens,
+func NewParser(tokens []Token, opts ...util.Option) *Parser {
+	p := &Parser{
 		Current: 0,
+		opts:    util.NewOptions(opts...),
+	}
+	p.Tokens = p.splitComments(tokens)
+	if p.opts.Comments {
+		p.comments = &Comments{Stmts: make(map[Stmt]*Trivia), Exprs: make(map[Expr]*Trivia)}
 	}
+	return p
 }
 
 func (p *Parser) Parse() []Stmt {
 	stmts := make([]Stmt, 0)
 	for !p.isEnd() {
-		stmt, err := p.parseDeclaration()
+		stmt, err := p.withTrivia(p.parseDeclaration)
 		if err != nil {
-			// record the last error
-			fmt.Printf("parse Err:%s\n", err.Error())
-			p.parseErr = err
+			p.recordError(err)
 			p.synchronize()
 			continue
 		}
@@ -102,6 +126,14 @@ func (p *Parser) Parse() []Stmt {
 	return stmts
 }
 
+// record every error, GetError returns the last one
+func (p *Parser) recordError(err error) {
+	d := util.AsDiagnostic(err)
+	p.opts.ReportDiagnostic(d)
+	p.errs = append(p.errs, d)
+	p.parseErr = d
+}
+
 func (p *Parser) parseDeclaration() (Stmt, error) {
 	if p.match(TOKEN_CLASS) {
 		return p.parseClassDecl()
@@ -128,18 +160,24 @@ func (p *Parser) parseClassDecl() (*Class, error) {
 		superClass = NewVariable(p.previous())
 	}
 	if p.match(TOKEN_LEFT_BRACE) {
+		header := p.takeLine()
 		methods := make([]*Function, 0)
 		for !p.check(TOKEN_RIGHT_BRACE) && !p.isEnd() {
-			method, err := p.parseFunction(false, "method")
+			method, err := p.withTrivia(func() (Stmt, error) {
+				return p.parseFunction(false, "method")
+			})
 			if err != nil {
 				return nil, err
 			}
-			methods = append(methods, method)
+			methods = append(methods, method.(*Function))
 		}
+		p.takeInner(header)
 		if cErr := p.consume(TOKEN_RIGHT_BRACE, "expect '}' after class body"); cErr != nil {
 			return nil, cErr
 		}
-		return NewClass(name, superClass, methods), nil
+		class := NewClass(name, superClass, methods)
+		p.attachInner(class)
+		return class, nil
 	}
 	return nil, p.error(p.peek(), "expect '{' after class name")
 }
@@ -180,7 +218,9 @@ func (p *Parser) parseFunction(anonymous bool, kind string) (*Function, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewFunction(name, params, body), nil
+	function := NewFunction(name, params, body)
+	p.attachInner(function)
+	return function, nil
 }
 
 func (p *Parser) parseVarDecl() (Stmt, error) {
@@ -225,12 +265,21 @@ func (p *Parser) parseStmt() (Stmt, error) {
 	if p.match(TOKEN_RETURN) {
 		return p.parseReturnStmt()
 	}
+	if p.match(TOKEN_THROW) {
+		return p.parseThrowStmt()
+	}
+	if p.match(TOKEN_TRY) {
+		return p.parseTryStmt()
+	}
 	if p.match(TOKEN_LEFT_BRACE) {
+		brace := p.previous()
 		blocks, bErr := p.parseBlocks()
 		if bErr != nil {
 			return nil, bErr
 		}
-		return NewBlock(blocks), nil
+		block := NewBlock(brace, blocks, p.previous())
+		p.attachInner(block)
+		return block, nil
 	}
 	return p.parseExprStmt()
 }
@@ -251,34 +300,102 @@ func (p *Parser) parseReturnStmt() (Stmt, error) {
 	return NewReturn(keyword, value), nil
 }
 
+func (p *Parser) parseThrowStmt() (Stmt, error) {
+	keyword := p.previous()
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if cErr := p.consume(TOKEN_SEMICOLON, "expect ';' after thrown value"); cErr != nil {
+		return nil, cErr
+	}
+	return NewThrow(keyword, value), nil
+}
+
+// parseTryStmt parses a try statement, which needs a catch clause, a
+// finally clause or both.
+func (p *Parser) parseTryStmt() (Stmt, error) {
+	keyword := p.previous()
+	body, err := p.parseBlockAfter("'try'")
+	if err != nil {
+		return nil, err
+	}
+	var name Token
+	var handler, finally *Block
+	if p.match(TOKEN_CATCH) {
+		if cErr := p.consume(TOKEN_LEFT_PAREN, "expect '(' after 'catch'"); cErr != nil {
+			return nil, cErr
+		}
+		if cErr := p.consume(TOKEN_IDENTIFIER, "expect error variable name"); cErr != nil {
+			return nil, cErr
+		}
+		name = p.previous()
+		if cErr := p.consume(TOKEN_RIGHT_PAREN, "expect ')' after error variable"); cErr != nil {
+			return nil, cErr
+		}
+		if handler, err = p.parseBlockAfter("catch clause"); err != nil {
+			return nil, err
+		}
+	}
+	if p.match(TOKEN_FINALLY) {
+		if finally, err = p.parseBlockAfter("'finally'"); err != nil {
+			return nil, err
+		}
+	}
+	if handler == nil && finally == nil {
+		return nil, p.error(p.peek(), "expect 'catch' or 'finally' after try block")
+	}
+	return NewTry(keyword, body, name, handler, finally), nil
+}
+
+func (p *Parser) parseBlockAfter(what string) (*Block, error) {
+	if err := p.consume(TOKEN_LEFT_BRACE, "expect '{' after "+what); err != nil {
+		return nil, err
+	}
+	brace := p.previous()
+	stmts, err := p.parseBlocks()
+	if err != nil {
+		return nil, err
+	}
+	block := NewBlock(brace, stmts, p.previous())
+	p.attachInner(block)
+	return block, nil
+}
+
 func (p *Parser) parseBreakStmt() (Stmt, error) {
+	keyword := p.previous()
 	if p.loopDepth == 0 {
-		return nil, p.error(p.previous(), "break not inside loop")
+		return nil, p.error(keyword, "break not inside loop")
 	}
 	if cErr := p.consume(TOKEN_SEMICOLON, "expect ';' after break"); cErr != nil {
 		return nil, cErr
 	}
-	return NewBreak(p.previous()), nil
+	return NewBreak(keyword), nil
 }
 
 func (p *Parser) parseContinueStmt() (Stmt, error) {
+	keyword := p.previous()
 	if p.loopDepth == 0 {
-		return nil, p.error(p.previous(), "continue not inside loop")
+		return nil, p.error(keyword, "continue not inside loop")
 	}
 	if cErr := p.consume(TOKEN_SEMICOLON, "expect ';' after continue"); cErr != nil {
 		return nil, cErr
 	}
-	return NewContinue(p.previous()), nil
+	return NewContinue(keyword), nil
 }
 
 // desugar for loop
 func (p *Parser) parseForStmt() (Stmt, error) {
+	keyword := p.previous()
 	p.loopDepth++
 	defer func() { p.loopDepth-- }()
 	var err error
 	if err = p.consume(TOKEN_LEFT_PAREN, "expect '(' after 'for'"); err != nil {
 		return nil, err
 	}
+	if p.isForIn() {
+		return p.parseForIn(keyword)
+	}
 	var initializer Stmt
 	if p.match(TOKEN_SEMICOLON) {
 	} else if p.match(TOKEN_VAR) {
@@ -313,26 +430,56 @@ func (p *Parser) parseForStmt() (Stmt, error) {
 		return nil, cErr
 	}
 	var body Stmt
-	body, err = p.parseStmt()
+	body, err = p.parseBody()
 	if err != nil {
 		return nil, err
 	}
 	if condition == nil {
 		// if condition is nil, use true
-		condition = NewLiteral(true)
+		condition = NewLiteral(keyword, true)
 	}
 	if increment == nil {
-		body = NewWhile(condition, body)
+		body = NewWhile(keyword, condition, body)
 	} else {
-		body = NewForDesugaredWhile(condition, body, increment)
+		body = NewForDesugaredWhile(keyword, condition, body, increment)
 	}
 	if initializer != nil {
-		body = NewBlock([]Stmt{initializer, body})
+		body = NewBlock(keyword, []Stmt{initializer, body}, p.previous())
 	}
 	return body, nil
 }
 
+// isForIn reports whether the for clauses start with "var name in". "in" is
+// only a keyword in this position, so it remains usable as an identifier.
+func (p *Parser) isForIn() bool {
+	if p.Current+2 >= len(p.Tokens) {
+		return false
+	}
+	name, in := p.Tokens[p.Current+1], p.Tokens[p.Current+2]
+	return p.check(TOKEN_VAR) && name.TokenType == TOKEN_IDENTIFIER &&
+		in.TokenType == TOKEN_IDENTIFIER && in.Lexeme == "in"
+}
+
+func (p *Parser) parseForIn(keyword Token) (Stmt, error) {
+	p.advance() // var
+	name := p.advance()
+	p.advance() // in
+	iterable, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if cErr := p.consume(TOKEN_RIGHT_PAREN, "expect ')' after for-in clause"); cErr != nil {
+		return nil, cErr
+	}
+	body, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	return NewForIn(keyword, name, iterable, body), nil
+}
+
 func (p *Parser) parseWhileStmt() (Stmt, error) {
+	keyword := p.previous()
 	p.loopDepth++
 	defer func() { p.loopDepth-- }()
 	if err := p.consume(TOKEN_LEFT_PAREN, "expect '(' after 'while'."); err != nil {
@@ -345,11 +492,11 @@ func (p *Parser) parseWhileStmt() (Stmt, error) {
 	if cErr := p.consume(TOKEN_RIGHT_PAREN, "expect ')' after while condition"); cErr != nil {
 		return nil, cErr
 	}
-	body, err := p.parseStmt()
+	body, err := p.parseBody()
 	if err != nil {
 		return nil, err
 	}
-	return NewWhile(condition, body), nil
+	return NewWhile(keyword, condition, body), nil
 }
 
 func (p *Parser) parseIfStmt() (Stmt, error) {
@@ -363,13 +510,13 @@ func (p *Parser) parseIfStmt() (Stmt, error) {
 	if cErr := p.consume(TOKEN_RIGHT_PAREN, "expect ')' after if condition"); cErr != nil {
 		return nil, cErr
 	}
-	thenBranch, err := p.parseStmt()
+	thenBranch, err := p.parseBody()
 	if err != nil {
 		return nil, err
 	}
 	var elseBranch Stmt
 	if p.match(TOKEN_ELSE) {
-		elseBranch, err = p.parseStmt()
+		elseBranch, err = p.parseBody()
 		if err != nil {
 			return nil, err
 		}
@@ -377,15 +524,35 @@ func (p *Parser) parseIfStmt() (Stmt, error) {
 	return NewIf(condition, thenBranch, elseBranch), nil
 }
 
+// parseBody parses the body of an if, else or loop, keeping the comments on
+// the line of its header with it.
+func (p *Parser) parseBody() (Stmt, error) {
+	header := p.takeLine()
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	p.attachHeader(body, header)
+	return body, nil
+}
+
+// parseBlocks keeps going after an error in one of the block's statements,
+// so that later errors in the same block are reported too.
 func (p *Parser) parseBlocks() ([]Stmt, error) {
+	p.blocks = append(p.blocks, p.braces)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
+	header := p.takeLine()
 	stmts := make([]Stmt, 0)
 	for !p.check(TOKEN_RIGHT_BRACE) && !p.isEnd() {
-		stmt, err := p.parseDeclaration()
+		stmt, err := p.withTrivia(p.parseDeclaration)
 		if err != nil {
-			return nil, err
+			p.recordError(err)
+			p.synchronize()
+			continue
 		}
 		stmts = append(stmts, stmt)
 	}
+	p.takeInner(header)
 	if cErr := p.consume(TOKEN_RIGHT_BRACE, "expect '}' after block"); cErr != nil {
 		return nil, cErr
 	}
@@ -435,6 +602,8 @@ func (p *Parser) parseAssignment() (Expr, error) {
 			return NewAssign(variable.Name, value), nil
 		} else if variable, ok := expr.(*Get); ok {
 			return NewSet(variable.Object, variable.Name, value), nil
+		} else if index, ok := expr.(*Index); ok {
+			return NewIndexSet(index.Object, index.Bracket, index.Index, value), nil
 		}
 
 		return nil, p.error(equalToken, "Invalid assignment target.")
@@ -538,7 +707,7 @@ func (p *Parser) parseFactor() (Expr, error) {
 		return nil, err
 	}
 
-	if p.match(TOKEN_SLASH, TOKEN_STAR) {
+	for p.match(TOKEN_SLASH, TOKEN_STAR, TOKEN_PERCENT) {
 		op := p.previous()
 		right, err := p.parseUnary()
 		if err != nil {
@@ -581,6 +750,15 @@ func (p *Parser) parseCall() (Expr, error) {
 				return nil, err
 			}
 			expr = NewGet(expr, p.previous())
+		} else if p.match(TOKEN_LEFT_BRACKET) {
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if cErr := p.consume(TOKEN_RIGHT_BRACKET, "expect ']' after index"); cErr != nil {
+				return nil, cErr
+			}
+			expr = NewIndex(expr, p.previous(), index)
 		} else {
 			break
 		}
@@ -621,20 +799,20 @@ func (p *Parser) parseAnonymousFunction() (Expr, error) {
 }
 
 func (p *Parser) parsePrimary() (Expr, error) {
-	if p.match(TOKEN_NUMBER) {
-		return &Literal{Value: p.previous().Literal}, nil
+	if p.match(TOKEN_NUMBER, TOKEN_STRING) {
+		return NewLiteral(p.previous(), p.previous().Literal), nil
 	}
-	if p.match(TOKEN_STRING) {
-		return &Literal{Value: p.previous().Literal}, nil
+	if p.match(TOKEN_INTERPOLATION) {
+		return p.parseInterpolation()
 	}
 	if p.match(TOKEN_TRUE) {
-		return &Literal{Value: true}, nil
+		return NewLiteral(p.previous(), true), nil
 	}
 	if p.match(TOKEN_FALSE) {
-		return &Literal{Value: false}, nil
+		return NewLiteral(p.previous(), false), nil
 	}
 	if p.match(TOKEN_NIL) {
-		return &Literal{Value: nil}, nil
+		return NewLiteral(p.previous(), nil), nil
 	}
 	if p.match(TOKEN_THIS) {
 		return NewThis(p.previous()), nil
@@ -663,11 +841,108 @@ func (p *Parser) parsePrimary() (Expr, error) {
 		if cErr := p.consume(TOKEN_RIGHT_PAREN, "expect ')' after expression"); cErr != nil {
 			return nil, cErr
 		}
-		return expr, nil
+		return NewGrouping(expr), nil
+	}
+	if p.match(TOKEN_LEFT_BRACKET) {
+		return p.parseList()
+	}
+	if p.match(TOKEN_LEFT_BRACE) {
+		return p.parseMap()
 	}
 	return nil, p.error(p.peek(), "expect expression")
 }
 
+// parseInterpolation parses a string with embedded expressions. The scanner
+// splits it into an interpolation token holding the text before each "${",
+// and a string token holding the text after the last "}".
+func (p *Parser) parseInterpolation() (Expr, error) {
+	quote := p.previous()
+	parts := make([]Expr, 0)
+	for {
+		if text := p.previous().Literal.(string); text != "" {
+			parts = append(parts, NewLiteral(p.previous(), text))
+		}
+		if p.previous().TokenType == TOKEN_STRING {
+			return NewInterpolation(quote, parts), nil
+		}
+		// the rest of the string starts with the "}" of an empty "${}"
+		if strings.HasPrefix(p.peek().Lexeme, "}") {
+			return nil, p.error(p.peek(), "expect expression in interpolation")
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+		if !p.match(TOKEN_INTERPOLATION, TOKEN_STRING) {
+			return nil, p.error(p.peek(), "expect '}' after interpolated expression")
+		}
+	}
+}
+
+// parseList parses the elements of a list literal, allowing a trailing comma.
+func (p *Parser) parseList() (Expr, error) {
+	bracket := p.previous()
+	elements := make([]Expr, 0)
+	for !p.check(TOKEN_RIGHT_BRACKET) {
+		leading := p.takeComments(p.peek().Pos)
+		element, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		more := p.match(TOKEN_COMMA)
+		p.elementTrivia(element, leading)
+		if !more {
+			break
+		}
+	}
+	inner := p.takeComments(p.peek().Pos)
+	if err := p.consume(TOKEN_RIGHT_BRACKET, "expect ']' after list elements"); err != nil {
+		return nil, err
+	}
+	list := NewList(bracket, elements)
+	p.literalInner(list, inner)
+	return list, nil
+}
+
+// parseMap parses the entries of a map literal, allowing a trailing comma.
+// A '{' starting a statement begins a block, so map literals only appear
+// inside expressions.
+func (p *Parser) parseMap() (Expr, error) {
+	brace := p.previous()
+	keys := make([]Expr, 0)
+	values := make([]Expr, 0)
+	for !p.check(TOKEN_RIGHT_BRACE) {
+		leading := p.takeComments(p.peek().Pos)
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if cErr := p.consume(TOKEN_COLON, "expect ':' after map key"); cErr != nil {
+			return nil, cErr
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		more := p.match(TOKEN_COMMA)
+		p.elementTrivia(key, leading)
+		if !more {
+			break
+		}
+	}
+	inner := p.takeComments(p.peek().Pos)
+	if err := p.consume(TOKEN_RIGHT_BRACE, "expect '}' after map entries"); err != nil {
+		return nil, err
+	}
+	literal := NewMap(brace, keys, values)
+	p.literalInner(literal, inner)
+	return literal, nil
+}
+
 func (p *Parser) match(tokenTypes ...TokenType) bool {
 	for _, type_ := range tokenTypes {
 		if p.check(type_) {
@@ -696,6 +971,12 @@ func (p *Parser) peek() Token {
 func (p *Parser) advance() Token {
 	if !p.isEnd() {
 		p.Current++
+		switch p.Tokens[p.Current-1].TokenType {
+		case TOKEN_LEFT_BRACE:
+			p.braces++
+		case TOKEN_RIGHT_BRACE:
+			p.braces--
+		}
 	}
 	return p.Tokens[p.Current-1]
 }
@@ -713,26 +994,47 @@ func (p *Parser) consume(tokenType TokenType, message string) error {
 }
 
 func (p *Parser) error(token Token, message string) error {
-	return fmt.Errorf("%s, at line %d, got %v instead", message, token.Line, token)
+	return ErrorAt(token, util.CodeSyntax, message)
 }
 
 // Synchronize the parser when it encounters a syntax error.
 //
-//	just skip to the next statement.
+//	just skip to the next statement, or to the end of the enclosing block.
+//	A '}' closing a map literal the error left open is skipped, rather than
+//	taken for the end of the block.
 func (p *Parser) synchronize() {
+	if p.closesBlock() {
+		return
+	}
 	p.advance()
 	for !p.isEnd() {
 		if p.previous().TokenType == TOKEN_SEMICOLON {
 			return
 		}
 		switch p.peek().TokenType {
-		case TOKEN_CLASS, TOKEN_FUN, TOKEN_VAR, TOKEN_FOR, TOKEN_IF, TOKEN_WHILE, TOKEN_PRINT, TOKEN_RETURN:
+		case TOKEN_CLASS, TOKEN_FUN, TOKEN_VAR, TOKEN_FOR, TOKEN_IF, TOKEN_WHILE, TOKEN_PRINT, TOKEN_RETURN,
+			TOKEN_THROW, TOKEN_TRY:
 			return
+		case TOKEN_RIGHT_BRACE:
+			if p.closesBlock() {
+				return
+			}
 		}
 		p.advance()
 	}
 }
 
+// closesBlock reports whether the next token is the '}' of the innermost
+// enclosing block.
+func (p *Parser) closesBlock() bool {
+	return len(p.blocks) > 0 && p.check(TOKEN_RIGHT_BRACE) && p.braces == p.blocks[len(p.blocks)-1]
+}
+
 func (p *Parser) GetError() error {
 	return p.parseErr
 }
+
+// GetErrors returns every syntax error, in source order.
+func (p *Parser) GetErrors() []*util.Diagnostic {
+	return p.errs
+}
@@ -1,8 +1,11 @@
 package syntax
 
 import (
-	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/littlekuo/glox-treewalk/internal/util"
 )
@@ -26,6 +29,20 @@ var keywords = map[string]TokenType{
 	"while":    TOKEN_WHILE,
 	"break":    TOKEN_BREAK,
 	"continue": TOKEN_CONTINUE,
+	"throw":    TOKEN_THROW,
+	"try":      TOKEN_TRY,
+	"catch":    TOKEN_CATCH,
+	"finally":  TOKEN_FINALLY,
+}
+
+// Keywords returns the reserved words of Lox in alphabetical order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 type Scanner struct {
@@ -34,15 +51,32 @@ type Scanner struct {
 	start   int
 	current int
 	// line number
-	line    int
-	scanErr error
+	line int
+	// column of current and start, counted in runes from 1
+	column      int
+	startColumn int
+	scanErr     error
+	errs        []*util.Diagnostic
+	opts        *util.Options
+	// strings whose "${" expression is being scanned, innermost last
+	interpolations []interpolation
+}
+
+// interpolation is a string interrupted by a "${" expression. The string
+// resumes at the "}" that brings depth back below zero.
+type interpolation struct {
+	line  int // where the string starts
+	start int
+	depth int // braces opened inside the expression
 }
 
-func NewScanner(source string) *Scanner {
+func NewScanner(source string, opts ...util.Option) *Scanner {
 	return &Scanner{
 		source: source,
 		tokens: make([]Token, 0),
 		line:   1,
+		column: 1,
+		opts:   util.NewOptions(opts...),
 	}
 }
 
@@ -52,8 +86,13 @@ func (s *Scanner) ScanTokens() []Token {
 			break
 		}
 		s.start = s.current
+		s.startColumn = s.column
 		s.scanToken()
 	}
+	if n := len(s.interpolations); n > 0 {
+		open := s.interpolations[n-1]
+		s.error(open.line, open.start, 1, util.CodeUnterminatedString, "Unterminated string.")
+	}
 
 	// the last token
 	s.tokens = append(s.tokens, NewToken(TOKEN_EOF, "", nil, s.line, s.start))
@@ -68,8 +107,19 @@ func (s *Scanner) scanToken() {
 	case ')':
 		s.addSimpleToken(TOKEN_RIGHT_PAREN)
 	case '{':
+		if n := len(s.interpolations); n > 0 {
+			s.interpolations[n-1].depth++
+		}
 		s.addSimpleToken(TOKEN_LEFT_BRACE)
 	case '}':
+		if n := len(s.interpolations); n > 0 {
+			if open := s.interpolations[n-1]; open.depth == 0 {
+				s.interpolations = s.interpolations[:n-1]
+				s.scanStringPart(open.line, open.start)
+				return
+			}
+			s.interpolations[n-1].depth--
+		}
 		s.addSimpleToken(TOKEN_RIGHT_BRACE)
 	case ',':
 		s.addSimpleToken(TOKEN_COMMA)
@@ -79,10 +129,18 @@ func (s *Scanner) scanToken() {
 		s.addSimpleToken(TOKEN_MINUS)
 	case '+':
 		s.addSimpleToken(TOKEN_PLUS)
+	case '[':
+		s.addSimpleToken(TOKEN_LEFT_BRACKET)
+	case ']':
+		s.addSimpleToken(TOKEN_RIGHT_BRACKET)
+	case ':':
+		s.addSimpleToken(TOKEN_COLON)
 	case ';':
 		s.addSimpleToken(TOKEN_SEMICOLON)
 	case '*':
 		s.addSimpleToken(TOKEN_STAR)
+	case '%':
+		s.addSimpleToken(TOKEN_PERCENT)
 	case '!':
 		s.addConditionalToken('=', TOKEN_BANG_EQUAL, TOKEN_BANG)
 	case '=':
@@ -97,24 +155,30 @@ func (s *Scanner) scanToken() {
 			for s.peek() != '\n' && !s.isEnd() {
 				s.advance()
 			}
+			s.addComment(s.line)
 		} else if s.match('*') {
-			s.scanBlockComment()
+			startLine := s.line
+			if s.scanBlockComment() {
+				s.addComment(startLine)
+			}
 		} else {
 			s.addSimpleToken(TOKEN_SLASH)
 		}
 	case ' ', '\r', '\t':
 		// Ignore whitespace.
 	case '\n':
-		s.line++
+		// advance moved on to the next line
 	case '"':
 		s.scanString()
 	default:
 		if isDigit(c) {
 			s.scanNumber()
-		} else if isAlpha(c) {
+		} else if isIdentifierStart(c) {
 			s.scanIdentifier()
+		} else if c == utf8.RuneError && s.current-s.start == 1 {
+			// reported by advance
 		} else {
-			s.error(s.line, "Unexpected character.")
+			s.error(s.line, s.start, s.current-s.start, util.CodeUnexpectedChar, "Unexpected character.")
 		}
 	}
 }
@@ -125,7 +189,21 @@ func (s *Scanner) addSimpleToken(tk TokenType) {
 
 func (s *Scanner) addTokenWithLiteral(tk TokenType, literal any) {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, NewToken(tk, text, literal, s.line, s.start))
+	token := NewToken(tk, text, literal, s.line, s.start)
+	token.Column = s.startColumn
+	s.tokens = append(s.tokens, token)
+}
+
+// addComment keeps the comment just scanned, which starts on line, if the
+// scanner runs with util.WithComments.
+func (s *Scanner) addComment(line int) {
+	if !s.opts.Comments {
+		return
+	}
+	text := strings.TrimRight(s.source[s.start:s.current], "\r")
+	token := NewToken(TOKEN_COMMENT, text, nil, line, s.start)
+	token.Column = s.startColumn
+	s.tokens = append(s.tokens, token)
 }
 
 func (s *Scanner) isEnd() bool {
@@ -136,7 +214,12 @@ func (s *Scanner) GetError() error {
 	return s.scanErr
 }
 
-func (s *Scanner) addConditionalToken(expected byte, matchedType TokenType, unmatchedType TokenType) {
+// GetErrors returns every error found while scanning, in source order.
+func (s *Scanner) GetErrors() []*util.Diagnostic {
+	return s.errs
+}
+
+func (s *Scanner) addConditionalToken(expected rune, matchedType TokenType, unmatchedType TokenType) {
 	if s.match(expected) {
 		s.addSimpleToken(matchedType)
 	} else {
@@ -144,55 +227,146 @@ func (s *Scanner) addConditionalToken(expected byte, matchedType TokenType, unma
 	}
 }
 
-func (s *Scanner) match(expected byte) bool {
+func (s *Scanner) match(expected rune) bool {
 	if s.isEnd() {
 		return false
 	}
-	if s.source[s.current] != expected {
+	if s.peek() != expected {
 		return false
 	}
 
 	// if match, then advance
-	s.current++
+	s.advance()
 	return true
 }
 
-func (s *Scanner) advance() byte {
-	s.current++
-	return s.source[s.current-1]
+// advance consumes the next rune, keeping line and column up to date. Bytes
+// that aren't valid UTF-8 are reported, and consumed one at a time as
+// utf8.RuneError.
+func (s *Scanner) advance() rune {
+	r, size := utf8.DecodeRuneInString(s.source[s.current:])
+	if r == utf8.RuneError && size == 1 {
+		s.error(s.line, s.current, 1, util.CodeInvalidUTF8, "Invalid UTF-8 encoding.")
+	}
+	s.current += size
+	if r == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
+	return r
 }
 
-func (s *Scanner) peek() byte {
+func (s *Scanner) peek() rune {
 	if s.isEnd() {
 		return 0
 	}
-	return s.source[s.current]
+	r, _ := utf8.DecodeRuneInString(s.source[s.current:])
+	return r
 }
 
-func (s *Scanner) peekNext() byte {
-	if s.current+1 >= len(s.source) {
+func (s *Scanner) peekNext() rune {
+	if s.isEnd() {
 		return 0
 	}
-	return s.source[s.current+1]
+	_, size := utf8.DecodeRuneInString(s.source[s.current:])
+	if s.current+size >= len(s.source) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(s.source[s.current+size:])
+	return r
 }
 
 func (s *Scanner) scanString() {
+	s.scanStringPart(s.line, s.start)
+}
+
+// scanStringPart scans a string up to its closing quote, or up to the next
+// "${", whose expression is then scanned as ordinary tokens. line and start
+// locate the opening quote of the string.
+func (s *Scanner) scanStringPart(line int, start int) {
+	var text strings.Builder
 	for s.peek() != '"' && !s.isEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		switch {
+		case s.peek() == '\\':
+			s.scanEscape(&text)
+		case s.peek() == '$' && s.peekNext() == '{':
+			s.advance()
+			s.advance()
+			s.interpolations = append(s.interpolations, interpolation{line: line, start: start})
+			s.addTokenWithLiteral(TOKEN_INTERPOLATION, text.String())
+			return
+		default:
+			text.WriteRune(s.advance())
 		}
-		s.advance()
 	}
 
 	if s.isEnd() {
-		s.error(s.line, "Unterminated string")
+		s.error(line, start, 1, util.CodeUnterminatedString, "Unterminated string.")
 		return
 	}
 
 	// the closing ".
 	s.advance()
 
-	s.addTokenWithLiteral(TOKEN_STRING, s.source[s.start+1:s.current-1])
+	s.addTokenWithLiteral(TOKEN_STRING, text.String())
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// scanEscape scans the escape sequence at the current backslash, and
+// writes the character it stands for to text. Besides the escapes above,
+// \uXXXX and \u{X...} stand for a unicode code point.
+func (s *Scanner) scanEscape(text *strings.Builder) {
+	escapeStart := s.current
+	s.advance()
+	if s.isEnd() {
+		return
+	}
+	c := s.peek()
+	if c == 'u' {
+		s.advance()
+		s.scanUnicodeEscape(text, escapeStart)
+		return
+	}
+	if escaped, ok := escapes[c]; ok {
+		s.advance()
+		text.WriteRune(escaped)
+		return
+	}
+	// leave a newline or the closing quote to the string
+	if c != '\n' {
+		s.advance()
+	}
+	s.error(s.line, escapeStart, s.current-escapeStart, util.CodeInvalidEscape, "Invalid escape sequence.")
+}
+
+func (s *Scanner) scanUnicodeEscape(text *strings.Builder, escapeStart int) {
+	braced := s.match('{')
+	digits := s.current
+	for isHexDigit(s.peek()) && (braced || s.current-digits < 4) {
+		s.advance()
+	}
+	hex := s.source[digits:s.current]
+	valid := len(hex) == 4 || braced && len(hex) > 0 && len(hex) <= 6
+	if braced {
+		valid = s.match('}') && valid
+	}
+	code, _ := strconv.ParseUint(hex, 16, 32)
+	if !valid || !utf8.ValidRune(rune(code)) {
+		s.error(s.line, escapeStart, s.current-escapeStart, util.CodeInvalidEscape, "Invalid unicode escape sequence.")
+		return
+	}
+	text.WriteRune(rune(code))
 }
 
 // support: 1234, 12.34
@@ -215,7 +389,7 @@ func (s *Scanner) scanNumber() {
 }
 
 func (s *Scanner) scanIdentifier() {
-	for isAlphaNumeric(s.peek()) {
+	for isIdentifierPart(s.peek()) {
 		s.advance()
 	}
 
@@ -229,13 +403,11 @@ func (s *Scanner) scanIdentifier() {
 }
 
 // support: /* */
-func (s *Scanner) scanBlockComment() {
+func (s *Scanner) scanBlockComment() bool {
+	startLine := s.line
 	nestingLevel := 1 // 初始嵌套层级
 	for nestingLevel > 0 && !s.isEnd() {
 		switch {
-		case s.peek() == '\n':
-			s.line++
-			s.advance()
 		case s.peek() == '/' && s.peekNext() == '*':
 			s.advance()
 			s.advance()
@@ -250,23 +422,43 @@ func (s *Scanner) scanBlockComment() {
 	}
 
 	if nestingLevel > 0 {
-		s.error(s.line, "unterminated block comment")
+		s.error(startLine, s.start, 2, util.CodeUnterminatedComment, "Unterminated block comment.")
+		return false
 	}
+	return true
 }
 
-func (s *Scanner) error(line int, message string) {
-	s.scanErr = util.ErrorMsg(line, message)
-	fmt.Printf("scann error at line %d: %s\n", line, message)
+func (s *Scanner) error(line int, pos int, length int, code string, message string) {
+	d := &util.Diagnostic{
+		Severity: util.SeverityError,
+		Code:     code,
+		Message:  message,
+		Line:     line,
+		Offset:   pos,
+		Length:   length,
+	}
+	d.Locate("", s.source)
+	s.scanErr = d
+	s.errs = append(s.errs, d)
+	s.opts.ReportDiagnostic(d)
 }
 
-func isDigit(c byte) bool {
+func isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
-func isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+func isHexDigit(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isIdentifierStart and isIdentifierPart follow the Unicode properties
+// XID_Start and XID_Continue, approximated by their general categories,
+// with '_' allowed to start an identifier.
+func isIdentifierStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.In(c, unicode.Nl, unicode.Other_ID_Start)
 }
 
-func isAlphaNumeric(c byte) bool {
-	return isAlpha(c) || isDigit(c)
+func isIdentifierPart(c rune) bool {
+	return isIdentifierStart(c) ||
+		unicode.In(c, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
 }
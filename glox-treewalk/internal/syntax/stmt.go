@@ -12,8 +12,11 @@ type StmtVisitor interface {
 	VisitReturnStmt(*Return) error
 	VisitBreakStmt(*Break) error
 	VisitForDesugaredWhileStmt(*ForDesugaredWhile) error
+	VisitForInStmt(*ForIn) error
 	VisitContinueStmt(*Continue) error
 	VisitClassStmt(*Class) error
+	VisitThrowStmt(*Throw) error
+	VisitTryStmt(*Try) error
 }
 
 type Stmt interface {
@@ -21,11 +24,15 @@ type Stmt interface {
 }
 
 type Block struct {
+	Brace Token
 	Statements []Stmt
+	Closing Token
 }
-func NewBlock(statements []Stmt) *Block {
+func NewBlock(brace Token, statements []Stmt, closing Token) *Block {
 	return &Block{
+		Brace: brace,
 		Statements: statements,
+		Closing: closing,
 	}
 }
 func (n *Block) Accept(v StmtVisitor) error {
@@ -103,11 +110,13 @@ func (n *If) Accept(v StmtVisitor) error {
 }
 
 type While struct {
+	Keyword Token
 	Condition Expr
 	Body Stmt
 }
-func NewWhile(condition Expr, body Stmt) *While {
+func NewWhile(keyword Token, condition Expr, body Stmt) *While {
 	return &While{
+		Keyword: keyword,
 		Condition: condition,
 		Body: body,
 	}
@@ -143,12 +152,14 @@ func (n *Break) Accept(v StmtVisitor) error {
 }
 
 type ForDesugaredWhile struct {
+	Keyword Token
 	Condition Expr
 	Body Stmt
 	Increment Expr
 }
-func NewForDesugaredWhile(condition Expr, body Stmt, increment Expr) *ForDesugaredWhile {
+func NewForDesugaredWhile(keyword Token, condition Expr, body Stmt, increment Expr) *ForDesugaredWhile {
 	return &ForDesugaredWhile{
+		Keyword: keyword,
 		Condition: condition,
 		Body: body,
 		Increment: increment,
@@ -158,6 +169,24 @@ func (n *ForDesugaredWhile) Accept(v StmtVisitor) error {
 	return v.VisitForDesugaredWhileStmt(n)
 }
 
+type ForIn struct {
+	Keyword Token
+	Name Token
+	Iterable Expr
+	Body Stmt
+}
+func NewForIn(keyword Token, name Token, iterable Expr, body Stmt) *ForIn {
+	return &ForIn{
+		Keyword: keyword,
+		Name: name,
+		Iterable: iterable,
+		Body: body,
+	}
+}
+func (n *ForIn) Accept(v StmtVisitor) error {
+	return v.VisitForInStmt(n)
+}
+
 type Continue struct {
 	Keyword Token
 }
@@ -186,3 +215,37 @@ func (n *Class) Accept(v StmtVisitor) error {
 	return v.VisitClassStmt(n)
 }
 
+type Throw struct {
+	Keyword Token
+	Value Expr
+}
+func NewThrow(keyword Token, value Expr) *Throw {
+	return &Throw{
+		Keyword: keyword,
+		Value: value,
+	}
+}
+func (n *Throw) Accept(v StmtVisitor) error {
+	return v.VisitThrowStmt(n)
+}
+
+type Try struct {
+	Keyword Token
+	Body *Block
+	Name Token
+	Handler *Block
+	Finally *Block
+}
+func NewTry(keyword Token, body *Block, name Token, handler *Block, finally *Block) *Try {
+	return &Try{
+		Keyword: keyword,
+		Body: body,
+		Name: name,
+		Handler: handler,
+		Finally: finally,
+	}
+}
+func (n *Try) Accept(v StmtVisitor) error {
+	return v.VisitTryStmt(n)
+}
+
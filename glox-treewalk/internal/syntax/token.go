@@ -1,6 +1,10 @@
 package syntax
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
 
 type TokenType int
 
@@ -9,13 +13,17 @@ const (
 	TOKEN_RIGHT_PAREN
 	TOKEN_LEFT_BRACE
 	TOKEN_RIGHT_BRACE
+	TOKEN_LEFT_BRACKET
+	TOKEN_RIGHT_BRACKET
 	TOKEN_COMMA
+	TOKEN_COLON
 	TOKEN_DOT
 	TOKEN_MINUS
 	TOKEN_PLUS
 	TOKEN_SEMICOLON
 	TOKEN_SLASH
 	TOKEN_STAR
+	TOKEN_PERCENT
 
 	TOKEN_BANG
 	TOKEN_BANG_EQUAL
@@ -29,7 +37,9 @@ const (
 	// literals
 	TOKEN_IDENTIFIER
 	TOKEN_STRING
+	TOKEN_INTERPOLATION // the text of a string before a "${"
 	TOKEN_NUMBER
+	TOKEN_COMMENT // only with util.WithComments
 
 	// keywords
 	TOKEN_AND
@@ -50,23 +60,31 @@ const (
 	TOKEN_WHILE
 	TOKEN_BREAK
 	TOKEN_CONTINUE
+	TOKEN_THROW
+	TOKEN_TRY
+	TOKEN_CATCH
+	TOKEN_FINALLY
 
 	TOKEN_EOF
 )
 
 var (
 	TokenTypeStr = map[TokenType]string{
-		TOKEN_LEFT_PAREN:  "(",
-		TOKEN_RIGHT_PAREN: ")",
-		TOKEN_LEFT_BRACE:  "{",
-		TOKEN_RIGHT_BRACE: "}",
-		TOKEN_COMMA:       ",",
-		TOKEN_DOT:         ".",
-		TOKEN_MINUS:       "-",
-		TOKEN_PLUS:        "+",
-		TOKEN_SEMICOLON:   ";",
-		TOKEN_SLASH:       "/",
-		TOKEN_STAR:        "*",
+		TOKEN_LEFT_PAREN:    "(",
+		TOKEN_RIGHT_PAREN:   ")",
+		TOKEN_LEFT_BRACE:    "{",
+		TOKEN_RIGHT_BRACE:   "}",
+		TOKEN_LEFT_BRACKET:  "[",
+		TOKEN_RIGHT_BRACKET: "]",
+		TOKEN_COMMA:         ",",
+		TOKEN_COLON:         ":",
+		TOKEN_DOT:           ".",
+		TOKEN_MINUS:         "-",
+		TOKEN_PLUS:          "+",
+		TOKEN_SEMICOLON:     ";",
+		TOKEN_SLASH:         "/",
+		TOKEN_STAR:          "*",
+		TOKEN_PERCENT:       "%",
 
 		TOKEN_BANG:          "!",
 		TOKEN_BANG_EQUAL:    "!=",
@@ -77,9 +95,11 @@ var (
 		TOKEN_LESS:          "<",
 		TOKEN_LESS_EQUAL:    "<=",
 
-		TOKEN_IDENTIFIER: "identifier",
-		TOKEN_STRING:     "string",
-		TOKEN_NUMBER:     "number",
+		TOKEN_IDENTIFIER:    "identifier",
+		TOKEN_STRING:        "string",
+		TOKEN_INTERPOLATION: "interpolation",
+		TOKEN_NUMBER:        "number",
+		TOKEN_COMMENT:       "comment",
 
 		TOKEN_AND:      "and",
 		TOKEN_CLASS:    "class",
@@ -99,6 +119,10 @@ var (
 		TOKEN_WHILE:    "while",
 		TOKEN_BREAK:    "break",
 		TOKEN_CONTINUE: "continue",
+		TOKEN_THROW:    "throw",
+		TOKEN_TRY:      "try",
+		TOKEN_CATCH:    "catch",
+		TOKEN_FINALLY:  "finally",
 
 		TOKEN_EOF: "EOF",
 	}
@@ -109,11 +133,12 @@ type Token struct {
 	Lexeme    string
 	Literal   any
 	Line      int
-	Pos       int // position in source file
+	Pos       int // position in source file, in bytes
+	Column    int // 1-based column of Pos, in runes; 0 if unknown
 }
 
 func NewToken(tokenType TokenType, lexeme string, literal any, line int, pos int) Token {
-	return Token{tokenType, lexeme, literal, line, pos}
+	return Token{TokenType: tokenType, Lexeme: lexeme, Literal: literal, Line: line, Pos: pos}
 }
 
 func (t Token) String() string {
@@ -128,3 +153,23 @@ func (t Token) String() string {
 func (t Token) IsEmpty() bool {
 	return t.TokenType == 0 && t.Lexeme == "" && t.Literal == nil
 }
+
+// ErrorAt builds an error diagnostic pointing at token.
+func ErrorAt(token Token, code string, message string) *util.Diagnostic {
+	if token.IsEmpty() {
+		return &util.Diagnostic{Severity: util.SeverityError, Code: code, Message: message}
+	}
+	where := " at '" + token.Lexeme + "'"
+	if token.TokenType == TOKEN_EOF {
+		where = " at end"
+	}
+	return &util.Diagnostic{
+		Severity: util.SeverityError,
+		Code:     code,
+		Message:  message,
+		Line:     token.Line,
+		Offset:   token.Pos,
+		Length:   len(token.Lexeme),
+		Where:    where,
+	}
+}
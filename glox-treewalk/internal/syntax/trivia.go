@@ -0,0 +1,171 @@
+package syntax
+
+import "strings"
+
+// Trivia is what a formatter needs to know about a statement beyond its
+// syntax: the comments around it and the lines it spans, from which blank
+// lines between statements can be told.
+type Trivia struct {
+	First    Token   // the statement's first token
+	EndLine  int     // line of the statement's last token
+	Leading  []Token // comments before the statement, and hoisted out of it
+	Trailing []Token // comments after the statement on its last line
+	Inner    []Token // comments before the closing brace of a block, function or class
+	// Header holds the comments on the line of the header of a body: after
+	// the opening brace of a block, function or class, or after the
+	// condition of an if or loop whose body isn't a block.
+	Header []Token
+}
+
+// Comments holds the trivia of the statements of a program. It is only
+// collected by a parser given tokens scanned with util.WithComments.
+type Comments struct {
+	Stmts map[Stmt]*Trivia
+	Exprs map[Expr]*Trivia // comments around the elements of list and map literals
+	End   []Token          // comments after the last statement
+}
+
+// Comments returns the comments of the parsed program, nil unless the
+// parser runs with util.WithComments.
+func (p *Parser) Comments() *Comments {
+	if p.comments != nil {
+		p.comments.End = append(p.comments.End, p.pending...)
+		p.pending = nil
+	}
+	return p.comments
+}
+
+// splitComments removes the comment tokens from tokens, keeping them as
+// pending comments to be attached to statements.
+func (p *Parser) splitComments(tokens []Token) []Token {
+	code := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		if token.TokenType == TOKEN_COMMENT {
+			p.pending = append(p.pending, token)
+		} else {
+			code = append(code, token)
+		}
+	}
+	return code
+}
+
+// withTrivia parses a statement with parse and records its trivia.
+func (p *Parser) withTrivia(parse func() (Stmt, error)) (Stmt, error) {
+	if p.comments == nil {
+		return parse()
+	}
+	first := p.peek()
+	trivia := &Trivia{First: first, Leading: p.takeComments(first.Pos)}
+	stmt, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	last := p.previous()
+	trivia.EndLine = endLine(last)
+	// comments inside the statement go before it
+	trivia.Leading = append(trivia.Leading, p.takeComments(last.Pos)...)
+	trivia.Trailing = p.takeLine()
+	if attached, ok := p.comments.Stmts[stmt]; ok {
+		trivia.Inner, trivia.Header = attached.Inner, attached.Header
+	}
+	p.comments.Stmts[stmt] = trivia
+	return stmt, nil
+}
+
+// takeInner takes the comments before the closing brace of a body, which
+// must be the current token, along with header, the comments after its
+// opening brace.
+func (p *Parser) takeInner(header []Token) {
+	if p.comments != nil {
+		p.inner = p.takeComments(p.peek().Pos)
+		p.header = header
+	}
+}
+
+// attachInner attaches the comments taken by the last takeInner to stmt.
+func (p *Parser) attachInner(stmt Stmt) {
+	if p.comments == nil || len(p.inner) == 0 && len(p.header) == 0 {
+		return
+	}
+	trivia := p.stmtTrivia(stmt)
+	trivia.Inner = append(trivia.Inner, p.inner...)
+	trivia.Header = append(trivia.Header, p.header...)
+	p.inner, p.header = nil, nil
+}
+
+// attachHeader attaches the comments after the condition of an if or loop
+// to its body, before those after the body's opening brace.
+func (p *Parser) attachHeader(body Stmt, header []Token) {
+	if p.comments == nil || len(header) == 0 {
+		return
+	}
+	trivia := p.stmtTrivia(body)
+	trivia.Header = append(header, trivia.Header...)
+}
+
+func (p *Parser) stmtTrivia(stmt Stmt) *Trivia {
+	trivia, ok := p.comments.Stmts[stmt]
+	if !ok {
+		trivia = &Trivia{}
+		p.comments.Stmts[stmt] = trivia
+	}
+	return trivia
+}
+
+// elementTrivia records the comments around an element of a list or map
+// literal: leading before it, and those after it and its comma on the line
+// they end on.
+func (p *Parser) elementTrivia(element Expr, leading []Token) {
+	if p.comments == nil {
+		return
+	}
+	trailing := p.takeLine()
+	if len(leading) > 0 || len(trailing) > 0 {
+		p.comments.Exprs[element] = &Trivia{Leading: leading, Trailing: trailing}
+	}
+}
+
+// literalInner records inner, the comments before the closing bracket or
+// brace of a list or map literal.
+func (p *Parser) literalInner(literal Expr, inner []Token) {
+	if p.comments != nil && len(inner) > 0 {
+		p.comments.Exprs[literal] = &Trivia{Inner: inner}
+	}
+}
+
+// takeLine takes the pending comments between the previous token and the
+// current one that start on the line the previous token ends on.
+func (p *Parser) takeLine() []Token {
+	if p.comments == nil {
+		return nil
+	}
+	last := p.previous()
+	end, line, next := last.Pos+len(last.Lexeme), endLine(last), p.peek().Pos
+	var taken []Token
+	rest := p.pending[:0:0]
+	for _, comment := range p.pending {
+		if comment.Pos >= end && comment.Pos < next && comment.Line == line {
+			taken = append(taken, comment)
+		} else {
+			rest = append(rest, comment)
+		}
+	}
+	p.pending = rest
+	return taken
+}
+
+// takeComments takes the pending comments that start before pos.
+func (p *Parser) takeComments(pos int) []Token {
+	idx := 0
+	for idx < len(p.pending) && p.pending[idx].Pos < pos {
+		idx++
+	}
+	taken := p.pending[:idx:idx]
+	p.pending = p.pending[idx:]
+	return taken
+}
+
+// endLine returns the line token ends on.
+func endLine(token Token) int {
+	return token.Line + strings.Count(token.Lexeme, "\n")
+}
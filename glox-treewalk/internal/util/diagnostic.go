@@ -0,0 +1,245 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// error codes, grouped by the stage that reports them
+const (
+	CodeUnexpectedChar      = "E101"
+	CodeUnterminatedString  = "E102"
+	CodeUnterminatedComment = "E103"
+	CodeInvalidEscape       = "E104"
+	CodeInvalidUTF8         = "E105"
+
+	CodeSyntax = "E201"
+
+	CodeResolve = "E301"
+	CodeLimit   = "E303" // a limit of the bytecode compiler
+
+	CodeRuntime           = "E401"
+	CodeOperandType       = "E402"
+	CodeUndefinedVariable = "E403"
+	CodeUndefinedProperty = "E404"
+	CodeDivisionByZero    = "E405"
+	CodeArity             = "E406"
+	CodeNotCallable       = "E407"
+	CodeStackOverflow     = "E408"
+	CodeInterrupted       = "E409"
+	CodeIndex             = "E410"
+	CodeThrow             = "E411"
+)
+
+// Diagnostic is an error or warning tied to a span of source code.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	File     string
+	Line     int     // 1-based, 0 if the location is unknown
+	Column   int     // 1-based and counted in runes, 0 until computed by Locate
+	Offset   int     // byte offset of the span in the source
+	Length   int     // length of the span in bytes
+	Where    string  // e.g. " at 'foo'" or " at end"
+	Stack    []Frame // Lox call stack of a runtime error, innermost first
+	snippet  string  // the source line containing the span
+	start    int     // byte offset of the span in snippet
+}
+
+// Frame is one entry of a runtime traceback: the function that was running
+// and the line it had reached.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int // 1-based, 0 until computed by Locate
+	Offset   int
+}
+
+func (f Frame) String() string {
+	if f.Line == 0 {
+		return "at " + f.Function
+	}
+	location := "line " + strconv.Itoa(f.Line)
+	if f.File != "" {
+		location = f.File + ":" + strconv.Itoa(f.Line)
+	}
+	return "at " + f.Function + " (" + location + ")"
+}
+
+func (d *Diagnostic) Error() string {
+	severity := d.Severity.String()
+	severity = strings.ToUpper(severity[:1]) + severity[1:]
+	if d.Line == 0 {
+		return fmt.Sprintf("%s%s: %s", severity, d.Where, d.Message)
+	}
+	location := strconv.Itoa(d.Line)
+	if d.Column > 0 {
+		location += ":" + strconv.Itoa(d.Column)
+	}
+	return fmt.Sprintf("[line %s] %s%s: %s", location, severity, d.Where, d.Message)
+}
+
+// Locate computes the column of the diagnostic from its offset in source and
+// remembers the offending line for Render. It does nothing if source is not
+// the text the diagnostic was reported against.
+func (d *Diagnostic) Locate(file string, source string) {
+	if file != "" {
+		d.File = file
+	}
+	for idx := range d.Stack {
+		frame := &d.Stack[idx]
+		if frame.File == "" {
+			frame.File = d.File
+		}
+		if lineStart, ok := locateLine(source, frame.Line, frame.Offset); ok {
+			frame.Column = utf8.RuneCountInString(source[lineStart:frame.Offset]) + 1
+		}
+	}
+	lineStart, ok := locateLine(source, d.Line, d.Offset)
+	if !ok {
+		return
+	}
+	lineEnd := len(source)
+	if idx := strings.IndexByte(source[d.Offset:], '\n'); idx >= 0 {
+		lineEnd = d.Offset + idx
+	}
+	d.Column = utf8.RuneCountInString(source[lineStart:d.Offset]) + 1
+	d.snippet = strings.TrimRight(source[lineStart:lineEnd], "\r")
+	d.start = d.Offset - lineStart
+}
+
+// locateLine returns the offset of the start of line, if offset lies on it.
+func locateLine(source string, line int, offset int) (int, bool) {
+	if line == 0 || offset < 0 || offset > len(source) {
+		return 0, false
+	}
+	if strings.Count(source[:offset], "\n")+1 != line {
+		return 0, false
+	}
+	return strings.LastIndexByte(source[:offset], '\n') + 1, true
+}
+
+// maxRepeatedFrames is how many identical consecutive frames a traceback
+// shows before summarizing the rest, which keeps deep recursion readable.
+const maxRepeatedFrames = 3
+
+// Traceback formats the call stack of a runtime error, one frame per line.
+func (d *Diagnostic) Traceback() string {
+	return strings.Join(d.traceback(), "\n")
+}
+
+func (d *Diagnostic) traceback() []string {
+	lines := make([]string, 0, len(d.Stack))
+	for idx := 0; idx < len(d.Stack); {
+		frame := d.Stack[idx]
+		count := 1
+		for idx+count < len(d.Stack) && d.Stack[idx+count] == frame {
+			count++
+		}
+		for range min(count, maxRepeatedFrames) {
+			lines = append(lines, frame.String())
+		}
+		if count > maxRepeatedFrames {
+			lines = append(lines, fmt.Sprintf("[previous frame repeated %d more times]", count-maxRepeatedFrames))
+		}
+		idx += count
+	}
+	return lines
+}
+
+// Render formats the diagnostic in the style of rustc and clang:
+//
+//	error[E201]: expect ';' after value
+//	 --> main.lox:3:12
+//	  |
+//	3 | print a + b
+//	  |            ^
+//
+// followed by the traceback of a runtime error.
+func (d *Diagnostic) Render() string {
+	var builder strings.Builder
+	builder.WriteString(d.Severity.String())
+	if d.Code != "" {
+		builder.WriteString("[" + d.Code + "]")
+	}
+	builder.WriteString(": " + d.Message + "\n")
+	if d.Line == 0 {
+		return builder.String()
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Line)))
+	location := strconv.Itoa(d.Line)
+	if d.Column > 0 {
+		location += ":" + strconv.Itoa(d.Column)
+	}
+	if d.File != "" {
+		location = d.File + ":" + location
+	}
+	builder.WriteString(gutter + "--> " + location + "\n")
+	if d.Column > 0 {
+		d.renderSnippet(&builder, gutter)
+	}
+	for _, line := range d.traceback() {
+		builder.WriteString(gutter + "  " + line + "\n")
+	}
+	return builder.String()
+}
+
+func (d *Diagnostic) renderSnippet(builder *strings.Builder, gutter string) {
+	start := min(d.start, len(d.snippet))
+	// one caret per rune of the span, cut at the end of the line
+	width := utf8.RuneCountInString(d.snippet[start:min(start+d.Length, len(d.snippet))])
+	if width < 1 {
+		width = 1
+	}
+	// keep tabs so the caret lines up with the snippet
+	padding := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, d.snippet[:start])
+	builder.WriteString(gutter + " |\n")
+	builder.WriteString(fmt.Sprintf("%d | %s\n", d.Line, d.snippet))
+	builder.WriteString(gutter + " | " + padding + strings.Repeat("^", width) + "\n")
+}
+
+// AsDiagnostic returns the diagnostic wrapped by err, or a diagnostic without
+// a location carrying err's message.
+func AsDiagnostic(err error) *Diagnostic {
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return d
+	}
+	return &Diagnostic{Severity: SeverityError, Code: CodeRuntime, Message: err.Error()}
+}
+
+// Diagnostics is a list of diagnostics reported together.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
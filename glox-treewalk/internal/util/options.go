@@ -0,0 +1,137 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Options holds the writers shared by the scanner, parser, resolver and
+// interpreter.
+type Options struct {
+	Stdout io.Writer // program output
+	Stderr io.Writer // diagnostics
+	// Report receives every diagnostic; by default they are printed to Stderr.
+	Report func(*Diagnostic)
+	// MaxCallDepth bounds the number of nested Lox calls. Values below 1
+	// mean DefaultMaxCallDepth.
+	MaxCallDepth int
+	// MaxSteps bounds the number of statements one run may execute, 0 means
+	// no limit.
+	MaxSteps int64
+	// Timeout bounds the wall-clock time of one run, 0 means no limit.
+	Timeout time.Duration
+	// MemoryQuota bounds the approximate number of bytes one run may
+	// allocate for strings, instances, closures and environments, 0 means
+	// no limit.
+	MemoryQuota int64
+	// RandomSeed seeds the generator behind random().
+	RandomSeed int64
+	// Redefine lets a script declare a global again instead of raising a
+	// "re-define variable" error, as the REPL needs.
+	Redefine bool
+	// Comments makes the scanner keep comments as tokens, and the parser
+	// attach them to the statements around them, for tools such as lox-fmt.
+	Comments bool
+}
+
+// DefaultMaxCallDepth stays well below the depth at which the Go runtime
+// runs out of goroutine stack.
+const DefaultMaxCallDepth = 4096
+
+type Option func(*Options)
+
+func WithStdout(w io.Writer) Option {
+	return func(o *Options) {
+		o.Stdout = w
+	}
+}
+
+func WithStderr(w io.Writer) Option {
+	return func(o *Options) {
+		o.Stderr = w
+	}
+}
+
+func WithReporter(report func(*Diagnostic)) Option {
+	return func(o *Options) {
+		o.Report = report
+	}
+}
+
+// WithMaxCallDepth sets the number of nested calls after which the
+// interpreter raises a "Stack overflow." runtime error. A depth below 1
+// keeps DefaultMaxCallDepth, like 0 means the default or no limit for the
+// other options.
+func WithMaxCallDepth(depth int) Option {
+	return func(o *Options) {
+		o.MaxCallDepth = depth
+		if depth < 1 {
+			o.MaxCallDepth = DefaultMaxCallDepth
+		}
+	}
+}
+
+// WithStepBudget limits every run to steps executed statements.
+func WithStepBudget(steps int64) Option {
+	return func(o *Options) {
+		o.MaxSteps = steps
+	}
+}
+
+// WithTimeBudget limits every run to d of wall-clock time.
+func WithTimeBudget(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// WithMemoryQuota limits every run to allocating about bytes bytes.
+func WithMemoryQuota(bytes int64) Option {
+	return func(o *Options) {
+		o.MemoryQuota = bytes
+	}
+}
+
+// WithRandomSeed seeds the generator behind random(), making it produce a
+// different deterministic sequence.
+func WithRandomSeed(seed int64) Option {
+	return func(o *Options) {
+		o.RandomSeed = seed
+	}
+}
+
+// WithRedefine lets scripts re-declare globals, see Options.Redefine.
+func WithRedefine() Option {
+	return func(o *Options) {
+		o.Redefine = true
+	}
+}
+
+// WithComments keeps comments, see Options.Comments.
+func WithComments() Option {
+	return func(o *Options) {
+		o.Comments = true
+	}
+}
+
+func NewOptions(opts ...Option) *Options {
+	o := &Options{
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+		MaxCallDepth: DefaultMaxCallDepth,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *Options) ReportDiagnostic(d *Diagnostic) {
+	if o.Report != nil {
+		o.Report(d)
+		return
+	}
+	fmt.Fprintln(o.Stderr, d.Error())
+}
@@ -0,0 +1,116 @@
+package lox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestInterrupt(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []Option
+		want error
+	}{
+		{"cancelled", cancelled, nil, ErrCancelled},
+		{"step budget", context.Background(), []Option{WithStepBudget(1000)}, ErrBudgetExceeded},
+		{"time budget", context.Background(), []Option{WithTimeBudget(10 * time.Millisecond)}, ErrBudgetExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := NewVM(append(test.opts, WithStderr(io.Discard))...)
+			_, err := vm.EvalContext(test.ctx, `while (true) {}`)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Errorf("err = %T, want a runtime error", err)
+			}
+
+			// the budgets apply per run
+			if _, err := vm.Eval(`var done = true;`); err != nil {
+				t.Errorf("eval after interrupt: %s", err)
+			}
+		})
+	}
+}
+
+// TestInterruptNotCaught checks that catch clauses can't swallow an
+// interrupted run, while finally clauses still run.
+func TestInterruptNotCaught(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(WithStdout(&stdout), WithStderr(io.Discard), WithStepBudget(1000))
+	_, err := vm.Eval(`
+try {
+  while (true) {}
+} catch (e) {
+  print "caught";
+} finally {
+  print "finally";
+}
+print "after";`)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want %v", err, ErrBudgetExceeded)
+	}
+	if got := stdout.String(); got != "finally\n" {
+		t.Errorf("output = %q, want %q", got, "finally\n")
+	}
+}
+
+// TestCallBudget checks that the budgets also bound the calls a host makes
+// after an Eval.
+func TestCallBudget(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []Option
+		want error
+	}{
+		{"cancelled", cancelled, nil, ErrCancelled},
+		{"step budget", context.Background(), []Option{WithStepBudget(1000)}, ErrBudgetExceeded},
+		{"time budget", context.Background(), []Option{WithTimeBudget(10 * time.Millisecond)}, ErrBudgetExceeded},
+		{"memory quota", context.Background(), []Option{WithMemoryQuota(1 << 16)}, ErrMemoryQuotaExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := NewVM(append(test.opts, WithStderr(io.Discard))...)
+			if _, err := vm.Eval(`fun spin() { var s = ""; while (true) s = s + "x"; }`); err != nil {
+				t.Fatal(err)
+			}
+			spin, _ := vm.GetGlobal("spin")
+			if _, err := vm.CallContext(test.ctx, spin); !errors.Is(err, test.want) {
+				t.Errorf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+// TestNestedCallSharesBudget checks that a call a native makes during an
+// Eval counts against the budget of the Eval instead of starting afresh.
+func TestNestedCallSharesBudget(t *testing.T) {
+	vm := NewVM(WithStderr(io.Discard), WithStepBudget(1000))
+	vm.RegisterNative("callback", 1, func(args []Value) (Value, error) {
+		return vm.Call(args[0])
+	})
+	_, err := vm.Eval(`
+fun step() { var a = 1; var b = 2; }
+for (var i = 0; i < 1000; i = i + 1) callback(step);`)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	// the budget ends with the Eval
+	step, _ := vm.GetGlobal("step")
+	if _, err := vm.Call(step); err != nil {
+		t.Errorf("call after the eval: %s", err)
+	}
+}
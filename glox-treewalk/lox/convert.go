@@ -0,0 +1,164 @@
+package lox
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+)
+
+// ToValue converts a Go value to its Lox representation. Integers and
+// float32 become numbers, slices and arrays become lists, and maps, such as
+// the map[any]any made by ToGo, become Lox maps with their keys in sorted
+// order. Lox values such as functions, classes and instances are returned
+// unchanged. Use NewObject for an instance holding fields.
+func ToValue(v any) (Value, error) {
+	switch val := v.(type) {
+	case nil, bool, float64, string:
+		return val, nil
+	case interpreter.Callable, *interpreter.LoxInstance, *interpreter.LoxList, *interpreter.LoxMap:
+		return val, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32:
+		return rv.Float(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		elements := make([]any, rv.Len())
+		for idx := range elements {
+			element, err := ToValue(rv.Index(idx).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = element
+		}
+		return interpreter.NewLoxList(elements), nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return toMap(rv)
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return ToValue(rv.Elem().Interface())
+	}
+	return nil, fmt.Errorf("unsupported Go type %T", v)
+}
+
+// toMap converts a Go map to a Lox map. Its keys must convert to strings,
+// numbers, bools or nil.
+func toMap(rv reflect.Value) (Value, error) {
+	keys := make([]any, 0, rv.Len())
+	values := make(map[any]any, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := ToValue(iter.Key().Interface())
+		if err != nil {
+			return nil, err
+		}
+		value, err := ToValue(iter.Value().Interface())
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values[key] = value
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+	result := interpreter.NewLoxMap()
+	for _, key := range keys {
+		if err := result.Set(key, values[key]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// keyLess orders map keys nil first, then bools, numbers and strings.
+func keyLess(a, b any) bool {
+	rank := func(key any) int {
+		switch key.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		}
+		return 3
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	switch a := a.(type) {
+	case bool:
+		return !a && b.(bool)
+	case float64:
+		return a < b.(float64)
+	case string:
+		s, ok := b.(string)
+		return ok && a < s
+	}
+	return false
+}
+
+// NewObject returns an instance of the builtin class Object whose fields
+// are the entries of fields, converted with ToValue.
+func NewObject(fields map[string]any) (Value, error) {
+	values := make(map[string]any, len(fields))
+	for name, field := range fields {
+		value, err := ToValue(field)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return interpreter.NewObject(values), nil
+}
+
+// ToGo converts a Lox value to plain Go data: lists become []any, maps
+// become map[any]any and instances become map[string]any of their fields.
+// Numbers, strings, bools, nil and callables are returned unchanged.
+func ToGo(v Value) any {
+	switch val := v.(type) {
+	case *interpreter.LoxList:
+		elements := val.Elements()
+		result := make([]any, len(elements))
+		for idx, element := range elements {
+			result[idx] = ToGo(element)
+		}
+		return result
+	case *interpreter.LoxMap:
+		result := make(map[any]any, val.Len())
+		for _, key := range val.Keys() {
+			value, _ := val.Get(key)
+			result[key] = ToGo(value)
+		}
+		return result
+	case *interpreter.LoxInstance:
+		fields := val.Fields()
+		result := make(map[string]any, len(fields))
+		for name, field := range fields {
+			result[name] = ToGo(field)
+		}
+		return result
+	default:
+		return val
+	}
+}
@@ -0,0 +1,77 @@
+package lox
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestRoundTrip checks that a native returning its argument returns the
+// value it was given. Instances reach natives as their fields, which come
+// back as a map.
+func TestRoundTrip(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(WithStdout(&stdout), WithStderr(io.Discard))
+	vm.RegisterNative("echo", 1, func(args []Value) (Value, error) {
+		return args[0], nil
+	})
+	_, err := vm.Eval(`
+class Point { init(x) { this.x = x; } }
+print echo({"k": 1, 2: [true, nil]});
+print echo([1, "a", {}]);
+print echo(Point(3))["x"];
+print type(echo({"k": 1}));`)
+	if err != nil {
+		t.Fatalf("eval: %s", err)
+	}
+	want := "{2: [true, <nil>], k: 1}\n[1, a, {}]\n3\nmap\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestToValueMap(t *testing.T) {
+	value, err := ToValue(map[int]string{2: "b", 1: "a"})
+	if err != nil {
+		t.Fatalf("ToValue: %s", err)
+	}
+	if got := ToGo(value); len(got.(map[any]any)) != 2 || got.(map[any]any)[2.0] != "b" {
+		t.Errorf("ToGo(ToValue(map)) = %v", got)
+	}
+	if s := value.(interface{ String() string }).String(); s != "{1: a, 2: b}" {
+		t.Errorf("map = %s, want keys in sorted order", s)
+	}
+
+	if _, err := ToValue(map[*[]int]int{{1}: 1}); err == nil {
+		t.Errorf("ToValue accepted a list as a map key")
+	}
+}
+
+func TestToValueStringKeys(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(WithStdout(&stdout), WithStderr(io.Discard))
+	vm.RegisterNative("config", 0, func(args []Value) (Value, error) {
+		return map[string]any{"b": 2, "a": []int{1}}, nil
+	})
+	object, err := NewObject(map[string]any{"x": 1})
+	if err != nil {
+		t.Fatalf("NewObject: %s", err)
+	}
+	if err := vm.SetGlobal("point", object); err != nil {
+		t.Fatalf("SetGlobal: %s", err)
+	}
+	_, err = vm.Eval(`
+var m = config();
+print type(m);
+print m;
+print m["a"];
+print type(point);
+print point.x;`)
+	if err != nil {
+		t.Fatalf("eval: %s", err)
+	}
+	want := "map\n{a: [1], b: 2}\n[1]\ninstance\n1\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
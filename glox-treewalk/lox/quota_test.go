@@ -0,0 +1,105 @@
+package lox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestMemoryQuota runs a loop allocating at each site the quota charges.
+// The time budget stops a loop whose allocations are not counted.
+func TestMemoryQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"concatenation", `var s = "x"; while (true) s = s + "x";`},
+		{"variable", `while (true) { var x = 1; }`},
+		{"closure", `while (true) { fun f() {} }`},
+		{"call", `fun f() {} while (true) f();`},
+		{"instance", `class A {} while (true) A();`},
+		{"list literal", `while (true) [1, 2, 3];`},
+		{"list push", `var xs = []; while (true) xs.push(1);`},
+		{"list insert", `var xs = []; while (true) xs.insert(0, 1);`},
+		{"list slice", `var xs = [1, 2, 3]; while (true) xs.slice(0, 3);`},
+		{"map literal", `var m; while (true) m = {"a": 1};`},
+		{"map set", `var m = {}; var i = 0; while (true) { m[i] = i; i = i + 1; }`},
+		{"map keys", `var m = {"a": 1}; while (true) m.keys();`},
+		{"map values", `var m = {"a": 1}; while (true) m.values();`},
+		{"interpolation", `while (true) "${1}";`},
+		{"upper", `while (true) "abc".upper();`},
+		{"lower", `while (true) "ABC".lower();`},
+		{"replace", `while (true) "abc".replace("a", "b");`},
+		{"split", `while (true) "a,b".split(",");`},
+		{"substr", `while (true) "abc".substr(0, 2);`},
+		{"trim", `while (true) " abc ".trim();`},
+		{"str", `var xs = [1]; while (true) xs.push(str(xs));`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := NewVM(WithStderr(io.Discard), WithMemoryQuota(1<<16), WithTimeBudget(5*time.Second))
+			if _, err := vm.Eval(test.source); !errors.Is(err, ErrMemoryQuotaExceeded) {
+				t.Errorf("err = %v, want %v", err, ErrMemoryQuotaExceeded)
+			}
+		})
+	}
+}
+
+// TestMemoryQuotaBeforeAllocation checks that results are charged before
+// they are built, so a quota stops one that is too big from being made.
+func TestMemoryQuotaBeforeAllocation(t *testing.T) {
+	grow := func(length int) string {
+		return fmt.Sprintf(`var s = "x"; while (s.len() < %d) s = s + s;`, length)
+	}
+	tests := []struct {
+		name   string
+		source string
+	}{
+		// would make a string of 256 MB
+		{"replace", grow(16000) + ` s.replace("", s);`},
+		{"split", grow(100000) + ` s.split("");`},
+		{"interpolation", grow(100000) + ` var t = "${s}${s}${s}${s}${s}${s}${s}${s}${s}";`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := NewVM(WithStderr(io.Discard), WithMemoryQuota(1<<20))
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := vm.Eval(test.source)
+			runtime.ReadMemStats(&after)
+			if !errors.Is(err, ErrMemoryQuotaExceeded) {
+				t.Fatalf("err = %v, want %v", err, ErrMemoryQuotaExceeded)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+				t.Errorf("allocated %d bytes under a quota of %d", allocated, 1<<20)
+			}
+		})
+	}
+}
+
+func TestMemoryQuotaNotCaught(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := NewVM(WithStdout(&stdout), WithStderr(io.Discard), WithMemoryQuota(1<<16))
+	_, err := vm.Eval(`
+var xs = [];
+try {
+  while (true) xs.push(1);
+} catch (e) {
+  print "caught";
+}`)
+	if !errors.Is(err, ErrMemoryQuotaExceeded) {
+		t.Fatalf("err = %v, want %v", err, ErrMemoryQuotaExceeded)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("output = %q, want none", stdout.String())
+	}
+
+	// the quota applies per run
+	if _, err := vm.Eval(`xs = nil;`); err != nil {
+		t.Errorf("eval after the quota: %s", err)
+	}
+}
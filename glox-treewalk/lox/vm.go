@@ -0,0 +1,218 @@
+// Package lox is the public entry point for embedding the glox tree-walking
+// interpreter in Go programs.
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+// Value is a Lox value: nil, bool, float64, string, or one of the
+// interpreter's functions, classes and instances.
+type Value = any
+
+type Option = util.Option
+
+// Diagnostic is a located compile or runtime error.
+type Diagnostic = util.Diagnostic
+
+// Diagnostics holds every compile error of a script.
+type Diagnostics = util.Diagnostics
+
+// RuntimeError is an error raised while executing Lox code. Its Stack field
+// holds the Lox call stack, innermost call first.
+type RuntimeError = interpreter.RuntimeError
+
+// Frame is one entry of the call stack of a RuntimeError.
+type Frame = util.Frame
+
+// Variadic is the arity of a native function that accepts any number of
+// arguments.
+const Variadic = interpreter.VariadicArity
+
+// NativeFunc is a Go function callable from Lox. Its arguments are converted
+// with ToGo and its result with ToValue.
+type NativeFunc func(args []Value) (Value, error)
+
+var (
+	// WithStdout sets the writer for the output of `print` statements.
+	WithStdout = util.WithStdout
+	// WithStderr sets the writer for scan, parse, resolve and runtime errors.
+	WithStderr = util.WithStderr
+	// WithReporter receives every diagnostic instead of WithStderr.
+	WithReporter = util.WithReporter
+	// WithMaxCallDepth bounds the nesting of Lox calls; deeper recursion
+	// raises a "Stack overflow." runtime error. A depth below 1 keeps the
+	// default of 4096.
+	WithMaxCallDepth = util.WithMaxCallDepth
+	// WithStepBudget limits every Eval and Call to a number of executed
+	// statements.
+	WithStepBudget = util.WithStepBudget
+	// WithTimeBudget limits every Eval and Call to a duration of wall-clock
+	// time.
+	WithTimeBudget = util.WithTimeBudget
+	// WithMemoryQuota limits every Eval and Call to allocating about a
+	// number of bytes for strings, instances, closures and environments.
+	WithMemoryQuota = util.WithMemoryQuota
+	// WithRandomSeed seeds the generator behind random().
+	WithRandomSeed = util.WithRandomSeed
+	// WithRedefine lets a later Eval declare a global again, replacing it,
+	// as the REPL does.
+	WithRedefine = util.WithRedefine
+)
+
+var (
+	// ErrCancelled is wrapped by the error of an EvalContext or CallContext
+	// whose context is done.
+	ErrCancelled = interpreter.ErrCancelled
+	// ErrBudgetExceeded is wrapped by the error of an Eval or Call that ran
+	// out of its step or time budget.
+	ErrBudgetExceeded = interpreter.ErrBudgetExceeded
+	// ErrMemoryQuotaExceeded is wrapped by the error of an Eval or Call that
+	// allocated more than its memory quota.
+	ErrMemoryQuotaExceeded = interpreter.ErrMemoryQuotaExceeded
+)
+
+// VM runs Lox source code. Globals defined by one call to Eval stay visible
+// to the next.
+type VM struct {
+	interpreter *interpreter.Interpreter
+	resolver    *interpreter.Resolver
+	opts        []Option
+	stderr      io.Writer
+	report      func(*Diagnostic)
+	// the script being evaluated, used to locate diagnostics
+	file   string
+	source string
+}
+
+// NewVM creates a VM. Diagnostics are rendered with the offending source line
+// to the WithStderr writer, unless a reporter is given with WithReporter.
+func NewVM(opts ...Option) *VM {
+	options := util.NewOptions(opts...)
+	vm := &VM{
+		stderr: options.Stderr,
+		report: options.Report,
+	}
+	vm.opts = append(append([]Option{}, opts...), util.WithReporter(vm.reportDiagnostic))
+	vm.interpreter = interpreter.NewInterpreter(vm.opts...)
+	vm.resolver = interpreter.NewResolver(vm.interpreter, vm.opts...)
+	return vm
+}
+
+func (vm *VM) reportDiagnostic(d *Diagnostic) {
+	d.Locate(vm.file, vm.source)
+	if vm.report != nil {
+		vm.report(d)
+		return
+	}
+	fmt.Fprint(vm.stderr, d.Render())
+}
+
+// Eval scans, parses, resolves and executes source. If the last statement is
+// an expression statement, its value is returned. Compile errors are returned
+// together as Diagnostics, a runtime error as *RuntimeError.
+func (vm *VM) Eval(source string) (Value, error) {
+	return vm.eval(context.Background(), "", source)
+}
+
+// EvalContext works like Eval, but stops executing once ctx is done. The
+// error then wraps ErrCancelled.
+func (vm *VM) EvalContext(ctx context.Context, source string) (Value, error) {
+	return vm.eval(ctx, "", source)
+}
+
+func (vm *VM) eval(ctx context.Context, file string, source string) (Value, error) {
+	vm.file, vm.source = file, source
+	scanner := syntax.NewScanner(source, vm.opts...)
+	tokens := scanner.ScanTokens()
+	if errs := scanner.GetErrors(); len(errs) > 0 {
+		return nil, Diagnostics(errs)
+	}
+	parser := syntax.NewParser(tokens, vm.opts...)
+	stmts := parser.Parse()
+	if errs := parser.GetErrors(); len(errs) > 0 {
+		return nil, Diagnostics(errs)
+	}
+	vm.resolver.Resolve(stmts)
+	if errs := vm.resolver.GetErrors(); len(errs) > 0 {
+		return nil, Diagnostics(errs)
+	}
+	return vm.interpreter.InterpretValueContext(ctx, stmts)
+}
+
+// RunFile executes the Lox script at path.
+func (vm *VM) RunFile(path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = vm.eval(context.Background(), path, string(bytes))
+	return err
+}
+
+// SetGlobal defines or overwrites the global variable name. The value is
+// converted with ToValue.
+func (vm *VM) SetGlobal(name string, value any) error {
+	loxValue, err := ToValue(value)
+	if err != nil {
+		return err
+	}
+	vm.interpreter.SetGlobal(name, loxValue)
+	return nil
+}
+
+// GetGlobal returns the value of the global variable name, and whether it is
+// defined.
+func (vm *VM) GetGlobal(name string) (Value, bool) {
+	return vm.interpreter.GetGlobal(name)
+}
+
+// Globals returns the global variables, including natives.
+func (vm *VM) Globals() map[string]Value {
+	return vm.interpreter.Globals()
+}
+
+// Call invokes a Lox function, bound method or class with args, which are
+// converted with ToValue. Like Eval, the call has the budgets of the options,
+// unless a native makes it during an Eval or Call, whose budgets it then
+// shares.
+func (vm *VM) Call(fn Value, args ...any) (Value, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext works like Call, but stops executing once ctx is done. The
+// error then wraps ErrCancelled.
+func (vm *VM) CallContext(ctx context.Context, fn Value, args ...any) (Value, error) {
+	loxArgs := make([]Value, len(args))
+	for idx, arg := range args {
+		loxArg, err := ToValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		loxArgs[idx] = loxArg
+	}
+	return vm.interpreter.CallContext(ctx, fn, loxArgs)
+}
+
+// RegisterNative defines a global function implemented in Go. Pass Variadic
+// as arity to accept any number of arguments.
+func (vm *VM) RegisterNative(name string, arity int, fn NativeFunc) {
+	vm.interpreter.RegisterNative(name, arity, func(args []any) (any, error) {
+		goArgs := make([]Value, len(args))
+		for idx, arg := range args {
+			goArgs[idx] = ToGo(arg)
+		}
+		result, err := fn(goArgs)
+		if err != nil {
+			return nil, err
+		}
+		return ToValue(result)
+	})
+}
@@ -0,0 +1,51 @@
+package lox
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/littlekuo/glox-treewalk/internal/util"
+)
+
+func TestStackOverflow(t *testing.T) {
+	vm := NewVM(WithStderr(io.Discard), WithMaxCallDepth(50))
+	_, err := vm.Eval(`
+fun recurse(n) { return recurse(n + 1); }
+recurse(0);`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("err = %v, want a runtime error", err)
+	}
+	if runtimeErr.Code != util.CodeStackOverflow || runtimeErr.Message != "Stack overflow." {
+		t.Errorf("err = %s %q, want %s %q", runtimeErr.Code, runtimeErr.Message, util.CodeStackOverflow, "Stack overflow.")
+	}
+	if len(runtimeErr.Stack) == 0 || runtimeErr.Stack[len(runtimeErr.Stack)-1].Function != "<script>" {
+		t.Errorf("stack = %v, want it to end at the script", runtimeErr.Stack)
+	}
+
+	// the VM stays usable, and calls as deep as the limit still work
+	value, err := vm.Eval(`
+fun depth(n) { if (n == 0) return 0; return 1 + depth(n - 1); }
+depth(40);`)
+	if err != nil {
+		t.Fatalf("eval after overflow: %s", err)
+	}
+	if value != 40.0 {
+		t.Errorf("value = %v, want 40", value)
+	}
+}
+
+// TestDefaultCallDepth checks that a depth below 1 keeps the default
+// instead of making every call overflow.
+func TestDefaultCallDepth(t *testing.T) {
+	for _, depth := range []int{0, -1} {
+		vm := NewVM(WithStderr(io.Discard), WithMaxCallDepth(depth))
+		value, err := vm.Eval(`
+fun depth(n) { if (n == 0) return 0; return 1 + depth(n - 1); }
+depth(1000);`)
+		if err != nil || value != 1000.0 {
+			t.Errorf("WithMaxCallDepth(%d): value, err = %v, %v, want 1000", depth, value, err)
+		}
+	}
+}
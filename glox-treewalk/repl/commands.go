@@ -0,0 +1,144 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/lox"
+)
+
+// Command is a meta-command, entered at the prompt as ":name args".
+type Command struct {
+	Name string
+	Args string // shown by :help, e.g. "<file>"
+	Help string
+	Run  func(r *REPL, args string) error
+}
+
+// Register adds cmd to the REPL, replacing any command of the same name.
+func (r *REPL) Register(cmd Command) {
+	r.commands[cmd.Name] = cmd
+}
+
+// VM returns the VM evaluating the input, for use by commands.
+func (r *REPL) VM() *lox.VM {
+	return r.vm
+}
+
+// Stdout returns the writer commands should print to.
+func (r *REPL) Stdout() io.Writer {
+	return r.stdout
+}
+
+var builtinCommands = []Command{
+	{Name: "help", Help: "list the commands", Run: runHelp},
+	{Name: "load", Args: "<file>", Help: "run a script in the current session", Run: runLoad},
+	{Name: "tokens", Args: "<code>", Help: "print the tokens of code", Run: runTokens},
+	{Name: "ast", Args: "<code>", Help: "print the syntax tree of code", Run: runAst},
+	{Name: "env", Help: "list the global variables", Run: runEnv},
+	{Name: "reset", Help: "forget every declaration", Run: runReset},
+	{Name: "time", Args: "<code>", Help: "evaluate code and report how long it took", Run: runTime},
+}
+
+// runCommand runs the meta-command in input, which starts with ':'.
+func (r *REPL) runCommand(input string) error {
+	input = strings.TrimSpace(input)
+	name, args, _ := strings.Cut(input[1:], " ")
+	cmd, ok := r.commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command ':%s', see :help", name)
+	}
+	return cmd.Run(r, strings.TrimSpace(args))
+}
+
+func runHelp(r *REPL, _ string) error {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := r.commands[name]
+		usage := strings.TrimSpace(":" + cmd.Name + " " + cmd.Args)
+		fmt.Fprintf(r.stdout, "  %-16s %s\n", usage, cmd.Help)
+	}
+	return nil
+}
+
+func runLoad(r *REPL, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: :load <file>")
+	}
+	err := r.vm.RunFile(path)
+	var diagnostics lox.Diagnostics
+	var diagnostic *lox.Diagnostic
+	if errors.As(err, &diagnostics) || errors.As(err, &diagnostic) {
+		// already reported by the VM
+		return nil
+	}
+	return err
+}
+
+func runTokens(r *REPL, code string) error {
+	scanner := syntax.NewScanner(code, r.opts...)
+	for _, token := range scanner.ScanTokens() {
+		fmt.Fprintln(r.stdout, token)
+	}
+	return nil
+}
+
+func runAst(r *REPL, code string) error {
+	source, _ := complete(code)
+	scanner := syntax.NewScanner(source, r.opts...)
+	tokens := scanner.ScanTokens()
+	if len(scanner.GetErrors()) > 0 {
+		return nil
+	}
+	parser := syntax.NewParser(tokens, r.opts...)
+	stmts := parser.Parse()
+	if len(parser.GetErrors()) > 0 {
+		return nil
+	}
+	printer := &syntax.AstPrinter{}
+	desc, err := printer.Print(stmts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(r.stdout, desc)
+	return nil
+}
+
+func runEnv(r *REPL, _ string) error {
+	globals := r.vm.Globals()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.stdout, "%s = %v\n", name, globals[name])
+	}
+	return nil
+}
+
+func runReset(r *REPL, _ string) error {
+	r.vm = lox.NewVM(r.opts...)
+	return nil
+}
+
+func runTime(r *REPL, code string) error {
+	source, isExpr := complete(code)
+	start := time.Now()
+	value, err := r.vm.Eval(source)
+	elapsed := time.Since(start)
+	if err == nil && isExpr {
+		fmt.Fprintf(r.stdout, "%v\n", value)
+	}
+	fmt.Fprintf(r.stdout, "took %s\n", elapsed)
+	return nil
+}
@@ -0,0 +1,75 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	r, _, _ := newTestREPL()
+	r.eval("var a = 1;\n")
+	if _, ok := r.VM().GetGlobal("a"); !ok {
+		t.Fatalf("a is not defined")
+	}
+	if err := r.runCommand(":reset"); err != nil {
+		t.Fatalf(":reset: %s", err)
+	}
+	if _, ok := r.VM().GetGlobal("a"); ok {
+		t.Errorf("a is still defined after :reset")
+	}
+	// the natives are defined again
+	if _, ok := r.VM().GetGlobal("clock"); !ok {
+		t.Errorf("clock is not defined after :reset")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // in the output
+	}{
+		{":help", []string{":load <file>", ":reset", "forget every declaration"}},
+		{"  :env  ", []string{"a = 1", "clock = <native fn>"}},
+		{":tokens var a", []string{"type: var lexeme:var", "type: identifier lexeme:a", "type: EOF"}},
+		{":ast 1 + 2", []string{"(+ 1 2)"}},
+		{":time a + 1", []string{"2\n", "took "}},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			r, stdout, _ := newTestREPL()
+			r.eval("var a = 1;\n")
+			if err := r.runCommand(test.input); err != nil {
+				t.Fatalf("%s: %s", test.input, err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	r, _, _ := newTestREPL()
+	if err := r.runCommand(":nope"); err == nil || !strings.Contains(err.Error(), "unknown command ':nope'") {
+		t.Errorf(":nope = %v, want an unknown command error", err)
+	}
+	if err := r.runCommand(":load"); err == nil {
+		t.Errorf(":load without a file succeeded")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r, stdout, _ := newTestREPL()
+	r.Register(Command{Name: "echo", Args: "<text>", Help: "print text", Run: func(r *REPL, args string) error {
+		_, err := r.Stdout().Write([]byte(args + "\n"))
+		return err
+	}})
+	if err := r.runCommand(":echo  hello there "); err != nil {
+		t.Fatalf(":echo: %s", err)
+	}
+	if got, want := stdout.String(), "hello there\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
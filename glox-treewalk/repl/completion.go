@@ -0,0 +1,105 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/littlekuo/glox-treewalk/internal/interpreter"
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+)
+
+// completeWord is the liner.WordCompleter of the REPL. It completes command
+// names after a leading ':', members after "receiver.", and globals and
+// keywords anywhere else.
+func (r *REPL) completeWord(line string, pos int) (string, []string, string) {
+	runes := []rune(line)
+	before, tail := runes[:pos], string(runes[pos:])
+	start := len(before)
+	for start > 0 && isIdentifierRune(before[start-1]) {
+		start--
+	}
+	head, prefix := string(before[:start]), string(before[start:])
+
+	var candidates []string
+	switch {
+	case strings.TrimSpace(head) == ":":
+		for name := range r.commands {
+			candidates = append(candidates, name)
+		}
+	case start > 0 && before[start-1] == '.':
+		candidates = r.members(receiver(before[:start-1]))
+	default:
+		for name := range r.vm.Globals() {
+			candidates = append(candidates, name)
+		}
+		candidates = append(candidates, syntax.Keywords()...)
+	}
+	return head, matching(candidates, prefix), tail
+}
+
+// receiver returns the chain of identifiers separated by dots that ends
+// text, e.g. ["a", "b"] for "print a.b".
+func receiver(text []rune) []string {
+	start := len(text)
+	for start > 0 && (isIdentifierRune(text[start-1]) || text[start-1] == '.') {
+		start--
+	}
+	chain := strings.Split(string(text[start:]), ".")
+	for _, name := range chain {
+		if name == "" {
+			return nil
+		}
+	}
+	return chain
+}
+
+// members lists the fields and methods of the instance chain refers to.
+// The chain is evaluated by reading the global and then each field in turn,
+// so that completion never runs any Lox code.
+func (r *REPL) members(chain []string) []string {
+	if len(chain) == 0 {
+		return nil
+	}
+	value, ok := r.vm.GetGlobal(chain[0])
+	if !ok {
+		return nil
+	}
+	for _, name := range chain[1:] {
+		instance, isInstance := value.(*interpreter.LoxInstance)
+		if !isInstance {
+			return nil
+		}
+		if value, ok = instance.Fields()[name]; !ok {
+			return nil
+		}
+	}
+	instance, isInstance := value.(*interpreter.LoxInstance)
+	if !isInstance {
+		return nil
+	}
+	names := instance.Class().MethodNames()
+	for name := range instance.Fields() {
+		names = append(names, name)
+	}
+	return names
+}
+
+// matching returns the candidates starting with prefix, sorted and without
+// duplicates.
+func matching(candidates []string, prefix string) []string {
+	seen := make(map[string]bool)
+	matches := make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			seen[candidate] = true
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,71 @@
+package repl
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReceiver(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"a", []string{"a"}},
+		{"print a.b", []string{"a", "b"}},
+		// a call would have to be run to know its result
+		{"f(x).y", nil},
+		{"a..b", nil},
+		{"print ", nil},
+	}
+	for _, test := range tests {
+		if got := receiver([]rune(test.text)); !slices.Equal(got, test.want) {
+			t.Errorf("receiver(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestMatching(t *testing.T) {
+	got := matching([]string{"print", "pow", "push", "pow", "clock"}, "p")
+	if want := []string{"pow", "print", "push"}; !slices.Equal(got, want) {
+		t.Errorf("matching = %q, want %q", got, want)
+	}
+	if got := matching([]string{"a"}, "z"); len(got) != 0 {
+		t.Errorf("matching = %q, want none", got)
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	r, _, _ := newTestREPL()
+	r.eval(`
+class Inner { method() {} }
+class Outer { init() { this.inner = Inner(); this.count = 1; } run() {} }
+var outer = Outer();
+var oneMore = 1;
+`)
+	tests := []struct {
+		line     string
+		wantHead string
+		want     []string
+	}{
+		{"print outer.", "print outer.", []string{"count", "init", "inner", "run"}},
+		{"print outer.in", "print outer.", []string{"init", "inner"}},
+		{"outer.inner.", "outer.inner.", []string{"method"}},
+		{"outer.count.", "outer.count.", nil},
+		{"undefinedName.", "undefinedName.", nil},
+		{"print on", "print ", []string{"oneMore"}},
+		{"whi", "", []string{"while"}},
+		{":re", ":", []string{"reset"}},
+	}
+	for _, test := range tests {
+		head, got, tail := r.completeWord(test.line, len([]rune(test.line)))
+		if head != test.wantHead || tail != "" || !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+			t.Errorf("completeWord(%q) = %q, %q, %q, want %q, %q", test.line, head, got, tail, test.wantHead, test.want)
+		}
+	}
+
+	// completion after the cursor keeps the rest of the line
+	head, got, tail := r.completeWord("print ou + 1", 8)
+	if head != "print " || !slices.Equal(got, []string{"outer"}) || tail != " + 1" {
+		t.Errorf("completeWord in the middle = %q, %q, %q", head, got, tail)
+	}
+}
@@ -0,0 +1,204 @@
+// Package repl implements the interactive prompt of glox.
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/littlekuo/glox-treewalk/internal/syntax"
+	"github.com/littlekuo/glox-treewalk/internal/util"
+	"github.com/littlekuo/glox-treewalk/lox"
+	"github.com/peterh/liner"
+)
+
+const (
+	prompt       = "> "
+	continuation = "... "
+)
+
+// HistoryFile is the name of the history file in the home directory.
+const HistoryFile = ".glox_history"
+
+// REPL reads Lox code line by line and evaluates it in a single VM, so
+// declarations made by one input are visible to the next. Input starting
+// with ':' runs a meta-command, see Register.
+type REPL struct {
+	vm          *lox.VM
+	opts        []lox.Option
+	stdout      io.Writer
+	stderr      io.Writer
+	commands    map[string]Command
+	historyPath string
+}
+
+// New creates a REPL whose VM is configured with opts. Globals may be
+// declared again, so that a function can be entered once more after editing
+// it. History is kept in HistoryFile in the home directory.
+func New(opts ...lox.Option) *REPL {
+	opts = append(append([]lox.Option{}, opts...), lox.WithRedefine())
+	options := util.NewOptions(opts...)
+	r := &REPL{
+		vm:       lox.NewVM(opts...),
+		opts:     opts,
+		stdout:   options.Stdout,
+		stderr:   options.Stderr,
+		commands: make(map[string]Command),
+	}
+	for _, cmd := range builtinCommands {
+		r.Register(cmd)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		r.historyPath = filepath.Join(home, HistoryFile)
+	}
+	return r
+}
+
+// SetHistoryFile changes where history is kept; an empty path disables it.
+func (r *REPL) SetHistoryFile(path string) {
+	r.historyPath = path
+}
+
+// Run reads and evaluates input until end of file. Input with unbalanced
+// parentheses or braces, or an unterminated string or comment, is continued
+// on the next line. Ctrl-C discards the pending input, and Tab completes
+// names.
+func (r *REPL) Run() error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(r.completeWord)
+	r.loadHistory(line)
+	defer r.saveHistory(line)
+
+	var pending strings.Builder
+	for {
+		current := prompt
+		if pending.Len() > 0 {
+			current = continuation
+		}
+		text, err := line.Prompt(current)
+		if errors.Is(err, liner.ErrPromptAborted) {
+			pending.Reset()
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(r.stdout)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(text) != "" {
+			line.AppendHistory(text)
+		}
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(text), ":") {
+			if err := r.runCommand(text); err != nil {
+				fmt.Fprintln(r.stderr, err)
+			}
+			continue
+		}
+		pending.WriteString(text + "\n")
+		if incomplete(pending.String()) {
+			continue
+		}
+		r.eval(pending.String())
+		pending.Reset()
+	}
+}
+
+// eval runs source and prints the value of a bare expression.
+func (r *REPL) eval(source string) {
+	if strings.TrimSpace(source) == "" {
+		return
+	}
+	source, isExpr := complete(source)
+	value, err := r.vm.Eval(source)
+	if err == nil && isExpr {
+		fmt.Fprintf(r.stdout, "%v\n", value)
+	}
+}
+
+func (r *REPL) loadHistory(line *liner.State) {
+	if r.historyPath == "" {
+		return
+	}
+	if file, err := os.Open(r.historyPath); err == nil {
+		_, _ = line.ReadHistory(file)
+		file.Close()
+	}
+}
+
+func (r *REPL) saveHistory(line *liner.State) {
+	if r.historyPath == "" {
+		return
+	}
+	if file, err := os.Create(r.historyPath); err == nil {
+		_, _ = line.WriteHistory(file)
+		file.Close()
+	}
+}
+
+// quiet drops the diagnostics of the REPL's own look-ahead scans and parses;
+// the VM reports them when the input is evaluated.
+var quiet = util.WithReporter(func(*util.Diagnostic) {})
+
+// incomplete reports whether source needs more lines: it has an
+// unterminated string or block comment, or more opening than closing
+// parentheses, braces or brackets.
+func incomplete(source string) bool {
+	scanner := syntax.NewScanner(source, quiet)
+	tokens := scanner.ScanTokens()
+	for _, d := range scanner.GetErrors() {
+		if d.Code == util.CodeUnterminatedString || d.Code == util.CodeUnterminatedComment {
+			return true
+		}
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch token.TokenType {
+		case syntax.TOKEN_LEFT_PAREN, syntax.TOKEN_LEFT_BRACE, syntax.TOKEN_LEFT_BRACKET:
+			depth++
+		case syntax.TOKEN_RIGHT_PAREN, syntax.TOKEN_RIGHT_BRACE, syntax.TOKEN_RIGHT_BRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// complete returns the source to evaluate, and whether it ends with an
+// expression statement whose value should be printed. A bare expression
+// without the trailing ';' is accepted.
+func complete(source string) (string, bool) {
+	if stmts, ok := parse(source); ok {
+		return source, endsWithExpr(stmts)
+	}
+	withSemicolon := strings.TrimRight(source, " \t\r\n") + ";"
+	if stmts, ok := parse(withSemicolon); ok && endsWithExpr(stmts) {
+		return withSemicolon, true
+	}
+	return source, false
+}
+
+func parse(source string) ([]syntax.Stmt, bool) {
+	scanner := syntax.NewScanner(source, quiet)
+	tokens := scanner.ScanTokens()
+	if len(scanner.GetErrors()) > 0 {
+		return nil, false
+	}
+	parser := syntax.NewParser(tokens, quiet)
+	stmts := parser.Parse()
+	return stmts, len(parser.GetErrors()) == 0
+}
+
+func endsWithExpr(stmts []syntax.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	_, ok := stmts[len(stmts)-1].(*syntax.Expression)
+	return ok
+}
@@ -0,0 +1,121 @@
+package repl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/littlekuo/glox-treewalk/lox"
+)
+
+// newTestREPL returns a REPL writing to buffers.
+func newTestREPL() (*REPL, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return New(lox.WithStdout(&stdout), lox.WithStderr(&stderr)), &stdout, &stderr
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"print 1;", false},
+		{"fun f() {", true},
+		{"fun f() {\n  print 1;\n}", false},
+		{"print (1 +", true},
+		{"var xs = [1,", true},
+		{"var xs = [1, 2];", false},
+		{`print "unterminated`, true},
+		{"/* open comment", true},
+		// more closing than opening is an error for the parser to report
+		{"print 1);", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := incomplete(test.source); got != test.want {
+			t.Errorf("incomplete(%q) = %t, want %t", test.source, got, test.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		source     string
+		wantSource string
+		wantExpr   bool
+	}{
+		{"1 + 2;", "1 + 2;", true},
+		{"1 + 2", "1 + 2;", true},
+		{"1 + 2\n", "1 + 2;", true},
+		{"var a = 1;", "var a = 1;", false},
+		{"print 1;", "print 1;", false},
+		// a statement that is not an expression gets no ';' added
+		{"var a = 1", "var a = 1", false},
+		{"var a = 1; a", "var a = 1; a;", true},
+	}
+	for _, test := range tests {
+		gotSource, gotExpr := complete(test.source)
+		if gotSource != test.wantSource || gotExpr != test.wantExpr {
+			t.Errorf("complete(%q) = %q, %t, want %q, %t",
+				test.source, gotSource, gotExpr, test.wantSource, test.wantExpr)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	r, stdout, stderr := newTestREPL()
+	r.eval("var a = 1;\n")
+	r.eval("fun double(x) { return x * 2; }\n")
+	// declarations persist, and bare expressions print their value
+	r.eval("double(a + 1)\n")
+	r.eval("print a;\n")
+	r.eval("   \n")
+	if got, want := stdout.String(), "4\n1\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("errors = %q, want none", stderr.String())
+	}
+
+	// errors are reported, and the session goes on
+	r.eval("undefinedName\n")
+	if stderr.Len() == 0 {
+		t.Errorf("no error reported for an undefined variable")
+	}
+	stdout.Reset()
+	r.eval("a\n")
+	if got, want := stdout.String(), "1\n"; got != want {
+		t.Errorf("output after an error = %q, want %q", got, want)
+	}
+}
+
+func TestRedefine(t *testing.T) {
+	r, stdout, stderr := newTestREPL()
+	for _, input := range []string{
+		"var a = 1;",
+		"var a = 2;",
+		"fun f() { return 1; }",
+		// entered again after editing it
+		"fun f() { return a; }",
+		"f()",
+		"class A {}",
+		"class A { name() { return \"A\"; } }",
+		"A().name()",
+	} {
+		r.eval(input + "\n")
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("errors = %q, want none", stderr.String())
+	}
+	if got, want := stdout.String(), "2\nA\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// :reset keeps the REPL's options
+	if err := r.runCommand(":reset"); err != nil {
+		t.Fatal(err)
+	}
+	r.eval("var a = 1;\nvar a = 3;\n")
+	if stderr.Len() > 0 {
+		t.Errorf("errors after :reset = %q, want none", stderr.String())
+	}
+}
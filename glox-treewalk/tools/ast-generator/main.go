@@ -54,25 +54,33 @@ func main() {
 		"Super    : Token keyword, Token method",
 		"This     : Token keyword",
 		"Grouping: Expr expression",
-		"Literal: any value",
+		"Literal: Token token, any value",
 		"Variable : Token name",
 		"AnonymousFunction   : *Function decl",
+		"List     : Token bracket, []Expr elements",
+		"Index    : Expr object, Token bracket, Expr index",
+		"IndexSet : Expr object, Token bracket, Expr index, Expr value",
+		"Map      : Token brace, []Expr keys, []Expr values",
+		"Interpolation : Token quote, []Expr parts",
 	}, "Result"); err != nil {
 		log.Fatal(err)
 	}
 	if err := defineAst(outputDir, "Stmt", []string{
-		"Block      : []Stmt statements",
+		"Block      : Token brace, []Stmt statements, Token closing",
 		"Expression : Expr expression",
 		"Print      : Expr expression",
 		"Var        : Token name, Expr initializer",
 		"Function   : Token name, []Token params, []Stmt body",
 		"If         : Expr condition, Stmt thenBranch, Stmt elseBranch",
-		"While      : Expr condition, Stmt body",
+		"While      : Token keyword, Expr condition, Stmt body",
 		"Return     : Token keyword, Expr value",
 		"Break      : Token keyword",
-		"ForDesugaredWhile: Expr condition, Stmt body, Expr increment",
+		"ForDesugaredWhile: Token keyword, Expr condition, Stmt body, Expr increment",
+		"ForIn      : Token keyword, Token name, Expr iterable, Stmt body",
 		"Continue   : Token keyword",
 		"Class      : Token name, *Variable superclass, []*Function methods",
+		"Throw      : Token keyword, Expr value",
+		"Try        : Token keyword, *Block body, Token name, *Block handler, *Block finally",
 	}, "error"); err != nil {
 		log.Fatal(err)
 	}